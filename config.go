@@ -1,12 +1,10 @@
 package lsx
 
 import (
-	"bytes"
 	"context"
 	"encoding"
 	"encoding/json"
 	"fmt"
-	"os"
 	"reflect"
 	"strconv"
 	"strings"
@@ -15,25 +13,36 @@ import (
 const (
 	configScopeKey  = `@scope@`
 	configParentKey = `@parent@`
+	configMetaKey   = `@meta@`
 )
 
+// isConfigMetaKey returns a flag indicating whether the key is one of
+// the metadata-specific keys.
+func isConfigMetaKey(k string) bool {
+	return k == configScopeKey || k == configParentKey || k == configMetaKey
+}
+
 // Config is the type used to pass around configuration information.
 //
 // Please use a Config object's Len function to get an accurate number
 // of keys. Using len(c) will reflect a technically correct number, but
 // will also include some metadata-specific keys used to track the
 // Config object's scope information.
+//
+// A Config instance may be read by many goroutines at once, including
+// with Scope, as long as no goroutine modifies it at the same time.
+// A Config instance loaded by a ConfigLoader should only be modified
+// with Set and Delete, which discard the index that speeds up Get.
 type Config map[string]interface{}
 
 // Len returns the number of keys in the Config map less the
 // meatadata-specific keys.
 func (c Config) Len() int {
 	l := len(c)
-	if _, ok := c[configScopeKey]; ok {
-		l--
-	}
-	if _, ok := c[configParentKey]; ok {
-		l--
+	for _, k := range []string{configScopeKey, configParentKey, configMetaKey} {
+		if _, ok := c[k]; ok {
+			l--
+		}
 	}
 	return l
 }
@@ -62,18 +71,50 @@ func (c Config) Parent(ctx context.Context) Config {
 // elements are themselves JSON objects. Instead of referring to
 // these elements by index, the path token is used to to match the
 // "name" field of an array element when that element is a JSON object.
+//
+// The returned Config is a view of the scoped map: a shallow copy that
+// records the scope and its parent without modifying the scoped map, so
+// the same map may be scoped by many goroutines at once. Values set
+// through the view are written through to the scoped map.
 func (c Config) Scope(ctx context.Context, scope string) Config {
-	v := c.get(ctx, scope, false)
+	p, err := CompilePath(scope)
+	if err != nil {
+		return nil
+	}
+	_, v, fromEnv := c.lookupEnvPath(ctx, p)
+	if !fromEnv {
+		v = c.lookupPath(ctx, p)
+	}
 	m, ok := v.(map[string]interface{})
 	if !ok {
 		return nil
 	}
-	config := Config(m)
+	config := make(Config, len(m)+3)
+	for k, v := range m {
+		if isConfigMetaKey(k) {
+			continue
+		}
+		config[k] = v
+	}
 	config[configParentKey] = c
 	config[configScopeKey] = scope
+	config[configMetaKey] = c.newConfigScope(ctx, p, fromEnv)
 	return config
 }
 
+// source returns the map from which a scoped Config instance was created
+// or nil if the Config instance is not scoped or its scope no longer
+// refers to a map.
+func (c Config) source(ctx context.Context) map[string]interface{} {
+	parent := c.Parent(ctx)
+	scope, _ := c[configScopeKey].(string)
+	if parent == nil || scope == "" {
+		return nil
+	}
+	m, _ := parent.lookup(ctx, scope).(map[string]interface{})
+	return m
+}
+
 // Get returns a value from the config map.
 //
 // The path parameter adheres to a JSON path, dot-style notation.
@@ -81,217 +122,253 @@ func (c Config) Scope(ctx context.Context, scope string) Config {
 // elements are themselves JSON objects. Instead of referring to
 // these elements by index, the path token is used to to match the
 // "name" field of an array element when that element is a JSON object.
+//
+// An array element may also be referred to by its index, ex.
+// servers.svr01.addrs[1], and a key that contains dots may be quoted,
+// ex. params."csi.storage.k8s.io", or have its dots escaped with a
+// backslash. Wildcards are not expanded by Get; please see GetAll.
+//
+// A struct stored in the config map is queried by the names with which
+// its fields are marshaled to JSON, ex. the name in a field's "lsx" or
+// "json" tag, so a struct and its JSON form are queried with the same
+// paths.
+//
+// Get returns nil if the value is missing or if the value contains an
+// expression that cannot be interpolated; please see GetE.
 func (c Config) Get(ctx context.Context, path string) interface{} {
-	return c.get(ctx, path, true)
+	v, _ := c.GetE(ctx, path)
+	return v
 }
 func (c Config) get(
 	ctx context.Context,
 	path string,
 	askParent bool) interface{} {
 
-	// if there is an environment variable set that matches the property
-	// path, return the environment variable's value (if it's not empty)
-	if v := os.Getenv(getEnvVarName(path)); v != "" {
-		return v
+	p, err := CompilePath(path)
+	if err != nil {
+		return nil
 	}
+	return c.getPath(ctx, p, askParent)
+}
 
-	var (
-		// cur is the cursor pointing to the object that matches
-		// the path token in the for loop below
-		cur    interface{} = c
-		tokens             = strings.Split(path, ".")
-	)
-
-	// iterate through the path tokens
-	for tokIdx, tok := range tokens {
-
-		var (
-			// next points to the object that the cursor should point
-			// at the end of each loop iteration
-			next interface{}
+func (c Config) getPath(
+	ctx context.Context,
+	p *ConfigPath,
+	askParent bool) interface{} {
 
-			// curVal is the reflected value of the cursor
-			curVal reflect.Value
+	if v := c.getScopePath(ctx, p, askParent); v != nil {
+		return v
+	}
 
-			// isFinalToken is true when the loop is in its final iteration
-			_ = tokIdx == len(tokens)-1
-		)
+	// the config keys declared by the module whose scope contains the
+	// property path are the lowest layer of the lookup; please see
+	// moduleDefault
+	v, _, _ := c.moduleDefault(ctx, p)
+	return v
+}
 
-		// get the cursor's reflected value
-		curVal = reflect.ValueOf(cur)
+func (c Config) getScopePath(
+	ctx context.Context,
+	p *ConfigPath,
+	askParent bool) interface{} {
 
-		// dereference the cursor's reflected value
-		curVal = derefValue(curVal)
+	// if there is an environment variable set that matches the absolute
+	// or relative property path, return the environment variable's value
+	// (if it's not empty)
+	if _, v, ok := c.lookupEnvPath(ctx, p); ok {
+		return v
+	}
 
-		// isCurValNillable is a flag that indicates whether the current
-		// value's type is nillable and isCurValNil is a flag that
-		// indicates whether the current value is nil
-		_, _ = isNillable(curVal)
+	// if the Config instance has a value at the property path then
+	// return the value
+	if v := c.lookupPath(ctx, p); v != nil {
+		return v
+	}
 
-		logCurVal(path, tokIdx, tok, curVal)
+	// since the value is known to be nil at this point, the decision is
+	// now whether or not to query the Config instance's parent for the
+	// same path
 
-		switch curVal.Kind() {
+	// a false askParent flag explicitly determines to *not* query the parent
+	if !askParent {
+		return nil
+	}
 
-		// if the map has a key that matches the path token then
-		// assign the value for the key to next
-		case reflect.Map:
-			for _, mapKey := range curVal.MapKeys() {
-
-				// get a string representation of the dereferenced map key
-				szMapKey := toString(derefValue(mapKey).Interface())
-				//fmt.Fprintf(os.Stderr, "szMapKey=%s\n", szMapKey)
-
-				// if the map key's string representation matches the
-				// path token then assign the value for the key to
-				// next and break out of the immediate loop
-				if strings.EqualFold(tok, szMapKey) {
-					next = curVal.MapIndex(mapKey).Interface()
-					break
-				}
-			}
+	// check for the Config instance's parent, and if it is not nil query it
+	// for the propert path
+	if parent := c.Parent(ctx); parent != nil {
+		return parent.getScopePath(ctx, p, askParent)
+	}
 
-		// iterate the array looking for maps and structs:
-		//
-		//        map      if the map has a key called "name" with a value
-		//                 that matches the path token, assign the map
-		//                 to next.
-		//
-		//        struct   if the struct has a field with a name that
-		//                 matches the path token, assign the field's
-		//                 value to next
-		case reflect.Array, reflect.Slice:
-			for x := 0; x < curVal.Len(); x++ {
-				curValEl := curVal.Index(x)
-				curValEl = derefValue(curValEl)
-
-				logCurVal(path, tokIdx, tok, curValEl)
-
-				switch curValEl.Kind() {
-				// if the map has a key called "name" with a value
-				// that matches the path token, assign the map
-				// to next.
-				case reflect.Map:
-					for _, mapKey := range curValEl.MapKeys() {
-
-						// get a string representation of the dereferenced
-						// map key
-						szMapKey := toString(derefValue(mapKey).Interface())
-						//fmt.Fprintf(os.Stderr, "szMapKey=%s\n", szMapKey)
-
-						// if the map key's string representation does not
-						// match "name" then break ouf of the immediate loop
-						if !strings.EqualFold("name", szMapKey) {
-							continue
-						}
+	// the property path was not found in this Config instance or in any
+	// ancestoral Config instances, thus return nil
+	return nil
+}
 
-						// the map key's string representation matches name,
-						// so see if the value for the key matches the
-						// path token
-						mapVal := derefValue(curValEl.MapIndex(mapKey))
-						szMapVal := toStringWithOpts(mapVal.Interface(), false)
-						if strings.EqualFold(tok, szMapVal) {
-							next = curValEl.Interface()
-							break
-						}
-					}
-				// if the struct has a field with a name that
-				// matches the path token, assign the field's
-				// value to next
-				case reflect.Struct:
-					curType := curValEl.Type()
-					for fldIdx := 0; fldIdx < curType.NumField(); fldIdx++ {
-						fldType := curType.Field(fldIdx)
-						fldName := fldType.Name
-						if strings.EqualFold("name", fldName) {
-							fldVal := curValEl.Field(fldIdx)
-							if fldVal.Kind() == reflect.String {
-								szFldVal := fldVal.String()
-								if strings.EqualFold(tok, szFldVal) {
-									next = curValEl.Interface()
-									break
-								}
-							}
-						} else if strings.EqualFold(tok, fldName) {
-							fldVal := curValEl.Field(fldIdx)
-							next = fldVal.Interface()
-							break
-						}
-					}
-				}
-			}
+// lookup returns the value at the property path in the Config instance
+// without consulting environment variables or the Config instance's
+// parent. Nil is returned if the path is invalid or contains wildcards.
+func (c Config) lookup(ctx context.Context, path string) interface{} {
+	p, err := CompilePath(path)
+	if err != nil {
+		return nil
+	}
+	return c.lookupPath(ctx, p)
+}
 
-		// if the struct has a field with a name that matches
-		// the path token assign the field's value to next
-		case reflect.Struct:
-			curType := curVal.Type()
-			for fldIdx := 0; fldIdx < curType.NumField(); fldIdx++ {
-				fldType := curType.Field(fldIdx)
-				fldName := fldType.Name
-				/*if strings.EqualFold("name", fldName) {
-					fldVal := curVal.Field(fldIdx)
-					if fldVal.Kind() == reflect.String {
-						szFldVal := fldVal.String()
-						if strings.EqualFold(tok, szFldVal) {
-							next = curVal.Interface()
-							break
-						}
-					}
-				} else */if strings.EqualFold(tok, fldName) {
-					fldVal := curVal.Field(fldIdx)
-					next = fldVal.Interface()
-					break
-				}
+// lookupPath is like lookup but for a compiled path. The index of the
+// root Config instance is used if the root Config instance has one, and
+// a value that is missing from the index is looked up by reflection in
+// case it was added directly to a map returned by Get.
+func (c Config) lookupPath(ctx context.Context, p *ConfigPath) interface{} {
+	if scope := c.scopeInfo(ctx); scope.indexed {
+		if idx := c.index(ctx); idx != nil {
+			if v := idx.lookup(scope.tokens, p.tokens); v != nil {
+				return v
 			}
 		}
+	}
+	return lookupConfigPathTokens(c, p.tokens)
+}
+
+// lookupConfigPathTokens returns the value inside of cur at the path
+// formed by the tokens by reflecting on cur and its children.
+func lookupConfigPathTokens(
+	cur interface{}, tokens []configPathToken) interface{} {
+
+	// iterate through the path tokens
+	for _, tok := range tokens {
 
 		// update the cursor, and if the cursor is nil then go ahead
 		// and break out of the immediate loop
-		if cur = next; cur == nil {
+		if cur = lookupConfigPathToken(cur, tok); cur == nil {
 			break
 		}
 	}
 
-	// if the cursor is not nil then return its value
-	if cur != nil {
-		return cur
-	}
+	// return the cursor, which is nil if the property path was not found
+	return cur
+}
 
-	// since the cursor is known to be nil at this point, the decision is
-	// now whether or not to query the Config instance's parent for the
-	// same path
+// lookupConfigPathToken returns the value inside of cur that matches the
+// path token or nil if there is no such value.
+func lookupConfigPathToken(cur interface{}, pathTok configPathToken) interface{} {
 
-	// a false askParent flag explicitly determines to *not* query the parent
-	if !askParent {
+	var (
+		// next points to the object that matches the path token
+		next interface{}
+
+		// curVal is the dereferenced, reflected value of the cursor
+		curVal = derefValue(reflect.ValueOf(cur))
+
+		// tok is the key of the path token
+		tok = pathTok.key
+	)
+
+	switch pathTok.kind {
+
+	// wildcards are only expanded by GetAll
+	case wildcardConfigPathToken:
 		return nil
-	}
 
-	// check for the Config instance's parent, and if it is not nil query it
-	// for the propert path
-	if parent := c.Parent(ctx); parent != nil {
-		return parent.get(ctx, path, askParent)
+	// an index matches the array element at the index
+	case indexConfigPathToken:
+		switch curVal.Kind() {
+		case reflect.Array, reflect.Slice:
+			if pathTok.index < curVal.Len() {
+				return curVal.Index(pathTok.index).Interface()
+			}
+		}
+		return nil
 	}
 
-	// the property path was not found in this Config instance or in any
-	// ancestoral Config instances, thus return nil
-	return nil
-}
+	switch curVal.Kind() {
 
-var debug, _ = strconv.ParseBool(os.Getenv("LSX_DEBUG"))
+	// if the map has a key that matches the path token then
+	// assign the value for the key to next; please see findMapKey
+	// for which key is used when more than one key matches
+	case reflect.Map:
+		if mapKey, ok := findMapKey(curVal, tok); ok {
+			next = curVal.MapIndex(mapKey).Interface()
+		}
+
+	// iterate the array looking for maps and structs:
+	//
+	//        map      if the map has a key called "name" with a value
+	//                 that matches the path token, assign the map
+	//                 to next.
+	//
+	//        struct   if the struct has a field with a name that
+	//                 matches the path token, assign the field's
+	//                 value to next
+	//
+	// the first element that matches the path token is used
+	case reflect.Array, reflect.Slice:
+		for x := 0; x < curVal.Len() && next == nil; x++ {
+			curValEl := curVal.Index(x)
+			curValEl = derefValue(curValEl)
+
+			switch curValEl.Kind() {
+			// if the map has a key called "name" with a value
+			// that matches the path token, assign the map
+			// to next.
+			case reflect.Map:
+				for _, mapKey := range curValEl.MapKeys() {
+
+					// get a string representation of the dereferenced
+					// map key
+					szMapKey := toString(derefValue(mapKey).Interface())
+					//fmt.Fprintf(os.Stderr, "szMapKey=%s\n", szMapKey)
+
+					// if the map key's string representation does not
+					// match "name" then break ouf of the immediate loop
+					if !strings.EqualFold("name", szMapKey) {
+						continue
+					}
+
+					// the map key's string representation matches name,
+					// so see if the value for the key matches the
+					// path token
+					mapVal := derefValue(curValEl.MapIndex(mapKey))
+					szMapVal := toStringWithOpts(mapVal.Interface(), false)
+					if strings.EqualFold(tok, szMapVal) {
+						next = curValEl.Interface()
+						break
+					}
+				}
+			// if the struct has a field called "name" with a value
+			// that matches the path token, assign the struct to
+			// next. otherwise if the struct has a field with a name
+			// that matches the path token, assign the field's value
+			// to next; please see structFields for how fields are
+			// named
+			case reflect.Struct:
+				for _, fld := range structFields(curValEl) {
+					if strings.EqualFold("name", fld.name) {
+						fldVal := derefValue(fld.value)
+						if fldVal.Kind() == reflect.String &&
+							strings.EqualFold(tok, fldVal.String()) {
+							next = curValEl.Interface()
+							break
+						}
+					} else if strings.EqualFold(tok, fld.name) {
+						next = fld.value.Interface()
+						break
+					}
+				}
+			}
+		}
 
-func logCurVal(path string, tokIdx int, tok string, curVal reflect.Value) {
-	if !debug {
-		return
+	// if the struct has a field with a name that matches the path
+	// token, assign the field's value to next; please see structFields
+	// for how fields are named
+	case reflect.Struct:
+		if fldVal, ok := structField(curVal, tok); ok {
+			next = fldVal.Interface()
+		}
 	}
-	buf, _ := json.MarshalIndent(curVal.Interface(), "\t\t\t", "  ")
-	fmt.Fprintf(os.Stderr, `
-curVal:
-	path		%[1]s
-	tokn		%[2]d:%[3]s
-	kind		%[4]v
-	type		%[5]T
-	valu		%[6]v
 
-`, path, tokIdx, tok, curVal.Kind(), curVal.Interface(), string(buf))
+	return next
 }
 
 // GetStr returns a string value from the config map.
@@ -302,58 +379,26 @@ func (c Config) GetStr(ctx context.Context, path string) string {
 // MarshalJSON implements a custom marshal routine for the Config type
 // in order to omit the @parent@ field and prevent unnecessary data
 // duplication in the marshaled output.
+//
+// The output is deterministic. The keys of an object are written in
+// the order in which the config's layers defined them when the order
+// is known, such as for a config loaded by ConfigLoader from JSON,
+// YAML, or TOML files. Otherwise, and for the keys that were defined
+// by layers without an order, such as env vars, the keys are written
+// in lexical order.
+//
+// Secret values, and the values the config schema marks as secret, are
+// marshaled as "***". Please see Reveal.
 func (c Config) MarshalJSON() ([]byte, error) {
-	w := &bytes.Buffer{}
-	if _, err := w.Write([]byte{'{'}); err != nil {
-		return nil, err
-	}
-	cx := 0
-	cl := len(c)
-	if _, ok := c[configScopeKey].(string); ok {
-		cl--
-	}
-	if _, ok := c[configParentKey].(Config); ok {
-		cl--
-	}
-	for k, v := range c {
-		if k == configScopeKey || k == configParentKey {
-			continue
-		}
-		if _, err := w.Write([]byte{'"'}); err != nil {
-			return nil, err
-		}
-		if _, err := w.Write([]byte(k)); err != nil {
-			return nil, err
-		}
-		if _, err := w.Write([]byte{'"'}); err != nil {
-			return nil, err
-		}
-		if _, err := w.Write([]byte{':'}); err != nil {
-			return nil, err
-		}
-		buf, err := json.Marshal(v)
-		if err != nil {
-			return nil, err
-		}
-		if _, err := w.Write(buf); err != nil {
-			return nil, err
-		}
-		if cx < cl-1 {
-			if _, err := w.Write([]byte{','}); err != nil {
-				return nil, err
-			}
-		}
-		cx++
+	ctx := context.Background()
+	e := &configEncoder{secrets: c.secretPaths(ctx)}
+	if meta := c.meta(ctx); meta != nil {
+		e.order = meta.order
 	}
-	if _, err := w.Write([]byte{'}'}); err != nil {
+	if err := e.encode(c, c.FullPath(ctx, "")); err != nil {
 		return nil, err
 	}
-	return w.Bytes(), nil
-}
-
-func getEnvVarName(path string) string {
-	return fmt.Sprintf("LSX_%s",
-		strings.Replace(strings.ToUpper(path), ".", "_", -1))
+	return e.w.Bytes(), nil
 }
 
 // isNillable returns two flags indicating whether or not the reflected
@@ -399,6 +444,8 @@ func toStringWithOpts(v interface{}, deep bool) string {
 	switch vt := v.(type) {
 	case string:
 		return vt
+	case Secret:
+		return string(vt)
 	case *string:
 		return *vt
 	case fmt.Stringer:
@@ -439,10 +486,31 @@ func toStringWithOpts(v interface{}, deep bool) string {
 		return vv.Interface().(string)
 	}
 
-	// if the value is a bool or numeric then return the value
-	// formatted as a string with the %d format pattern
-	if k >= reflect.Bool && k <= reflect.Complex128 {
-		return fmt.Sprintf("%d", vv.Interface())
+	// if the value is a bool then return the value formatted as
+	// "true" or "false"
+	if k == reflect.Bool {
+		return strconv.FormatBool(vv.Bool())
+	}
+
+	// if the value is an integer then return the value formatted
+	// as a base 10 string
+	if k >= reflect.Int && k <= reflect.Int64 {
+		return strconv.FormatInt(vv.Int(), 10)
+	}
+	if k >= reflect.Uint && k <= reflect.Uintptr {
+		return strconv.FormatUint(vv.Uint(), 10)
+	}
+
+	// if the value is a float then return the value formatted with
+	// the smallest number of digits necessary to represent the value
+	if k == reflect.Float32 || k == reflect.Float64 {
+		return strconv.FormatFloat(vv.Float(), 'f', -1, vv.Type().Bits())
+	}
+
+	// if the value is a complex number then return the value
+	// formatted as a string with the %v format pattern
+	if k == reflect.Complex64 || k == reflect.Complex128 {
+		return fmt.Sprintf("%v", vv.Interface())
 	}
 
 	// if the value is an array or map then return the value
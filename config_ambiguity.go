@@ -0,0 +1,98 @@
+package lsx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Paths are matched case-insensitively, and the following rules make
+// lookups deterministic when more than one value matches a path token:
+//
+//	map keys      a key that matches the token exactly is preferred,
+//	              otherwise the lexically smallest of the keys that
+//	              match the token case-insensitively is used
+//
+//	array names   the first element, in index order, whose name matches
+//	              the token case-insensitively is used
+//
+//	struct fields the first field, in declaration order, whose name
+//	              matches the token case-insensitively is used. The
+//	              name of a field is the name with which the field is
+//	              marshaled to JSON; please see structFields
+//
+// Configs that rely on these rules are ambiguous, and checkConfigKeys
+// reports them as invalid so they are rejected when they are loaded.
+
+// checkConfigKeys records a ConfigValidationError in errs for each map
+// key in v that differs from another key in the same map only in case,
+// and for each array element whose name differs from the name of an
+// earlier element in the same array only in case. The messages name the
+// other key or element, and the source, if any.
+func checkConfigKeys(v interface{}, path, source string, errs *MultiError) {
+	fail := func(path, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if source != "" {
+			msg += " in " + source
+		}
+		*errs = append(*errs, &ConfigValidationError{Path: path, Message: msg})
+	}
+
+	switch tv := v.(type) {
+	case Config:
+		m, _ := toStringMap(tv)
+		checkConfigKeys(m, path, source, errs)
+	case map[string]interface{}:
+		keys := sortedKeys(tv)
+		seen := map[string]string{}
+		for _, k := range keys {
+			if isConfigMetaKey(k) {
+				continue
+			}
+			kpath := joinConfigPath(path, k)
+			fk := strings.ToLower(k)
+			if prev, ok := seen[fk]; ok {
+				fail(kpath, "ambiguous key: collides with %s",
+					joinConfigPath(path, prev))
+			} else {
+				seen[fk] = k
+			}
+			checkConfigKeys(tv[k], kpath, source, errs)
+		}
+	case []interface{}:
+		seen := map[string]int{}
+		for i, e := range tv {
+			epath := elementPath(path, i, e)
+			if m, ok := e.(map[string]interface{}); ok {
+				if name, ok := m["name"].(string); ok && name != "" {
+					fn := strings.ToLower(name)
+					if prev, ok := seen[fn]; ok {
+						epath = fmt.Sprintf("%s[%d]", path, i)
+						fail(epath, "duplicate name: %s: collides with %s[%d]",
+							name, path, prev)
+					} else {
+						seen[fn] = i
+					}
+				}
+			}
+			checkConfigKeys(e, epath, source, errs)
+		}
+	}
+}
+
+// checkConfigLayerKeys checks the keys and names of each of the layers
+// and returns a MultiError of ConfigValidationError sorted by path, or
+// nil if none of the layers are ambiguous.
+func checkConfigLayerKeys(layers ConfigLayers) error {
+	var errs MultiError
+	for _, layer := range layers {
+		var layerErrs MultiError
+		checkConfigKeys(layer.Config, "", layer.Source, &layerErrs)
+		sort.SliceStable(layerErrs, func(i, j int) bool {
+			return layerErrs[i].(*ConfigValidationError).Path <
+				layerErrs[j].(*ConfigValidationError).Path
+		})
+		errs = append(errs, layerErrs...)
+	}
+	return errs.ErrOrNil()
+}
@@ -0,0 +1,93 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config ambiguity", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal([]byte(`{
+			"Logging": {"level": "warn"},
+			"logging": {"level": "debug"},
+			"LOGGING": {"level": "error"},
+			"servers": [
+				{"name": "svr00", "type": "libstorage"},
+				{"name": "svr01", "type": "csi"},
+				{"name": "SVR00", "type": "csi"}
+			]
+		}`), &config)).Should(Succeed())
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("should report case-folding collisions with both paths", func() {
+		err := config.Validate(ctx)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring(
+			"path=Logging: ambiguous key: collides with LOGGING"))
+		Ω(err.Error()).Should(ContainSubstring(
+			"path=logging: ambiguous key: collides with LOGGING"))
+	})
+
+	It("should report duplicate names with both paths", func() {
+		err := config.Validate(ctx)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring(
+			"path=servers[2]: duplicate name: SVR00: collides with servers[0]"))
+	})
+
+	It("should reject ambiguous files at load time", func() {
+		tmpDir, err := ioutil.TempDir("", "lsx-config-ambiguity")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+		f := filepath.Join(tmpDir, "config.json")
+		Ω(ioutil.WriteFile(f, []byte(
+			`{"a": {"B": 1, "b": 2}}`), 0644)).Should(Succeed())
+		_, _, err = (&lsx.ConfigLoader{Files: []string{f}}).Load(ctx)
+		Ω(err).Should(HaveOccurred())
+		Ω(err).Should(BeAssignableToTypeOf(lsx.MultiError{}))
+		Ω(err.Error()).Should(Equal(
+			"error: invalid config: path=a.b: ambiguous key: collides with a.B in " +
+				f))
+	})
+
+	It("should look up ambiguous keys and names deterministically", func() {
+		for i := 0; i < 50; i++ {
+			Ω(config.Get(ctx, "logging.level")).Should(Equal("debug"))
+			Ω(config.Get(ctx, "Logging.level")).Should(Equal("warn"))
+			Ω(config.Get(ctx, "LOGGING.level")).Should(Equal("error"))
+			Ω(config.Get(ctx, "lOgGiNg.level")).Should(Equal("error"))
+			Ω(config.Get(ctx, "servers.svr00.type")).Should(Equal("libstorage"))
+			Ω(config.Get(ctx, "servers.SVR00.type")).Should(Equal("libstorage"))
+		}
+	})
+
+	It("should look up ambiguous keys the same way with an index", func() {
+		indexed := lsx.ConfigLayers{}.Merge(ctx)
+		for k, v := range config {
+			indexed[k] = v
+		}
+		for _, path := range []string{
+			"logging.level", "Logging.level", "LOGGING.level",
+			"lOgGiNg.level", "servers.svr00.type", "servers.SVR00.type",
+		} {
+			p := lsx.MustCompilePath(path)
+			Ω(indexed.GetPath(ctx, p)).Should(Equal(config.Get(ctx, path)), path)
+		}
+	})
+})
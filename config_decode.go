@@ -0,0 +1,349 @@
+package lsx
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	typeOfDuration        = reflect.TypeOf(time.Duration(0))
+	typeOfTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Decode fills the struct pointed to by out with the values from the
+// provided config scope. An empty scope decodes the Config instance
+// itself.
+//
+// The path of each struct field is read from the field's "lsx" tag,
+// falling back to its "json" tag and then the field's name. Fields
+// that are unexported or that have a tag of "-" are skipped. A nested
+// struct field is decoded from the path formed by the field's path
+// and the nested fields' paths, and an embedded struct without a tag
+// is decoded as if its fields belonged to the outer struct.
+// An embedded pointer to an unexported struct type cannot be allocated
+// by Decode, so it is decoded only if it is not nil.
+//
+// Values are looked up with GetE, so a field that is not defined by
+// the scope inherits the value defined by the scope's ancestors. A
+// field that is not defined at all is set to the value of its
+// "default" tag, if one exists.
+//
+// Duration fields accept the same values as GetDuration, and integer
+// fields also accept sizes such as "512KiB" or "10MB".
+//
+// All of the values that cannot be converted to their fields' types
+// are reported by a single MultiError that contains a ConfigTypeError
+// for each of the values. Values with expressions that cannot be
+// interpolated are reported the same way by ConfigInterpolationError.
+func (c Config) Decode(ctx context.Context, scope string, out interface{}) error {
+	ov := reflect.ValueOf(out)
+	if ov.Kind() != reflect.Ptr || ov.IsNil() ||
+		ov.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("error: invalid decode target: %T", out)
+	}
+
+	config := c
+	if scope != "" {
+		if config = c.Scope(ctx, scope); config == nil {
+			config = Config{configParentKey: c, configScopeKey: scope}
+		}
+	}
+
+	d := &configDecoder{ctx: ctx, config: config}
+	d.decodeStruct(ov.Elem(), "")
+	return d.errs.ErrOrNil()
+}
+
+type configDecoder struct {
+	ctx    context.Context
+	config Config
+	errs   MultiError
+}
+
+func (d *configDecoder) decodeStruct(sv reflect.Value, prefix string) {
+	st := sv.Type()
+	for i := 0; i < st.NumField(); i++ {
+		var (
+			sf        = st.Field(i)
+			fv        = sv.Field(i)
+			name, tag = structFieldName(sf)
+		)
+		if name == "" {
+			continue
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		// an embedded struct without a tag is flattened into the
+		// outer struct
+		ft := sf.Type
+		if sf.Anonymous && !tag {
+			if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					if !fv.CanSet() {
+						d.errs = append(d.errs, fmt.Errorf(
+							"error: cannot set embedded pointer to "+
+								"unexported struct: %s", ft.Elem()))
+						continue
+					}
+					fv.Set(reflect.New(ft.Elem()))
+				}
+				d.decodeStruct(fv.Elem(), prefix)
+				continue
+			}
+			if ft.Kind() == reflect.Struct {
+				d.decodeStruct(fv, prefix)
+				continue
+			}
+		}
+
+		if isDecodableStruct(ft) {
+			d.decodeStruct(fv, path)
+			continue
+		}
+		if ft.Kind() == reflect.Ptr && isDecodableStruct(ft.Elem()) {
+			if fv.IsNil() {
+				fv.Set(reflect.New(ft.Elem()))
+			}
+			d.decodeStruct(fv.Elem(), path)
+			continue
+		}
+
+		v, err := d.config.GetE(d.ctx, path)
+		if err != nil {
+			if _, ok := err.(*ConfigNotFoundError); !ok {
+				d.errs = append(d.errs, err)
+				continue
+			}
+			def, ok := sf.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+			v = def
+		}
+		if err := decodeValue(fv, v); err != nil {
+			d.errs = append(d.errs,
+				d.config.typeError(d.ctx, path, ft.String(), v))
+		}
+	}
+}
+
+// isDecodableStruct returns a flag indicating whether the type is a
+// struct whose fields should be decoded individually.
+func isDecodableStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct &&
+		!reflect.PtrTo(t).Implements(typeOfTextUnmarshaler) &&
+		t != reflect.TypeOf(time.Time{})
+}
+
+// structFieldName returns the config name of a struct field and a flag
+// indicating whether the name was read from a tag. An empty name is
+// returned for fields that should be skipped.
+func structFieldName(sf reflect.StructField) (string, bool) {
+	if sf.PkgPath != "" && !sf.Anonymous {
+		return "", false
+	}
+	for _, key := range []string{"lsx", "json"} {
+		tag, ok := sf.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		if tag == "-" {
+			return "", false
+		}
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name, true
+		}
+	}
+	if sf.Anonymous {
+		t := sf.Type
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if sf.PkgPath != "" && t.Kind() != reflect.Struct {
+			return "", false
+		}
+	}
+	return sf.Name, false
+}
+
+// decodeValue assigns v to fv, converting v to the type of fv.
+func decodeValue(fv reflect.Value, v interface{}) error {
+	ft := fv.Type()
+
+	if ft.Kind() == reflect.Ptr {
+		pv := reflect.New(ft.Elem())
+		if err := decodeValue(pv.Elem(), v); err != nil {
+			return err
+		}
+		fv.Set(pv)
+		return nil
+	}
+
+	if reflect.PtrTo(ft).Implements(typeOfTextUnmarshaler) {
+		s, ok := toScalarString(v)
+		if !ok {
+			return errDecode
+		}
+		u := fv.Addr().Interface().(encoding.TextUnmarshaler)
+		return u.UnmarshalText([]byte(s))
+	}
+
+	if ft == typeOfDuration {
+		d, ok := toDuration(v)
+		if !ok {
+			return errDecode
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch ft.Kind() {
+	case reflect.String:
+		s, ok := toScalarString(v)
+		if !ok {
+			return errDecode
+		}
+		fv.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, ok := toBool(v)
+		if !ok {
+			return errDecode
+		}
+		fv.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		i, ok := toInt64(v)
+		if !ok {
+			if i, ok = toSize(v); !ok {
+				return errDecode
+			}
+		}
+		if fv.OverflowInt(i) {
+			return errDecode
+		}
+		fv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := toInt64(v)
+		if !ok {
+			if i, ok = toSize(v); !ok {
+				return errDecode
+			}
+		}
+		if i < 0 || fv.OverflowUint(uint64(i)) {
+			return errDecode
+		}
+		fv.SetUint(uint64(i))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat64(v)
+		if !ok || fv.OverflowFloat(f) {
+			return errDecode
+		}
+		fv.SetFloat(f)
+		return nil
+	case reflect.Interface:
+		vv := reflect.ValueOf(v)
+		if !vv.Type().AssignableTo(ft) {
+			return errDecode
+		}
+		fv.Set(vv)
+		return nil
+	case reflect.Slice:
+		if ft.Elem().Kind() == reflect.String {
+			s, ok := toStringSlice(v)
+			if !ok {
+				return errDecode
+			}
+			sv := reflect.MakeSlice(ft, len(s), len(s))
+			for i := range s {
+				sv.Index(i).SetString(s[i])
+			}
+			fv.Set(sv)
+			return nil
+		}
+	}
+
+	// all other types are decoded by way of JSON, and a string value
+	// is treated as a JSON document
+	var buf []byte
+	if s, ok := v.(string); ok {
+		buf = []byte(s)
+	} else {
+		var err error
+		if buf, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+	pv := reflect.New(ft)
+	if err := json.Unmarshal(buf, pv.Interface()); err != nil {
+		return err
+	}
+	fv.Set(pv.Elem())
+	return nil
+}
+
+var errDecode = fmt.Errorf("error: decode failed")
+
+// sizeSuffixes are the multipliers for size units. Single-letter units
+// are binary multipliers.
+var sizeSuffixes = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1e3,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1e6,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1e9,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1e12,
+	"tib": 1 << 40,
+}
+
+// toSize parses a size string such as "512KiB" or "1.5GB" into a
+// number of bytes.
+func toSize(v interface{}) (int64, bool) {
+	s, ok := toText(v)
+	if !ok {
+		return 0, false
+	}
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsSpace(r)
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	f, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, false
+	}
+	m, ok := sizeSuffixes[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, false
+	}
+	f *= m
+	if f < math.MinInt64 || f > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
@@ -0,0 +1,164 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/akutz/lsx"
+)
+
+type testLoggingConfig struct {
+	Level     string `json:"level"`
+	Requests  bool   `lsx:"requests" json:"logRequests"`
+	Responses bool
+	Format    string `default:"text"`
+}
+
+type testCommonConfig struct {
+	Name string `json:"name"`
+}
+
+type testServerConfig struct {
+	testCommonConfig
+	Type     string            `json:"type"`
+	Addrs    []string          `json:"addrs"`
+	Logging  testLoggingConfig `json:"logging"`
+	Timeout  time.Duration     `lsx:"timeout" default:"30s"`
+	MaxBody  int64             `lsx:"maxBody" default:"1MiB"`
+	Workers  int               `lsx:"workers" default:"4"`
+	Labels   map[string]string `lsx:"labels" default:"{\"a\":\"b\"}"`
+	Ignored  string            `json:"-"`
+	internal string
+	TLS      *testServerTLSConf `lsx:"tls"`
+}
+
+type testEmbeddedPtrConfig struct {
+	*testCommonConfig
+	Type string `json:"type"`
+}
+
+type testServerTLSConf struct {
+	Enabled bool `lsx:"enabled" default:"false"`
+}
+
+var _ = Describe("Config Decode", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+		svr    testServerConfig
+		err    error
+		scope  string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal(
+			exampleConfigJSON,
+			&config)).ShouldNot(HaveOccurred())
+		scope = "servers.svr01"
+		svr = testServerConfig{Ignored: "ignored", internal: "internal"}
+	})
+	JustBeforeEach(func() {
+		err = config.Decode(ctx, scope, &svr)
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("should decode the scope", func() {
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(svr.Name).Should(Equal("svr01"))
+		Ω(svr.Type).Should(Equal("csi"))
+		Ω(svr.Addrs).Should(Equal([]string{
+			"tcp://127.0.0.1:8989",
+			"unix:///tmp/lsx/run/csi.sock",
+		}))
+	})
+	It("should inherit values from the parent", func() {
+		Ω(svr.Logging.Level).Should(Equal("debug"))
+		Ω(svr.Logging.Requests).Should(BeTrue())
+		Ω(svr.Logging.Responses).Should(BeTrue())
+	})
+	It("should apply defaults", func() {
+		Ω(svr.Logging.Format).Should(Equal("text"))
+		Ω(svr.Timeout).Should(Equal(30 * time.Second))
+		Ω(svr.MaxBody).Should(Equal(int64(1 << 20)))
+		Ω(svr.Workers).Should(Equal(4))
+		Ω(svr.Labels).Should(Equal(map[string]string{"a": "b"}))
+		Ω(svr.TLS).ShouldNot(BeNil())
+		Ω(svr.TLS.Enabled).Should(BeFalse())
+	})
+	It("should skip ignored fields", func() {
+		Ω(svr.Ignored).Should(Equal("ignored"))
+		Ω(svr.internal).Should(Equal("internal"))
+	})
+
+	Context("with values to convert", func() {
+		BeforeEach(func() {
+			Ω(config.Set(ctx, "servers.svr01.timeout", "1m")).Should(Succeed())
+			Ω(config.Set(ctx, "servers.svr01.maxBody", "10MB")).Should(Succeed())
+			Ω(config.Set(ctx, "servers.svr01.tls.enabled", "true")).Should(
+				Succeed())
+		})
+		It("should convert the values", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(svr.Timeout).Should(Equal(time.Minute))
+			Ω(svr.MaxBody).Should(Equal(int64(10000000)))
+			Ω(svr.TLS.Enabled).Should(BeTrue())
+		})
+	})
+
+	Context("with invalid values", func() {
+		BeforeEach(func() {
+			Ω(config.Set(ctx, "servers.svr01.timeout", true)).Should(Succeed())
+			Ω(config.Set(ctx, "servers.svr01.workers", "many")).Should(Succeed())
+		})
+		It("should report every error", func() {
+			Ω(err).Should(HaveOccurred())
+			merr, ok := err.(lsx.MultiError)
+			Ω(ok).Should(BeTrue())
+			Ω(merr).Should(HaveLen(2))
+			Ω(err.Error()).Should(ContainSubstring(
+				"path=servers.svr01.timeout"))
+			Ω(err.Error()).Should(ContainSubstring(
+				"path=servers.svr01.workers"))
+		})
+	})
+
+	Context("with a missing scope", func() {
+		BeforeEach(func() {
+			scope = "servers.svr09"
+		})
+		It("should decode the inherited values and defaults", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(svr.Name).Should(BeEmpty())
+			Ω(svr.Logging.Level).Should(Equal("debug"))
+			Ω(svr.Workers).Should(Equal(4))
+		})
+	})
+
+	Context("with an embedded pointer to an unexported struct", func() {
+		It("should decode the struct if it is not nil", func() {
+			out := testEmbeddedPtrConfig{testCommonConfig: &testCommonConfig{}}
+			Ω(config.Decode(ctx, scope, &out)).Should(Succeed())
+			Ω(out.Name).Should(Equal("svr01"))
+			Ω(out.Type).Should(Equal("csi"))
+		})
+		It("should fail if the struct is nil", func() {
+			var out testEmbeddedPtrConfig
+			Ω(config.Decode(ctx, scope, &out)).Should(MatchError(
+				"error: cannot set embedded pointer to unexported struct: " +
+					"lsx_test.testCommonConfig"))
+			Ω(out.Type).Should(Equal("csi"))
+		})
+	})
+
+	Context("with an invalid target", func() {
+		It("should fail", func() {
+			Ω(config.Decode(ctx, scope, svr)).ShouldNot(Succeed())
+		})
+	})
+})
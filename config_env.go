@@ -0,0 +1,168 @@
+package lsx
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// DefaultEnvPrefix is the prefix of the names of the environment
+// variables that override config values when no prefix is stored in
+// the context with EnvPrefixKey.
+const DefaultEnvPrefix = "LSX"
+
+// WithEnvPrefix returns a context that causes config lookups to use
+// environment variables whose names begin with the provided prefix.
+// An empty prefix means the names are derived from the paths alone.
+func WithEnvPrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, EnvPrefixKey, prefix)
+}
+
+// EnvPrefix returns the prefix stored in the context with EnvPrefixKey
+// or DefaultEnvPrefix if there is no such prefix.
+func EnvPrefix(ctx context.Context) string {
+	if ctx != nil {
+		if v, ok := ctx.Value(EnvPrefixKey).(string); ok {
+			return v
+		}
+	}
+	return DefaultEnvPrefix
+}
+
+// EnvVarName returns the name of the environment variable that
+// overrides the value at the provided path. The path is upper-cased,
+// and each character that is not a letter, digit, or underscore is
+// replaced with an underscore, ex. the path services.svc00.logging.level
+// is overridden by LSX_SERVICES_SVC00_LOGGING_LEVEL. Quotes and escape
+// characters are removed from the path first, and indexes are treated
+// as segments, ex. the path params."a.b".addrs[1] is overridden by
+// LSX_PARAMS_A_B_ADDRS_1.
+func EnvVarName(ctx context.Context, path string) string {
+	if tokens, err := parseConfigPath(path); err == nil {
+		return prefixEnvVarName(ctx, envVarBody(tokens))
+	}
+	return prefixEnvVarName(ctx, toEnvVarChars(path))
+}
+
+// envVarBody returns the name of the environment variable that overrides
+// the value at the parsed path, without a prefix.
+func envVarBody(tokens []configPathToken) string {
+	segs := make([]string, len(tokens))
+	for i, t := range tokens {
+		segs[i] = t.key
+		if t.kind != keyConfigPathToken {
+			segs[i] = strings.Trim(t.String(), "[]")
+		}
+	}
+	return toEnvVarChars(strings.Join(segs, "_"))
+}
+
+// toEnvVarChars upper-cases s and replaces each character that is not a
+// letter, digit, or underscore with an underscore.
+func toEnvVarChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// prefixEnvVarName returns the name of an environment variable with the
+// prefix stored in the context.
+func prefixEnvVarName(ctx context.Context, name string) string {
+	if prefix := EnvPrefix(ctx); prefix != "" {
+		return prefix + "_" + name
+	}
+	return name
+}
+
+// ConfigEnvVar is an environment variable that overrides a config
+// value.
+type ConfigEnvVar struct {
+	// Name is the name of the environment variable.
+	Name string `json:"name"`
+
+	// Path is the path of the value the environment variable overrides,
+	// relative to the Config instance from which it was listed.
+	Path string `json:"path"`
+
+	// Value is the value of the environment variable.
+	Value interface{} `json:"value"`
+}
+
+// EnvVars returns the environment variables that currently override
+// the values defined by the Config instance, sorted by path. For each
+// path the variable named after the absolute path is listed in favor
+// of the variable named after the relative path, the same precedence
+// used by Get.
+func (c Config) EnvVars(ctx context.Context) []ConfigEnvVar {
+	var vars []ConfigEnvVar
+	walkConfigPaths(c, "", func(path string) {
+		if name, v, ok := c.lookupEnv(ctx, path); ok {
+			vars = append(vars, ConfigEnvVar{Name: name, Path: path, Value: v})
+		}
+	})
+	return vars
+}
+
+// lookupEnv returns the value of the environment variable that
+// overrides the value at the provided path. The variable named after
+// the absolute path of the value is consulted first, followed by the
+// variable named after the path relative to the Config instance.
+func (c Config) lookupEnv(
+	ctx context.Context, path string) (string, interface{}, bool) {
+
+	for _, name := range c.envVarNames(ctx, path) {
+		if v := os.Getenv(name); v != "" {
+			return name, parseEnvValue(v), true
+		}
+	}
+	return "", nil, false
+}
+
+// lookupEnvPath is like lookupEnv but for a compiled path.
+func (c Config) lookupEnvPath(
+	ctx context.Context, p *ConfigPath) (string, interface{}, bool) {
+
+	rel := prefixEnvVarName(ctx, p.env)
+	if scope := c.scopeInfo(ctx); scope.env != "" {
+		abs := prefixEnvVarName(ctx, scope.env+"_"+p.env)
+		if v := os.Getenv(abs); v != "" {
+			return abs, parseEnvValue(v), true
+		}
+	}
+	if v := os.Getenv(rel); v != "" {
+		return rel, parseEnvValue(v), true
+	}
+	return "", nil, false
+}
+
+// envVarNames returns the names of the environment variables that
+// override the value at the provided path, in order of precedence.
+func (c Config) envVarNames(ctx context.Context, path string) []string {
+	names := []string{EnvVarName(ctx, c.FullPath(ctx, path))}
+	if rel := EnvVarName(ctx, path); rel != names[0] {
+		names = append(names, rel)
+	}
+	return names
+}
+
+// parseEnvValue returns the value of an environment variable. A value
+// that is a JSON array or object is decoded as such; otherwise the
+// value is returned as a string.
+func parseEnvValue(v string) interface{} {
+	s := strings.TrimSpace(v)
+	if s == "" || (s[0] != '[' && s[0] != '{') {
+		return v
+	}
+	var jv interface{}
+	if err := json.Unmarshal([]byte(s), &jv); err != nil {
+		return v
+	}
+	return jv
+}
@@ -0,0 +1,132 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config environment overrides", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+		envs   []string
+	)
+
+	setenv := func(k, v string) {
+		os.Setenv(k, v)
+		envs = append(envs, k)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal(
+			exampleConfigJSON,
+			&config)).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		for _, k := range envs {
+			os.Unsetenv(k)
+		}
+		envs = nil
+		config = nil
+	})
+
+	It("should name env vars after paths", func() {
+		Ω(lsx.EnvVarName(ctx, "services.svc00.logging.level")).Should(
+			Equal("LSX_SERVICES_SVC00_LOGGING_LEVEL"))
+		Ω(lsx.EnvVarName(ctx, "servers.svr-00.addrs")).Should(
+			Equal("LSX_SERVERS_SVR_00_ADDRS"))
+		Ω(lsx.EnvVarName(lsx.WithEnvPrefix(ctx, "APP"), "a.b")).Should(
+			Equal("APP_A_B"))
+		Ω(lsx.EnvVarName(lsx.WithEnvPrefix(ctx, ""), "a.b")).Should(
+			Equal("A_B"))
+	})
+
+	It("should override a scoped value by its absolute path", func() {
+		setenv("LSX_SERVICES_SVC00_LOGGING_LEVEL", "warn")
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("debug"))
+		Ω(config.Get(ctx, "services.svc00.logging.level")).Should(
+			Equal("warn"))
+		svc := config.Scope(ctx, "services.svc00")
+		Ω(svc.Get(ctx, "logging.level")).Should(Equal("warn"))
+	})
+	It("should prefer the absolute path to the relative path", func() {
+		setenv("LSX_LOGGING_LEVEL", "error")
+		svc := config.Scope(ctx, "services.svc00")
+		Ω(svc.Get(ctx, "logging.level")).Should(Equal("error"))
+		setenv("LSX_SERVICES_SVC00_LOGGING_LEVEL", "warn")
+		Ω(svc.Get(ctx, "logging.level")).Should(Equal("warn"))
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("error"))
+	})
+	It("should use the prefix from the context", func() {
+		setenv("LSX_LOGGING_LEVEL", "error")
+		setenv("APP_LOGGING_LEVEL", "warn")
+		Ω(config.Get(lsx.WithEnvPrefix(ctx, "APP"), "logging.level")).Should(
+			Equal("warn"))
+	})
+	It("should decode JSON arrays and objects", func() {
+		setenv("LSX_SERVERS_SVR00_ADDRS",
+			`["tcp://127.0.0.1:7980","tcp://127.0.0.1:7981"]`)
+		setenv("LSX_SERVICES_SVC00_LOGGING", `{"level":"warn"}`)
+		setenv("LSX_SERVERS_SVR00_TYPE", "[csi")
+		Ω(config.GetStringSlice(ctx, "servers.svr00.addrs")).Should(Equal(
+			[]string{"tcp://127.0.0.1:7980", "tcp://127.0.0.1:7981"}))
+		Ω(config.Get(ctx, "services.svc00.logging")).Should(Equal(
+			map[string]interface{}{"level": "warn"}))
+		Ω(config.Get(ctx, "servers.svr00.type")).Should(Equal("[csi"))
+	})
+
+	It("should list the env vars that affect the config", func() {
+		setenv("LSX_LOGGING_LEVEL", "error")
+		setenv("LSX_SERVERS_SVR00_ADDRS", `["tcp://127.0.0.1:7980"]`)
+		setenv("LSX_UNKNOWN_KEY", "value")
+		Ω(config.EnvVars(ctx)).Should(Equal([]lsx.ConfigEnvVar{
+			{
+				Name:  "LSX_LOGGING_LEVEL",
+				Path:  "logging.level",
+				Value: "error",
+			},
+			{
+				Name:  "LSX_SERVERS_SVR00_ADDRS",
+				Path:  "servers.svr00.addrs",
+				Value: []interface{}{"tcp://127.0.0.1:7980"},
+			},
+		}))
+	})
+	It("should list the env vars that affect a scope", func() {
+		setenv("LSX_LOGGING_LEVEL", "error")
+		setenv("LSX_SERVICES_SVC00_LOGGING_REQUESTS", "false")
+		svc := config.Scope(ctx, "services.svc00")
+		Ω(svc.EnvVars(ctx)).Should(Equal([]lsx.ConfigEnvVar{
+			{
+				Name:  "LSX_LOGGING_LEVEL",
+				Path:  "logging.level",
+				Value: "error",
+			},
+			{
+				Name:  "LSX_SERVICES_SVC00_LOGGING_REQUESTS",
+				Path:  "logging.requests",
+				Value: "false",
+			},
+		}))
+	})
+
+	It("should load JSON-valued env vars into the env layer", func() {
+		setenv("LSX_SERVERS_SVR00_ADDRS", `["tcp://127.0.0.1:7980"]`)
+		loader := &lsx.ConfigLoader{
+			Files: []string{string(exampleConfigJSON)},
+			Env:   true,
+		}
+		config, layers, err := loader.Load(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(layers.ByKind(lsx.EnvConfigLayer)).Should(HaveLen(1))
+		os.Unsetenv("LSX_SERVERS_SVR00_ADDRS")
+		Ω(config.Get(ctx, "servers.svr00.addrs")).Should(Equal(
+			[]interface{}{"tcp://127.0.0.1:7980"}))
+	})
+})
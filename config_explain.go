@@ -0,0 +1,296 @@
+package lsx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// configMeta is the metadata stored in a root Config instance.
+type configMeta struct {
+	// origins are the origins of the config's values keyed by the
+	// lower-case paths of the values.
+	origins map[string]ConfigOrigin
+
+	// order are the keys of the config's objects in the order in which
+	// they were first defined by the config's layers, keyed by the
+	// lower-case paths of the objects.
+	order map[string][]string
+
+	// index is the index of the config, or nil if the index has not
+	// been built since the config was last modified. The value is a
+	// *configIndex.
+	index atomic.Value
+}
+
+// meta returns the metadata of the root Config instance or nil if the
+// root Config instance has no metadata.
+func (c Config) meta(ctx context.Context) *configMeta {
+	m, _ := c.root(ctx)[configMetaKey].(*configMeta)
+	return m
+}
+
+// ConfigOrigin describes where a config value came from.
+type ConfigOrigin struct {
+	// Layer is the kind of the layer that provided the value.
+	Layer ConfigLayerKind `json:"layer"`
+
+	// Source is the source of the layer that provided the value, such
+	// as the path to a config file.
+	Source string `json:"source,omitempty"`
+
+	// Line is the line in Source at which the value is defined. Line
+	// is zero if the line is not known.
+	Line int `json:"line,omitempty"`
+
+	// Remote is a flag indicating whether the value was fetched from a
+	// remote source; please see ConfigLayer.Remote.
+	Remote bool `json:"remote,omitempty"`
+}
+
+// String returns the origin as layer, layer:source, or
+// layer:source:line.
+func (o ConfigOrigin) String() string {
+	s := o.Layer.String()
+	if o.Source != "" {
+		s += ":" + o.Source
+	}
+	if o.Line > 0 {
+		s += fmt.Sprintf(":%d", o.Line)
+	}
+	return s
+}
+
+// ConfigExplainStepKind is the kind of a step in a resolution trace.
+type ConfigExplainStepKind uint8
+
+const (
+	// InvalidConfigExplainStep is an invalid step.
+	InvalidConfigExplainStep ConfigExplainStepKind = iota
+
+	// EnvConfigExplainStep is the check of an environment variable.
+	EnvConfigExplainStep
+
+	// ScopeConfigExplainStep is the lookup of a path in a scope.
+	ScopeConfigExplainStep
+
+	// ModuleConfigExplainStep is the lookup of a path in the config
+	// keys declared by the module whose scope contains the path.
+	ModuleConfigExplainStep
+)
+
+// String returns the name of the step kind.
+func (k ConfigExplainStepKind) String() string {
+	switch k {
+	case EnvConfigExplainStep:
+		return "env"
+	case ScopeConfigExplainStep:
+		return "scope"
+	case ModuleConfigExplainStep:
+		return "module"
+	}
+	return "invalid"
+}
+
+// MarshalText returns the name of the step kind.
+func (k ConfigExplainStepKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ConfigExplainStep is a single step in a resolution trace.
+type ConfigExplainStep struct {
+	// Kind is the kind of the step.
+	Kind ConfigExplainStepKind `json:"kind"`
+
+	// Scope is the absolute path of the scope that was consulted. The
+	// root scope's path is empty.
+	Scope string `json:"scope"`
+
+	// EnvVar is the name of the environment variable that was checked.
+	EnvVar string `json:"envVar,omitempty"`
+
+	// Path is the absolute path that was looked up.
+	Path string `json:"path,omitempty"`
+
+	// Found is a flag indicating whether the step produced the value.
+	Found bool `json:"found"`
+
+	// Origin is the origin of the value found by a scope step, if the
+	// origin is known.
+	Origin *ConfigOrigin `json:"origin,omitempty"`
+
+	// Module is the type and name of the module whose declared config
+	// keys were consulted by a module step, ex. server:csi.
+	Module string `json:"module,omitempty"`
+}
+
+// ConfigExplanation is the resolution trace of a config value.
+type ConfigExplanation struct {
+	// Path is the path that was explained.
+	Path string `json:"path"`
+
+	// Scope is the absolute path of the scope from which the path was
+	// explained. The root scope's path is empty.
+	Scope string `json:"scope,omitempty"`
+
+	// Steps are the steps taken to resolve the value, in order. The
+	// last step produced the value if the value was found.
+	Steps []ConfigExplainStep `json:"steps"`
+
+	// Found is a flag indicating whether the value was found.
+	Found bool `json:"found"`
+
+	// Value is the value returned by Get.
+	Value interface{} `json:"value,omitempty"`
+
+	// RawValue is the value before its expressions were interpolated.
+	// RawValue is nil if the value has no expressions.
+	RawValue interface{} `json:"rawValue,omitempty"`
+
+	// Secret is a flag indicating whether the value is a secret.
+	Secret bool `json:"secret,omitempty"`
+
+	// Error describes why the value could not be interpolated.
+	Error string `json:"error,omitempty"`
+}
+
+// Explain returns the resolution trace of the value at the provided
+// path: each environment variable that was checked and each scope that
+// was consulted, in the same order as Get, along with the origin of
+// the value, such as the config file and line that defined it. If no
+// scope defines the value, the config keys declared by the module whose
+// scope contains the path are consulted last; please see RegisterModule.
+//
+// The origins of values are recorded by ConfigLayers.Merge and thus
+// ConfigLoader.Load.
+func (c Config) Explain(ctx context.Context, path string) *ConfigExplanation {
+	e := &ConfigExplanation{Path: path, Scope: c.FullPath(ctx, "")}
+
+	for cur := c; cur != nil && !e.Found; cur = cur.Parent(ctx) {
+		scope := cur.FullPath(ctx, "")
+
+		for _, name := range cur.envVarNames(ctx, path) {
+			step := ConfigExplainStep{
+				Kind:   EnvConfigExplainStep,
+				Scope:  scope,
+				EnvVar: name,
+			}
+			step.Found = os.Getenv(name) != ""
+			e.Steps = append(e.Steps, step)
+			if e.Found = step.Found; e.Found {
+				break
+			}
+		}
+		if e.Found {
+			break
+		}
+
+		step := ConfigExplainStep{
+			Kind:  ScopeConfigExplainStep,
+			Scope: scope,
+			Path:  cur.FullPath(ctx, path),
+		}
+		if cur.lookup(ctx, path) != nil {
+			step.Found, e.Found = true, true
+			if meta := cur.meta(ctx); meta != nil {
+				if o, ok := meta.origins[strings.ToLower(step.Path)]; ok {
+					step.Origin = &o
+				}
+			}
+			e.Secret = cur.secretPaths(ctx)[strings.ToLower(step.Path)]
+		}
+		e.Steps = append(e.Steps, step)
+	}
+
+	if !e.Found {
+		if p, err := CompilePath(path); err == nil {
+			if _, abs, mc := c.moduleDefault(ctx, p); mc != nil {
+				e.Found = true
+				e.Steps = append(e.Steps, ConfigExplainStep{
+					Kind:   ModuleConfigExplainStep,
+					Scope:  c.FullPath(ctx, ""),
+					Path:   abs,
+					Found:  true,
+					Module: fmt.Sprintf("%s:%s", mc.Type, mc.Name),
+				})
+			}
+		}
+	}
+	if !e.Found {
+		return e
+	}
+
+	raw := c.get(ctx, path, true)
+	if _, ok := raw.(Secret); ok {
+		e.Secret = true
+	}
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		e.Error = err.Error()
+		e.Value = raw
+		return e
+	}
+	e.Value = v
+	if !reflect.DeepEqual(raw, v) {
+		if _, ok := raw.(Secret); !ok {
+			e.RawValue = raw
+		}
+	}
+	return e
+}
+
+// String returns the resolution trace in a human-readable form. Secret
+// values are redacted.
+func (e *ConfigExplanation) String() string {
+	w := &bytes.Buffer{}
+	fmt.Fprintf(w, "path: %s\n", e.Path)
+	if e.Scope != "" {
+		fmt.Fprintf(w, "scope: %s\n", e.Scope)
+	}
+	for _, s := range e.Steps {
+		scope := s.Scope
+		if scope == "" {
+			scope = "(root)"
+		}
+		target, result := s.Path, "not found"
+		switch s.Kind {
+		case EnvConfigExplainStep:
+			target, result = s.EnvVar, "not set"
+			if s.Found {
+				result = "set"
+			}
+		case ScopeConfigExplainStep:
+			if s.Found {
+				result = "found"
+				if s.Origin != nil {
+					result += " in " + s.Origin.String()
+				}
+			}
+		case ModuleConfigExplainStep:
+			result = "found in " + s.Module
+		}
+		fmt.Fprintf(w, "  %-5s  %s  %s: %s\n", s.Kind, scope, target, result)
+	}
+	if !e.Found {
+		fmt.Fprintln(w, "value: <missing>")
+		return w.String()
+	}
+	value := func(v interface{}) string {
+		if e.Secret {
+			return redactedSecret
+		}
+		return toString(v)
+	}
+	fmt.Fprintf(w, "value: %s\n", value(e.Value))
+	if e.RawValue != nil {
+		fmt.Fprintf(w, "raw value: %s\n", value(e.RawValue))
+	}
+	if e.Error != "" {
+		fmt.Fprintf(w, "error: %s\n", e.Error)
+	}
+	return w.String()
+}
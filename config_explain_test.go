@@ -0,0 +1,148 @@
+package lsx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config Explain", func() {
+
+	var (
+		ctx        context.Context
+		tmpDir     string
+		configFile string
+		config     lsx.Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		ctx = context.Background()
+		tmpDir, err = ioutil.TempDir("", "lsx-config-explain")
+		Ω(err).ShouldNot(HaveOccurred())
+		configFile = filepath.Join(tmpDir, "config.json")
+		Ω(ioutil.WriteFile(configFile, exampleConfigJSON, 0644)).Should(
+			Succeed())
+		loader := &lsx.ConfigLoader{
+			Defaults: lsx.Config{
+				"timeouts": map[string]interface{}{"read": "1m"},
+			},
+			Files: []string{configFile},
+			Args:  []string{"services.svc00.logging.level=warn"},
+		}
+		config, _, err = loader.Load(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+		config = nil
+	})
+
+	It("should explain a value from a file", func() {
+		e := config.Explain(ctx, "servers.svr01.addrs")
+		Ω(e.Found).Should(BeTrue())
+		Ω(e.Value).Should(HaveLen(2))
+		Ω(e.Steps).Should(Equal([]lsx.ConfigExplainStep{
+			{
+				Kind:   lsx.EnvConfigExplainStep,
+				EnvVar: "LSX_SERVERS_SVR01_ADDRS",
+			},
+			{
+				Kind:  lsx.ScopeConfigExplainStep,
+				Path:  "servers.svr01.addrs",
+				Found: true,
+				Origin: &lsx.ConfigOrigin{
+					Layer:  lsx.FileConfigLayer,
+					Source: configFile,
+					Line:   18,
+				},
+			},
+		}))
+	})
+	It("should explain a value from the defaults and args", func() {
+		e := config.Explain(ctx, "timeouts.read")
+		Ω(e.Steps[len(e.Steps)-1].Origin.Layer).Should(
+			Equal(lsx.DefaultsConfigLayer))
+		e = config.Explain(ctx, "services.svc00.logging.level")
+		Ω(e.Value).Should(Equal("warn"))
+		Ω(e.Steps[len(e.Steps)-1].Origin.Layer).Should(
+			Equal(lsx.ArgsConfigLayer))
+	})
+
+	It("should explain a value inherited by a scope", func() {
+		svc := config.Scope(ctx, "services.svc00")
+		e := svc.Explain(ctx, "servers")
+		Ω(e.Scope).Should(Equal("services.svc00"))
+		Ω(e.Found).Should(BeTrue())
+		Ω(e.Steps).Should(HaveLen(3))
+		Ω(e.Steps[1].EnvVar).Should(Equal("LSX_SERVERS"))
+		Ω(e.Steps[2].Scope).Should(Equal("services.svc00"))
+		Ω(e.Steps[2].Path).Should(Equal("services.svc00.servers"))
+		Ω(e.Steps[2].Found).Should(BeTrue())
+
+		svr := config.Scope(ctx, "servers.svr00")
+		e = svr.Explain(ctx, "logging.level")
+		Ω(e.Value).Should(Equal("debug"))
+		Ω(e.Steps).Should(HaveLen(5))
+		Ω(e.Steps[0].EnvVar).Should(Equal("LSX_SERVERS_SVR00_LOGGING_LEVEL"))
+		Ω(e.Steps[1].EnvVar).Should(Equal("LSX_LOGGING_LEVEL"))
+		Ω(e.Steps[2].Path).Should(Equal("servers.svr00.logging.level"))
+		Ω(e.Steps[2].Found).Should(BeFalse())
+		Ω(e.Steps[3].Scope).Should(Equal(""))
+		Ω(e.Steps[4].Path).Should(Equal("logging.level"))
+		Ω(e.Steps[4].Origin.Line).Should(Equal(3))
+	})
+
+	It("should explain a value from an env var", func() {
+		os.Setenv("LSX_LOGGING_LEVEL", "error")
+		defer os.Unsetenv("LSX_LOGGING_LEVEL")
+		e := config.Scope(ctx, "services.svc00").Explain(ctx, "logging.level")
+		Ω(e.Value).Should(Equal("error"))
+		Ω(e.Steps).Should(HaveLen(2))
+		Ω(e.Steps[1].EnvVar).Should(Equal("LSX_LOGGING_LEVEL"))
+		Ω(e.Steps[1].Found).Should(BeTrue())
+	})
+
+	It("should explain an interpolated value", func() {
+		Ω(config.Set(ctx, "a", "${ref:logging.level}")).Should(Succeed())
+		e := config.Explain(ctx, "a")
+		Ω(e.Value).Should(Equal("debug"))
+		Ω(e.RawValue).Should(Equal("${ref:logging.level}"))
+	})
+
+	It("should explain a missing value", func() {
+		e := config.Explain(ctx, "missing")
+		Ω(e.Found).Should(BeFalse())
+		Ω(e.Value).Should(BeNil())
+		Ω(e.String()).Should(ContainSubstring("value: <missing>"))
+	})
+
+	It("should print the trace", func() {
+		s := config.Explain(ctx, "servers.svr01.type").String()
+		Ω(s).Should(ContainSubstring("LSX_SERVERS_SVR01_TYPE: not set"))
+		Ω(s).Should(ContainSubstring(
+			"servers.svr01.type: found in file:" + configFile + ":17"))
+		Ω(s).Should(ContainSubstring("value: csi"))
+	})
+	It("should redact secrets from the printed trace", func() {
+		Ω(config.Set(ctx, "token", lsx.Secret("s3cr3t"))).Should(Succeed())
+		e := config.Explain(ctx, "token")
+		Ω(e.Secret).Should(BeTrue())
+		Ω(e.Value).Should(Equal("s3cr3t"))
+		Ω(e.String()).ShouldNot(ContainSubstring("s3cr3t"))
+	})
+
+	It("should record the lines of values in JSONC", func() {
+		f := filepath.Join(tmpDir, "config.jsonc")
+		Ω(ioutil.WriteFile(f, []byte(exampleJSONC), 0644)).Should(Succeed())
+		config, _, err := (&lsx.ConfigLoader{Files: []string{f}}).Load(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+		e := config.Explain(ctx, "servers.svr00")
+		Ω(e.Steps[1].Origin.Line).Should(Equal(10))
+		e = config.Explain(ctx, "logging.url")
+		Ω(e.Steps[1].Origin.Line).Should(Equal(5))
+	})
+})
@@ -0,0 +1,774 @@
+package lsx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigFormat is the format of a config document.
+type ConfigFormat uint8
+
+const (
+	// InvalidConfigFormat is an invalid config format.
+	InvalidConfigFormat ConfigFormat = iota
+
+	// JSONConfigFormat is the JSON format.
+	JSONConfigFormat
+
+	// JSONCConfigFormat is the JSON format extended with comments and
+	// trailing commas.
+	JSONCConfigFormat
+
+	// YAMLConfigFormat is the YAML format.
+	YAMLConfigFormat
+
+	// TOMLConfigFormat is the TOML format.
+	TOMLConfigFormat
+)
+
+const (
+	// maxConfigFormat is the max, valid config format. Used for
+	// iterating the config format constants.
+	maxConfigFormat = TOMLConfigFormat
+)
+
+// String returns the config format's string representation.
+func (f ConfigFormat) String() string {
+	switch f {
+	case JSONConfigFormat:
+		return "json"
+	case JSONCConfigFormat:
+		return "jsonc"
+	case YAMLConfigFormat:
+		return "yaml"
+	case TOMLConfigFormat:
+		return "toml"
+	}
+	return "invalid"
+}
+
+// ParseConfigFormat parses the string representation of a config
+// format. The string "yml" is also accepted as the YAML format.
+func ParseConfigFormat(s string) (ConfigFormat, error) {
+	if strings.EqualFold(s, "yml") {
+		return YAMLConfigFormat, nil
+	}
+	for f := InvalidConfigFormat + 1; f <= maxConfigFormat; f++ {
+		if strings.EqualFold(s, f.String()) {
+			return f, nil
+		}
+	}
+	return InvalidConfigFormat, fmt.Errorf(
+		"error: invalid config format: %s", s)
+}
+
+// configFileExts maps config file extensions to their formats.
+var configFileExts = map[string]ConfigFormat{
+	".json":  JSONConfigFormat,
+	".jsonc": JSONCConfigFormat,
+	".yaml":  YAMLConfigFormat,
+	".yml":   YAMLConfigFormat,
+	".toml":  TOMLConfigFormat,
+}
+
+// isConfigFile returns a flag indicating whether the file name has the
+// extension of a supported config format.
+func isConfigFile(name string) bool {
+	_, ok := configFileExts[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+var tomlLinePatt = regexp.MustCompile(
+	`^(\[\[?[^\]]+\]\]?|[A-Za-z0-9_."'-]+\s*=.*)$`)
+
+// DetectConfigFormat returns the format of a config document. The
+// format is detected from the extension of the provided file name, if
+// any, and otherwise from the document's content. A JSON document that
+// contains comments or trailing commas is detected as JSONC.
+func DetectConfigFormat(name string, buf []byte) ConfigFormat {
+	f, ok := configFileExts[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		f = detectConfigFormat(buf)
+	}
+	if f == JSONConfigFormat && !json.Valid(buf) {
+		if json.Valid(stripJSONC(buf)) {
+			return JSONCConfigFormat
+		}
+	}
+	return f
+}
+
+func detectConfigFormat(buf []byte) ConfigFormat {
+	s := bytes.TrimSpace(buf)
+	if bytes.HasPrefix(s, []byte("//")) || bytes.HasPrefix(s, []byte("/*")) {
+		return JSONCConfigFormat
+	}
+	if bytes.HasPrefix(s, []byte("{")) {
+		return JSONConfigFormat
+	}
+
+	// the first line that is not blank or a comment determines whether
+	// the document is TOML or YAML
+	for _, line := range strings.Split(string(s), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if tomlLinePatt.MatchString(line) {
+			return TOMLConfigFormat
+		}
+		break
+	}
+	return YAMLConfigFormat
+}
+
+// DecodeConfig decodes a config document of the provided format.
+//
+// All formats are normalized into the same shape as a JSON document:
+// objects are map[string]interface{} values, arrays are []interface{}
+// values, and numbers are float64 values.
+func DecodeConfig(buf []byte, format ConfigFormat) (Config, error) {
+	v, err := decodeOrderedConfig(buf, format)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := unorderConfigValue(v).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf(
+			"error: invalid config document: root must be an object")
+	}
+	return Config(m), nil
+}
+
+// FormatConfig converts a config document from one format to another
+// while preserving the order of its keys. Comments are not preserved.
+func FormatConfig(buf []byte, from, to ConfigFormat) ([]byte, error) {
+	v, err := decodeOrderedConfig(buf, from)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.(*orderedMap); !ok {
+		return nil, fmt.Errorf(
+			"error: invalid config document: root must be an object")
+	}
+	switch to {
+	case JSONConfigFormat, JSONCConfigFormat:
+		w := &bytes.Buffer{}
+		if err := writeOrderedJSON(w, v, ""); err != nil {
+			return nil, err
+		}
+		w.WriteByte('\n')
+		return w.Bytes(), nil
+	case YAMLConfigFormat:
+		return yaml.Marshal(toYAMLValue(v))
+	case TOMLConfigFormat:
+		w := &bytes.Buffer{}
+		if err := writeOrderedTOML(w, v.(*orderedMap), nil); err != nil {
+			return nil, err
+		}
+		return w.Bytes(), nil
+	}
+	return nil, fmt.Errorf("error: invalid config format: %v", to)
+}
+
+// orderedMap is an object that remembers the order of its keys and,
+// when decoded from JSON, the line numbers of the object and its keys.
+type orderedMap struct {
+	keys  []string
+	vals  map[string]interface{}
+	line  int
+	lines map[string]int
+}
+
+func newOrderedMap() *orderedMap {
+	return &orderedMap{vals: map[string]interface{}{}}
+}
+
+func (m *orderedMap) set(k string, v interface{}) {
+	if _, ok := m.vals[k]; !ok {
+		m.keys = append(m.keys, k)
+	}
+	m.vals[k] = v
+}
+
+// decodeOrderedConfig decodes a config document into a tree of
+// orderedMap, []interface{}, and scalar values.
+func decodeOrderedConfig(buf []byte, format ConfigFormat) (interface{}, error) {
+	switch format {
+	case JSONConfigFormat:
+		return decodeOrderedJSON(buf)
+	case JSONCConfigFormat:
+		return decodeOrderedJSON(stripJSONC(buf))
+	case YAMLConfigFormat:
+		var ms yaml.MapSlice
+		if err := yaml.Unmarshal(buf, &ms); err != nil {
+			return nil, err
+		}
+		return fromYAMLValue(ms), nil
+	case TOMLConfigFormat:
+		var m map[string]interface{}
+		md, err := toml.Decode(string(buf), &m)
+		if err != nil {
+			return nil, err
+		}
+		order := map[string][]string{}
+		seen := map[string]bool{}
+		for _, k := range md.Keys() {
+			parent := strings.Join(k[:len(k)-1], "\x00")
+			if key := parent + "\x01" + k[len(k)-1]; !seen[key] {
+				seen[key] = true
+				order[parent] = append(order[parent], k[len(k)-1])
+			}
+		}
+		return fromTOMLValue(m, nil, order), nil
+	}
+	return nil, fmt.Errorf("error: invalid config format: %v", format)
+}
+
+func decodeOrderedJSON(buf []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	v, err := decodeOrderedJSONValue(dec, newLineIndex(buf))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("error: invalid JSON: trailing data")
+	}
+	return v, nil
+}
+
+func decodeOrderedJSONValue(
+	dec *json.Decoder, lines lineIndex) (interface{}, error) {
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch ttok := tok.(type) {
+	case json.Delim:
+		switch ttok {
+		case '{':
+			m := newOrderedMap()
+			m.line = lines.lineOf(dec.InputOffset())
+			m.lines = map[string]int{}
+			for dec.More() {
+				ktok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				k := ktok.(string)
+				m.lines[k] = lines.lineOf(dec.InputOffset())
+				v, err := decodeOrderedJSONValue(dec, lines)
+				if err != nil {
+					return nil, err
+				}
+				m.set(k, v)
+			}
+			_, err := dec.Token()
+			return m, err
+		case '[':
+			a := []interface{}{}
+			for dec.More() {
+				v, err := decodeOrderedJSONValue(dec, lines)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			}
+			_, err := dec.Token()
+			return a, err
+		}
+	case json.Number:
+		return ttok.Float64()
+	}
+	return tok, nil
+}
+
+// stripJSONC removes comments and trailing commas from a JSONC
+// document.
+func stripJSONC(buf []byte) []byte {
+	var (
+		w        = &bytes.Buffer{}
+		inString bool
+	)
+	for i := 0; i < len(buf); i++ {
+		c := buf[i]
+		if inString {
+			w.WriteByte(c)
+			if c == '\\' && i+1 < len(buf) {
+				i++
+				w.WriteByte(buf[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+			w.WriteByte(c)
+		case c == '/' && i+1 < len(buf) && buf[i+1] == '/':
+			for i < len(buf) && buf[i] != '\n' {
+				i++
+			}
+			w.WriteByte('\n')
+		case c == '/' && i+1 < len(buf) && buf[i+1] == '*':
+			i += 2
+			for i+1 < len(buf) && !(buf[i] == '*' && buf[i+1] == '/') {
+				if buf[i] == '\n' {
+					w.WriteByte('\n')
+				}
+				i++
+			}
+			i++
+		case c == ',':
+			// drop the comma if the next significant character closes
+			// an object or array
+			j := i + 1
+			for j < len(buf) {
+				if buf[j] == ' ' || buf[j] == '\t' ||
+					buf[j] == '\n' || buf[j] == '\r' {
+					j++
+					continue
+				}
+				if buf[j] == '/' && j+1 < len(buf) && buf[j+1] == '/' {
+					for j < len(buf) && buf[j] != '\n' {
+						j++
+					}
+					continue
+				}
+				if buf[j] == '/' && j+1 < len(buf) && buf[j+1] == '*' {
+					j += 2
+					for j+1 < len(buf) && !(buf[j] == '*' && buf[j+1] == '/') {
+						j++
+					}
+					j += 2
+					continue
+				}
+				break
+			}
+			if j < len(buf) && (buf[j] == '}' || buf[j] == ']') {
+				continue
+			}
+			w.WriteByte(c)
+		default:
+			w.WriteByte(c)
+		}
+	}
+	return w.Bytes()
+}
+
+func fromYAMLValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case yaml.MapSlice:
+		m := newOrderedMap()
+		for _, item := range tv {
+			m.set(toString(item.Key), fromYAMLValue(item.Value))
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := newOrderedMap()
+		keys := make([]string, 0, len(tv))
+		vals := map[string]interface{}{}
+		for k, v := range tv {
+			sk := toString(k)
+			keys = append(keys, sk)
+			vals[sk] = v
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			m.set(k, fromYAMLValue(vals[k]))
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(tv))
+		for i, v := range tv {
+			a[i] = fromYAMLValue(v)
+		}
+		return a
+	}
+	return normalizeConfigScalar(v)
+}
+
+func fromTOMLValue(
+	v interface{}, path []string, order map[string][]string) interface{} {
+
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		m := newOrderedMap()
+		parent := strings.Join(path, "\x00")
+		for _, k := range order[parent] {
+			if cv, ok := tv[k]; ok {
+				m.set(k, fromTOMLValue(cv, append(path, k), order))
+			}
+		}
+		var rest []string
+		for k := range tv {
+			if _, ok := m.vals[k]; !ok {
+				rest = append(rest, k)
+			}
+		}
+		sort.Strings(rest)
+		for _, k := range rest {
+			m.set(k, fromTOMLValue(tv[k], append(path, k), order))
+		}
+		return m
+	case []map[string]interface{}:
+		a := make([]interface{}, len(tv))
+		for i, v := range tv {
+			a[i] = fromTOMLValue(v, path, order)
+		}
+		return a
+	case []interface{}:
+		a := make([]interface{}, len(tv))
+		for i, v := range tv {
+			a[i] = fromTOMLValue(v, path, order)
+		}
+		return a
+	}
+	return normalizeConfigScalar(v)
+}
+
+// normalizeConfigScalar converts the scalar values produced by the
+// YAML and TOML decoders into the types produced by the JSON decoder.
+func normalizeConfigScalar(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case int:
+		return float64(tv)
+	case int64:
+		return float64(tv)
+	case uint64:
+		return float64(tv)
+	case float32:
+		return float64(tv)
+	case time.Time:
+		return tv.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// lineIndex is the offsets of the newline characters in a document.
+type lineIndex []int64
+
+func newLineIndex(buf []byte) lineIndex {
+	var idx lineIndex
+	for i, c := range buf {
+		if c == '\n' {
+			idx = append(idx, int64(i))
+		}
+	}
+	return idx
+}
+
+// lineOf returns the 1-based line number of the byte at the offset.
+func (idx lineIndex) lineOf(offset int64) int {
+	return sort.Search(len(idx), func(i int) bool {
+		return idx[i] >= offset
+	}) + 1
+}
+
+// decodeConfigLayer decodes a config document like DecodeConfig and
+// returns it as a layer that also records the line numbers of the
+// document's values and the order of the document's keys. Line numbers
+// are only available for the JSON and JSONC formats.
+func decodeConfigLayer(buf []byte, format ConfigFormat) (*ConfigLayer, error) {
+	v, err := decodeOrderedConfig(buf, format)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		lines = map[string]int{}
+		order = map[string][]string{}
+	)
+	collectConfigLines(v, "", lines, order)
+	m, ok := unorderConfigValue(v).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf(
+			"error: invalid config document: root must be an object")
+	}
+	return &ConfigLayer{Config: Config(m), Lines: lines, order: order}, nil
+}
+
+// collectConfigLines records the line numbers of the values in v and
+// the keys of the objects in v in the order in which they appear, both
+// keyed by lower-case paths. Array elements are addressed by their
+// "name" field, the same way they are addressed by Get.
+func collectConfigLines(
+	v interface{}, path string,
+	lines map[string]int, order map[string][]string) {
+
+	switch tv := v.(type) {
+	case *orderedMap:
+		order[path] = tv.keys
+		for _, k := range tv.keys {
+			kpath := strings.ToLower(joinConfigPath(path, k))
+			if l, ok := tv.lines[k]; ok {
+				lines[kpath] = l
+			}
+			collectConfigLines(tv.vals[k], kpath, lines, order)
+		}
+	case []interface{}:
+		for i, e := range tv {
+			epath := fmt.Sprintf("%s[%d]", path, i)
+			if m, ok := e.(*orderedMap); ok {
+				if name, ok := m.vals["name"].(string); ok && name != "" {
+					epath = strings.ToLower(joinConfigPath(path, name))
+				}
+				if m.line > 0 {
+					lines[epath] = m.line
+				}
+			}
+			collectConfigLines(e, epath, lines, order)
+		}
+	}
+}
+
+// unorderConfigValue converts a tree of orderedMap values into a tree
+// of map[string]interface{} values.
+func unorderConfigValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case *orderedMap:
+		m := make(map[string]interface{}, len(tv.keys))
+		for _, k := range tv.keys {
+			m[k] = unorderConfigValue(tv.vals[k])
+		}
+		return m
+	case []interface{}:
+		for i := range tv {
+			tv[i] = unorderConfigValue(tv[i])
+		}
+		return tv
+	}
+	return v
+}
+
+func toYAMLValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case *orderedMap:
+		ms := make(yaml.MapSlice, len(tv.keys))
+		for i, k := range tv.keys {
+			ms[i] = yaml.MapItem{Key: k, Value: toYAMLValue(tv.vals[k])}
+		}
+		return ms
+	case []interface{}:
+		a := make([]interface{}, len(tv))
+		for i, v := range tv {
+			a[i] = toYAMLValue(v)
+		}
+		return a
+	case float64:
+		if tv == float64(int64(tv)) {
+			return int64(tv)
+		}
+	}
+	return v
+}
+
+func writeOrderedJSON(w *bytes.Buffer, v interface{}, indent string) error {
+	switch tv := v.(type) {
+	case *orderedMap:
+		if len(tv.keys) == 0 {
+			w.WriteString("{}")
+			return nil
+		}
+		w.WriteString("{\n")
+		for i, k := range tv.keys {
+			w.WriteString(indent + "  ")
+			if err := writeJSONScalar(w, k); err != nil {
+				return err
+			}
+			w.WriteString(": ")
+			if err := writeOrderedJSON(w, tv.vals[k], indent+"  "); err != nil {
+				return err
+			}
+			if i < len(tv.keys)-1 {
+				w.WriteByte(',')
+			}
+			w.WriteByte('\n')
+		}
+		w.WriteString(indent + "}")
+	case []interface{}:
+		if len(tv) == 0 {
+			w.WriteString("[]")
+			return nil
+		}
+		w.WriteString("[\n")
+		for i, e := range tv {
+			w.WriteString(indent + "  ")
+			if err := writeOrderedJSON(w, e, indent+"  "); err != nil {
+				return err
+			}
+			if i < len(tv)-1 {
+				w.WriteByte(',')
+			}
+			w.WriteByte('\n')
+		}
+		w.WriteString(indent + "]")
+	default:
+		return writeJSONScalar(w, v)
+	}
+	return nil
+}
+
+func writeJSONScalar(w *bytes.Buffer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	// remove the newline written by Encode
+	w.Truncate(w.Len() - 1)
+	return nil
+}
+
+var tomlBareKeyPatt = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(k string) string {
+	if tomlBareKeyPatt.MatchString(k) {
+		return k
+	}
+	return strconv.Quote(k)
+}
+
+func tomlTableName(path []string) string {
+	keys := make([]string, len(path))
+	for i, k := range path {
+		keys[i] = tomlKey(k)
+	}
+	return strings.Join(keys, ".")
+}
+
+// isTOMLTableArray returns a flag indicating whether the value is an
+// array of objects, which is written as an array of tables.
+func isTOMLTableArray(v interface{}) bool {
+	a, ok := v.([]interface{})
+	if !ok || len(a) == 0 {
+		return false
+	}
+	for _, e := range a {
+		if _, ok := e.(*orderedMap); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// writeOrderedTOML writes the key/value pairs of a table followed by
+// its sub-tables and arrays of tables. TOML requires the key/value
+// pairs to precede the sub-tables, so the order of keys is preserved
+// within each of those two groups.
+func writeOrderedTOML(w *bytes.Buffer, m *orderedMap, path []string) error {
+	var tables []string
+	for _, k := range m.keys {
+		v := m.vals[k]
+		if v == nil {
+			continue
+		}
+		if _, ok := v.(*orderedMap); ok || isTOMLTableArray(v) {
+			tables = append(tables, k)
+			continue
+		}
+		w.WriteString(tomlKey(k) + " = ")
+		if err := writeTOMLValue(w, v); err != nil {
+			return err
+		}
+		w.WriteByte('\n')
+	}
+	for _, k := range tables {
+		tpath := append(append([]string{}, path...), k)
+		switch tv := m.vals[k].(type) {
+		case *orderedMap:
+			// a table that only contains sub-tables is defined
+			// implicitly by the headers of its sub-tables
+			if hasTOMLKeyValues(tv) {
+				if w.Len() > 0 {
+					w.WriteByte('\n')
+				}
+				fmt.Fprintf(w, "[%s]\n", tomlTableName(tpath))
+			}
+			if err := writeOrderedTOML(w, tv, tpath); err != nil {
+				return err
+			}
+		case []interface{}:
+			for _, e := range tv {
+				if w.Len() > 0 {
+					w.WriteByte('\n')
+				}
+				fmt.Fprintf(w, "[[%s]]\n", tomlTableName(tpath))
+				if err := writeOrderedTOML(
+					w, e.(*orderedMap), tpath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasTOMLKeyValues returns a flag indicating whether a table has any
+// key/value pairs or is empty.
+func hasTOMLKeyValues(m *orderedMap) bool {
+	for _, k := range m.keys {
+		v := m.vals[k]
+		if _, ok := v.(*orderedMap); !ok && !isTOMLTableArray(v) {
+			return true
+		}
+	}
+	return len(m.keys) == 0
+}
+
+func writeTOMLValue(w *bytes.Buffer, v interface{}) error {
+	switch tv := v.(type) {
+	case *orderedMap:
+		w.WriteString("{")
+		for i, k := range tv.keys {
+			if tv.vals[k] == nil {
+				continue
+			}
+			if i > 0 {
+				w.WriteString(",")
+			}
+			w.WriteString(" " + tomlKey(k) + " = ")
+			if err := writeTOMLValue(w, tv.vals[k]); err != nil {
+				return err
+			}
+		}
+		w.WriteString(" }")
+	case []interface{}:
+		w.WriteString("[")
+		for i, e := range tv {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			if err := writeTOMLValue(w, e); err != nil {
+				return err
+			}
+		}
+		w.WriteString("]")
+	case float64:
+		if tv == float64(int64(tv)) {
+			w.WriteString(strconv.FormatInt(int64(tv), 10))
+		} else {
+			w.WriteString(strconv.FormatFloat(tv, 'f', -1, 64))
+		}
+	case string, bool:
+		return writeJSONScalar(w, tv)
+	case nil:
+		return fmt.Errorf("error: toml: unsupported null value")
+	default:
+		return fmt.Errorf("error: toml: unsupported value: %T", v)
+	}
+	return nil
+}
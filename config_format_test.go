@@ -0,0 +1,151 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config formats", func() {
+
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	assertExampleConfig := func(config lsx.Config) {
+		buf, err := json.Marshal(config)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(buf).Should(MatchJSON(exampleConfigJSON))
+		Ω(config.Get(ctx, "servers.svr01.addrs")).Should(
+			BeAssignableToTypeOf(typeOfArrInterface))
+		Ω(config.Scope(ctx, "services.svc00").Get(
+			ctx, "logging.level")).Should(Equal("info"))
+	}
+
+	It("should detect formats by extension", func() {
+		Ω(lsx.DetectConfigFormat("a.yml", nil)).Should(
+			Equal(lsx.YAMLConfigFormat))
+		Ω(lsx.DetectConfigFormat("a.toml", nil)).Should(
+			Equal(lsx.TOMLConfigFormat))
+		Ω(lsx.DetectConfigFormat("a.jsonc", nil)).Should(
+			Equal(lsx.JSONCConfigFormat))
+		Ω(lsx.DetectConfigFormat("a.json", exampleConfigJSON)).Should(
+			Equal(lsx.JSONConfigFormat))
+	})
+	It("should detect formats by content", func() {
+		Ω(lsx.DetectConfigFormat("", exampleConfigJSON)).Should(
+			Equal(lsx.JSONConfigFormat))
+		Ω(lsx.DetectConfigFormat("", []byte(exampleJSONC))).Should(
+			Equal(lsx.JSONCConfigFormat))
+		Ω(lsx.DetectConfigFormat("", []byte(exampleYAML))).Should(
+			Equal(lsx.YAMLConfigFormat))
+		Ω(lsx.DetectConfigFormat("", []byte(exampleTOML))).Should(
+			Equal(lsx.TOMLConfigFormat))
+	})
+	It("should detect JSONC in a .json file", func() {
+		Ω(lsx.DetectConfigFormat("a.json", []byte(exampleJSONC))).Should(
+			Equal(lsx.JSONCConfigFormat))
+	})
+
+	It("should parse JSONC", func() {
+		config, err := lsx.ParseConfig([]byte(exampleJSONC))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("debug"))
+		Ω(config.Get(ctx, "logging.url")).Should(Equal("http://a//b/*c*/"))
+		Ω(config.Get(ctx, "servers")).Should(HaveLen(1))
+	})
+	It("should parse YAML", func() {
+		config, err := lsx.ParseConfig([]byte(exampleYAML))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("debug"))
+		Ω(config.Get(ctx, "logging.port")).Should(Equal(float64(7979)))
+		Ω(config.Get(ctx, "servers.svr00.addrs")).Should(
+			BeAssignableToTypeOf(typeOfArrInterface))
+		Ω(config.Get(ctx, "servers.svr00")).Should(
+			BeAssignableToTypeOf(map[string]interface{}{}))
+	})
+	It("should parse TOML", func() {
+		config, err := lsx.ParseConfig([]byte(exampleTOML))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("debug"))
+		Ω(config.Get(ctx, "logging.port")).Should(Equal(float64(7979)))
+		Ω(config.Get(ctx, "servers")).Should(
+			BeAssignableToTypeOf(typeOfArrInterface))
+		Ω(config.Get(ctx, "servers.svr00")).Should(
+			BeAssignableToTypeOf(map[string]interface{}{}))
+	})
+
+	for _, f := range []lsx.ConfigFormat{
+		lsx.JSONConfigFormat,
+		lsx.YAMLConfigFormat,
+		lsx.TOMLConfigFormat,
+	} {
+		f := f
+		It("should round trip the example config through "+f.String(),
+			func() {
+				buf, err := lsx.FormatConfig(
+					exampleConfigJSON, lsx.JSONConfigFormat, f)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(lsx.DetectConfigFormat("", buf)).Should(Equal(f))
+				config, err := lsx.DecodeConfig(buf, f)
+				Ω(err).ShouldNot(HaveOccurred())
+				assertExampleConfig(config)
+			})
+	}
+
+	It("should preserve key order", func() {
+		buf, err := lsx.FormatConfig(
+			[]byte(`{"z":1,"a":{"y":true,"b":"x"}}`),
+			lsx.JSONConfigFormat, lsx.YAMLConfigFormat)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(Equal("z: 1\na:\n  \"y\": true\n  b: x\n"))
+		buf, err = lsx.FormatConfig(
+			buf, lsx.YAMLConfigFormat, lsx.TOMLConfigFormat)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(Equal("z = 1\n\n[a]\ny = true\nb = \"x\"\n"))
+		buf, err = lsx.FormatConfig(
+			buf, lsx.TOMLConfigFormat, lsx.JSONConfigFormat)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(Equal(
+			"{\n  \"z\": 1,\n  \"a\": {\n    \"y\": true,\n" +
+				"    \"b\": \"x\"\n  }\n}\n"))
+	})
+})
+
+const (
+	exampleJSONC = `// the example config
+{
+	"logging": {
+		"level": "debug", // the log level
+		"url": "http://a//b/*c*/",
+		/* a block
+		   comment */
+	},
+	"servers": [
+		{"name": "svr00"},
+	],
+}`
+
+	exampleYAML = `# the example config
+logging:
+  level: debug
+  port: 7979
+servers:
+- name: svr00
+  addrs:
+  - tcp://127.0.0.1:7979
+`
+
+	exampleTOML = `# the example config
+[logging]
+level = "debug"
+port = 7979
+
+[[servers]]
+name = "svr00"
+addrs = ["tcp://127.0.0.1:7979"]
+`
+)
@@ -0,0 +1,500 @@
+package lsx
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigTypeError is returned by the typed Config getters when the
+// value at a path cannot be converted to the requested type.
+type ConfigTypeError struct {
+	// Path is the full path of the value, including the path of the
+	// scope from which the value was requested.
+	Path string
+
+	// Type is the name of the requested type.
+	Type string
+
+	// Value is the value found at the path. A secret value is a Secret
+	// so that the error message does not reveal it.
+	Value interface{}
+}
+
+// Error returns the error message.
+func (e *ConfigTypeError) Error() string {
+	return fmt.Sprintf(
+		"error: invalid config value: path=%s, expected=%s, actual=%T(%v)",
+		e.Path, e.Type, e.Value, e.Value)
+}
+
+// typeError returns a ConfigTypeError for the value at the provided
+// path. A string value that is a secret is kept as a Secret.
+func (c Config) typeError(
+	ctx context.Context, path, typ string, v interface{}) *ConfigTypeError {
+
+	full := c.FullPath(ctx, path)
+	if s, ok := v.(string); ok {
+		if _, secret := c.get(ctx, path, true).(Secret); secret ||
+			c.secretPaths(ctx)[strings.ToLower(full)] {
+			v = Secret(s)
+		}
+	}
+	return &ConfigTypeError{full, typ, v}
+}
+
+// ConfigNotFoundError is returned by the typed Config getters when
+// there is no value at a path.
+type ConfigNotFoundError struct {
+	// Path is the full path of the value, including the path of the
+	// scope from which the value was requested.
+	Path string
+}
+
+// Error returns the error message.
+func (e *ConfigNotFoundError) Error() string {
+	return fmt.Sprintf("error: missing config value: path=%s", e.Path)
+}
+
+// FullPath returns the provided path prefixed with the path of the
+// Config instance's scope. If the Config instance is not scoped the
+// path is returned as-is.
+func (c Config) FullPath(ctx context.Context, path string) string {
+	scope, ok := c[configScopeKey].(string)
+	if !ok || scope == "" {
+		return path
+	}
+	if parent := c.Parent(ctx); parent != nil {
+		scope = parent.FullPath(ctx, scope)
+	}
+	if path == "" {
+		return scope
+	}
+	return scope + "." + path
+}
+
+// GetStrE returns a string value from the config map or an error if the
+// value is missing.
+func (c Config) GetStrE(ctx context.Context, path string) (string, error) {
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return toString(v), nil
+}
+
+// GetInt returns an int value from the config map. A zero value is
+// returned if the value is missing or cannot be converted to an int.
+func (c Config) GetInt(ctx context.Context, path string) int {
+	v, _ := c.GetIntE(ctx, path)
+	return v
+}
+
+// GetIntE returns an int value from the config map or an error if the
+// value is missing or cannot be converted to an int.
+func (c Config) GetIntE(ctx context.Context, path string) (int, error) {
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	i, ok := toInt64(v)
+	if !ok || int64(int(i)) != i {
+		return 0, c.typeError(ctx, path, "int", v)
+	}
+	return int(i), nil
+}
+
+// GetInt64 returns an int64 value from the config map. A zero value is
+// returned if the value is missing or cannot be converted to an int64.
+func (c Config) GetInt64(ctx context.Context, path string) int64 {
+	v, _ := c.GetInt64E(ctx, path)
+	return v
+}
+
+// GetInt64E returns an int64 value from the config map or an error if
+// the value is missing or cannot be converted to an int64.
+func (c Config) GetInt64E(ctx context.Context, path string) (int64, error) {
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	i, ok := toInt64(v)
+	if !ok {
+		return 0, c.typeError(ctx, path, "int64", v)
+	}
+	return i, nil
+}
+
+// GetBool returns a bool value from the config map. False is returned
+// if the value is missing or cannot be converted to a bool.
+func (c Config) GetBool(ctx context.Context, path string) bool {
+	v, _ := c.GetBoolE(ctx, path)
+	return v
+}
+
+// GetBoolE returns a bool value from the config map or an error if the
+// value is missing or cannot be converted to a bool.
+func (c Config) GetBoolE(ctx context.Context, path string) (bool, error) {
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	b, ok := toBool(v)
+	if !ok {
+		return false, c.typeError(ctx, path, "bool", v)
+	}
+	return b, nil
+}
+
+// GetFloat returns a float64 value from the config map. A zero value is
+// returned if the value is missing or cannot be converted to a float64.
+func (c Config) GetFloat(ctx context.Context, path string) float64 {
+	v, _ := c.GetFloatE(ctx, path)
+	return v
+}
+
+// GetFloatE returns a float64 value from the config map or an error if
+// the value is missing or cannot be converted to a float64.
+func (c Config) GetFloatE(ctx context.Context, path string) (float64, error) {
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := toFloat64(v)
+	if !ok {
+		return 0, c.typeError(ctx, path, "float64", v)
+	}
+	return f, nil
+}
+
+// GetDuration returns a time.Duration value from the config map. A zero
+// value is returned if the value is missing or cannot be converted to a
+// time.Duration.
+//
+// String values are parsed with time.ParseDuration. Numeric values are
+// treated as a number of seconds.
+func (c Config) GetDuration(ctx context.Context, path string) time.Duration {
+	v, _ := c.GetDurationE(ctx, path)
+	return v
+}
+
+// GetDurationE returns a time.Duration value from the config map or an
+// error if the value is missing or cannot be converted to a
+// time.Duration.
+func (c Config) GetDurationE(
+	ctx context.Context, path string) (time.Duration, error) {
+
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	d, ok := toDuration(v)
+	if !ok {
+		return 0, c.typeError(ctx, path, "duration", v)
+	}
+	return d, nil
+}
+
+// GetStringSlice returns a []string value from the config map. A nil
+// value is returned if the value is missing or cannot be converted to
+// a []string.
+//
+// A string value is treated as a JSON array if it begins with a '['
+// character; otherwise it is split on commas.
+func (c Config) GetStringSlice(ctx context.Context, path string) []string {
+	v, _ := c.GetStringSliceE(ctx, path)
+	return v
+}
+
+// GetStringSliceE returns a []string value from the config map or an
+// error if the value is missing or cannot be converted to a []string.
+func (c Config) GetStringSliceE(
+	ctx context.Context, path string) ([]string, error) {
+
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := toStringSlice(v)
+	if !ok {
+		return nil, c.typeError(ctx, path, "[]string", v)
+	}
+	return s, nil
+}
+
+// GetStringMap returns a map[string]interface{} value from the config
+// map. A nil value is returned if the value is missing or cannot be
+// converted to a map[string]interface{}.
+//
+// A string value is treated as a JSON object.
+func (c Config) GetStringMap(
+	ctx context.Context, path string) map[string]interface{} {
+
+	v, _ := c.GetStringMapE(ctx, path)
+	return v
+}
+
+// GetStringMapE returns a map[string]interface{} value from the config
+// map or an error if the value is missing or cannot be converted to a
+// map[string]interface{}.
+func (c Config) GetStringMapE(
+	ctx context.Context, path string) (map[string]interface{}, error) {
+
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := toStringMap(v)
+	if !ok {
+		return nil, c.typeError(
+			ctx, path, "map[string]interface{}", v)
+	}
+	return m, nil
+}
+
+// GetConfig returns the value at the provided path as a scoped Config.
+// A nil value is returned if the value is missing or is not a map.
+//
+// Unlike Scope, a value that is only defined by an ancestor Config is
+// also returned, scoped to this Config instance.
+func (c Config) GetConfig(ctx context.Context, path string) Config {
+	v, _ := c.GetConfigE(ctx, path)
+	return v
+}
+
+// GetConfigE returns the value at the provided path as a scoped Config
+// or an error if the value is missing or is not a map.
+func (c Config) GetConfigE(ctx context.Context, path string) (Config, error) {
+	if config := c.Scope(ctx, path); config != nil {
+		return config, nil
+	}
+	v, err := c.GetE(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := toStringMap(v)
+	if !ok {
+		return nil, c.typeError(ctx, path, "Config", v)
+	}
+	config := Config{}
+	for k, v := range m {
+		config[k] = v
+	}
+	config[configParentKey] = c
+	config[configScopeKey] = path
+	return config, nil
+}
+
+// toText returns the text form of a value that is a string or that
+// implements encoding.TextMarshaler.
+func toText(v interface{}) (string, bool) {
+	switch tv := v.(type) {
+	case string:
+		return tv, true
+	case Secret:
+		return string(tv), true
+	case *string:
+		if tv != nil {
+			return *tv, true
+		}
+	case encoding.TextMarshaler:
+		buf, err := tv.MarshalText()
+		if err != nil {
+			return "", false
+		}
+		return string(buf), true
+	}
+	return "", false
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	if s, ok := toText(v); ok {
+		s = strings.TrimSpace(s)
+		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return floatToInt64(f)
+		}
+		return 0, false
+	}
+	vv := derefValue(reflect.ValueOf(v))
+	switch vv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		return vv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := vv.Uint(); u <= math.MaxInt64 {
+			return int64(u), true
+		}
+	case reflect.Float32, reflect.Float64:
+		return floatToInt64(vv.Float())
+	}
+	return 0, false
+}
+
+func floatToInt64(f float64) (int64, bool) {
+	if math.Mod(f, 1) != 0 || f < math.MinInt64 || f > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	if s, ok := toText(v); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	}
+	vv := derefValue(reflect.ValueOf(v))
+	switch vv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		return float64(vv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(vv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return vv.Float(), true
+	}
+	return 0, false
+}
+
+func toBool(v interface{}) (bool, bool) {
+	if s, ok := toText(v); ok {
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		return b, err == nil
+	}
+	vv := derefValue(reflect.ValueOf(v))
+	if vv.Kind() == reflect.Bool {
+		return vv.Bool(), true
+	}
+	if i, ok := toInt64(v); ok && (i == 0 || i == 1) {
+		return i == 1, true
+	}
+	return false, false
+}
+
+func toDuration(v interface{}) (time.Duration, bool) {
+	switch tv := v.(type) {
+	case time.Duration:
+		return tv, true
+	case *time.Duration:
+		if tv != nil {
+			return *tv, true
+		}
+		return 0, false
+	}
+	if s, ok := toText(v); ok {
+		s = strings.TrimSpace(s)
+		if d, err := time.ParseDuration(s); err == nil {
+			return d, true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return time.Duration(f * float64(time.Second)), true
+		}
+		return 0, false
+	}
+	if f, ok := toFloat64(v); ok {
+		return time.Duration(f * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+func toStringSlice(v interface{}) ([]string, bool) {
+	switch tv := v.(type) {
+	case []string:
+		return tv, true
+	case []interface{}:
+		s := make([]string, len(tv))
+		for i, e := range tv {
+			es, ok := toScalarString(e)
+			if !ok {
+				return nil, false
+			}
+			s[i] = es
+		}
+		return s, true
+	}
+	if s, ok := toText(v); ok {
+		s = strings.TrimSpace(s)
+		if strings.HasPrefix(s, "[") {
+			var a []interface{}
+			if err := json.Unmarshal([]byte(s), &a); err != nil {
+				return nil, false
+			}
+			return toStringSlice(a)
+		}
+		if s == "" {
+			return []string{}, true
+		}
+		a := strings.Split(s, ",")
+		for i := range a {
+			a[i] = strings.TrimSpace(a[i])
+		}
+		return a, true
+	}
+	vv := derefValue(reflect.ValueOf(v))
+	if vv.Kind() != reflect.Array && vv.Kind() != reflect.Slice {
+		return nil, false
+	}
+	s := make([]string, vv.Len())
+	for i := range s {
+		es, ok := toScalarString(vv.Index(i).Interface())
+		if !ok {
+			return nil, false
+		}
+		s[i] = es
+	}
+	return s, true
+}
+
+// toScalarString returns the string representation of a value that is
+// a string, a bool, or a number.
+func toScalarString(v interface{}) (string, bool) {
+	if s, ok := toText(v); ok {
+		return s, true
+	}
+	vv := derefValue(reflect.ValueOf(v))
+	if k := vv.Kind(); k >= reflect.Bool && k <= reflect.Float64 {
+		return toString(vv.Interface()), true
+	}
+	return "", false
+}
+
+func toStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch tv := v.(type) {
+	case Config:
+		m := map[string]interface{}{}
+		for k, v := range tv {
+			if !isConfigMetaKey(k) {
+				m[k] = v
+			}
+		}
+		return m, true
+	case map[string]interface{}:
+		return tv, true
+	}
+	if s, ok := toText(v); ok {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			return nil, false
+		}
+		return m, true
+	}
+	vv := derefValue(reflect.ValueOf(v))
+	if vv.Kind() != reflect.Map {
+		return nil, false
+	}
+	m := map[string]interface{}{}
+	for _, k := range vv.MapKeys() {
+		m[toString(derefValue(k).Interface())] = vv.MapIndex(k).Interface()
+	}
+	return m, true
+}
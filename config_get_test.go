@@ -0,0 +1,163 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config typed getters", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal(
+			exampleConfigJSON,
+			&config)).ShouldNot(HaveOccurred())
+		config["timeouts"] = map[string]interface{}{
+			"read":   "5s",
+			"write":  30,
+			"port":   float64(7979),
+			"ratio":  0.5,
+			"bogus":  true,
+			"custom": time.Minute,
+		}
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("GetBool", func() {
+		v, err := config.GetBoolE(ctx, "logging.requests")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(v).Should(BeTrue())
+	})
+	It("GetStr of a bool", func() {
+		Ω(config.GetStr(ctx, "logging.requests")).Should(Equal("true"))
+	})
+	It("GetStr of a float", func() {
+		Ω(config.GetStr(ctx, "timeouts.ratio")).Should(Equal("0.5"))
+	})
+	It("GetInt of a JSON number", func() {
+		v, err := config.GetIntE(ctx, "timeouts.port")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(v).Should(Equal(7979))
+	})
+	It("GetInt of a fraction", func() {
+		_, err := config.GetIntE(ctx, "timeouts.ratio")
+		Ω(err).Should(HaveOccurred())
+		Ω(err).Should(BeAssignableToTypeOf(&lsx.ConfigTypeError{}))
+	})
+	It("GetInt64", func() {
+		Ω(config.GetInt64(ctx, "timeouts.write")).Should(Equal(int64(30)))
+	})
+	It("GetFloat", func() {
+		Ω(config.GetFloat(ctx, "timeouts.ratio")).Should(Equal(0.5))
+	})
+	It("GetDuration of a string", func() {
+		Ω(config.GetDuration(ctx, "timeouts.read")).Should(
+			Equal(5 * time.Second))
+	})
+	It("GetDuration of a number", func() {
+		Ω(config.GetDuration(ctx, "timeouts.write")).Should(
+			Equal(30 * time.Second))
+	})
+	It("GetDuration of a time.Duration", func() {
+		Ω(config.GetDuration(ctx, "timeouts.custom")).Should(
+			Equal(time.Minute))
+	})
+	It("GetDuration of a bool", func() {
+		_, err := config.GetDurationE(ctx, "timeouts.bogus")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal(
+			"error: invalid config value: path=timeouts.bogus, " +
+				"expected=duration, actual=bool(true)"))
+	})
+	It("GetStringMap", func() {
+		v, err := config.GetStringMapE(ctx, "logging")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(v).Should(HaveKeyWithValue("level", "debug"))
+	})
+	It("GetConfig", func() {
+		v, err := config.GetConfigE(ctx, "services.svc00")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(v.Len()).Should(Equal(4))
+		Ω(v.GetStr(ctx, "api.volume.mount.type")).Should(
+			Equal("libstorage"))
+	})
+	It("GetConfig of a string", func() {
+		_, err := config.GetConfigE(ctx, "logging.level")
+		Ω(err).Should(BeAssignableToTypeOf(&lsx.ConfigTypeError{}))
+	})
+	It("missing value", func() {
+		_, err := config.GetBoolE(ctx, "logging.missing")
+		Ω(err).Should(BeAssignableToTypeOf(&lsx.ConfigNotFoundError{}))
+		Ω(err.Error()).Should(Equal(
+			"error: missing config value: path=logging.missing"))
+	})
+
+	Context("scoped to server svr01", func() {
+		BeforeEach(func() {
+			config = config.Scope(ctx, "servers.svr01")
+		})
+		It("GetStringSlice", func() {
+			v, err := config.GetStringSliceE(ctx, "addrs")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal([]string{
+				"tcp://127.0.0.1:8989",
+				"unix:///tmp/lsx/run/csi.sock",
+			}))
+		})
+		It("reports the full path", func() {
+			_, err := config.GetIntE(ctx, "addrs")
+			Ω(err).Should(HaveOccurred())
+			Ω(err.(*lsx.ConfigTypeError).Path).Should(
+				Equal("servers.svr01.addrs"))
+		})
+	})
+
+	Context("with environment overrides", func() {
+		BeforeEach(func() {
+			os.Setenv("LSX_LOGGING_REQUESTS", "false")
+			os.Setenv("LSX_TIMEOUTS_PORT", "8080")
+			os.Setenv("LSX_TIMEOUTS_READ", "1m")
+			os.Setenv("LSX_TIMEOUTS_LIST", `["a","b"]`)
+			os.Setenv("LSX_TIMEOUTS_CSV", "a, b")
+		})
+		AfterEach(func() {
+			os.Setenv("LSX_LOGGING_REQUESTS", "")
+			os.Setenv("LSX_TIMEOUTS_PORT", "")
+			os.Setenv("LSX_TIMEOUTS_READ", "")
+			os.Setenv("LSX_TIMEOUTS_LIST", "")
+			os.Setenv("LSX_TIMEOUTS_CSV", "")
+		})
+		It("GetBool", func() {
+			v, err := config.GetBoolE(ctx, "logging.requests")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(BeFalse())
+		})
+		It("GetInt", func() {
+			Ω(config.GetInt(ctx, "timeouts.port")).Should(Equal(8080))
+		})
+		It("GetDuration", func() {
+			Ω(config.GetDuration(ctx, "timeouts.read")).Should(
+				Equal(time.Minute))
+		})
+		It("GetStringSlice of a JSON array", func() {
+			Ω(config.GetStringSlice(ctx, "timeouts.list")).Should(
+				Equal([]string{"a", "b"}))
+		})
+		It("GetStringSlice of a CSV", func() {
+			Ω(config.GetStringSlice(ctx, "timeouts.csv")).Should(
+				Equal([]string{"a", "b"}))
+		})
+	})
+})
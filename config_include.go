@@ -0,0 +1,303 @@
+package lsx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// configIncludeKey is the key of the top-level include directive.
+const configIncludeKey = "include"
+
+// configIncludeDir returns the path of the implicit conf.d directory of
+// a config file, which is the path of the file without its extension
+// and with the suffix ".d", ex. /etc/lsx/config.d for the config file
+// /etc/lsx/config.json.
+func configIncludeDir(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".d"
+}
+
+// loadConfigFileTree loads a config file and the fragments it includes,
+// in the order in which they are merged:
+//
+//	the config file itself
+//
+//	the files that match the patterns in the config file's top-level
+//	"include" array, in the order the patterns are listed and in
+//	lexical order for each pattern. A relative pattern is relative to
+//	the directory of the including file
+//
+//	the config files in the config file's implicit conf.d directory,
+//	in lexical order; please see configIncludeDir
+//
+// Fragments may include other fragments, in which case they are loaded
+// the same way, depth-first. A file that is included more than once is
+// only loaded the first time. An error is returned if a file includes
+// itself, directly or indirectly, or if two fragments define the same
+// value of an array element with the same name differently.
+func loadConfigFileTree(f string, kind ConfigLayerKind) (ConfigLayers, error) {
+	l := &configIncluder{loaded: map[string]bool{}}
+	if abs, err := filepath.Abs(f); err == nil && FileExists(f) {
+		l.loaded[abs] = true
+	}
+	layers, err := l.load(f, kind, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConfigFragments(layers[1:]); err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+// configIncluder loads config files and the fragments they include.
+type configIncluder struct {
+	// loaded are the absolute paths of the files that are loaded.
+	loaded map[string]bool
+}
+
+// configFragment is a file included by a config file.
+type configFragment struct {
+	path string
+	kind ConfigLayerKind
+}
+
+// load loads the config file f and the fragments it includes. The stack
+// contains the absolute paths of the files that include f.
+func (l *configIncluder) load(
+	f string, kind ConfigLayerKind, stack []string) (ConfigLayers, error) {
+
+	layer, err := loadConfigFile(f)
+	if err != nil {
+		return nil, err
+	}
+	layer.Kind = kind
+
+	patterns, err := takeConfigIncludes(layer)
+	if err != nil {
+		return nil, err
+	}
+
+	// the includes of an inline config document are relative to the
+	// working directory, and an inline document has no conf.d directory
+	dir := "."
+	if layer.Source != "" {
+		dir = filepath.Dir(f)
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack[:len(stack):len(stack)], abs)
+	}
+
+	var frags []configFragment
+	for _, p := range patterns {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"error: invalid config include: %s: %v", layerSource(layer), err)
+		}
+		if len(matches) == 0 && !hasGlobMeta(p) {
+			return nil, fmt.Errorf(
+				"error: missing config include: %s: %s", layerSource(layer), p)
+		}
+		for _, m := range matches {
+			frags = append(frags, configFragment{m, FileConfigLayer})
+		}
+	}
+	if layer.Source != "" {
+		if infos, err := ioutil.ReadDir(configIncludeDir(f)); err == nil {
+			for _, fi := range infos {
+				if fi.IsDir() || !isConfigFile(fi.Name()) {
+					continue
+				}
+				frags = append(frags, configFragment{
+					filepath.Join(configIncludeDir(f), fi.Name()),
+					DirConfigLayer,
+				})
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error: read config dir failed: %v", err)
+		}
+	}
+
+	layers := ConfigLayers{layer}
+	for _, frag := range frags {
+		if fi, err := os.Stat(frag.path); err == nil && fi.IsDir() {
+			continue
+		}
+		abs, err := filepath.Abs(frag.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range stack {
+			if s == abs {
+				return nil, fmt.Errorf(
+					"error: config include cycle: %s includes %s", f, frag.path)
+			}
+		}
+		if l.loaded[abs] {
+			continue
+		}
+		l.loaded[abs] = true
+		fragLayers, err := l.load(frag.path, frag.kind, stack)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, fragLayers...)
+	}
+	return layers, nil
+}
+
+// takeConfigIncludes removes the include directive from the layer's
+// config and returns its patterns.
+func takeConfigIncludes(layer *ConfigLayer) ([]string, error) {
+	v, ok := layer.Config[configIncludeKey]
+	if !ok {
+		return nil, nil
+	}
+	delete(layer.Config, configIncludeKey)
+	switch tv := v.(type) {
+	case string:
+		return []string{tv}, nil
+	case []interface{}:
+		patterns := make([]string, len(tv))
+		for i, e := range tv {
+			s, ok := e.(string)
+			if !ok || s == "" {
+				return nil, fmt.Errorf(
+					"error: invalid config include: %s: expected string, actual %v",
+					layerSource(layer), e)
+			}
+			patterns[i] = s
+		}
+		return patterns, nil
+	}
+	return nil, fmt.Errorf(
+		"error: invalid config include: %s: expected array, actual %T",
+		layerSource(layer), v)
+}
+
+// layerSource returns the source of the layer or "inline" if the layer
+// was loaded from an inline config document.
+func layerSource(layer *ConfigLayer) string {
+	if layer.Source == "" {
+		return "inline"
+	}
+	return layer.Source
+}
+
+// hasGlobMeta returns a flag indicating whether the pattern contains
+// any of the special characters recognized by filepath.Match.
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, `*?[\`)
+}
+
+// configFragmentElement is an array element with a name defined by a
+// config fragment.
+type configFragmentElement struct {
+	source string
+	value  map[string]interface{}
+}
+
+// checkConfigFragments returns an error if two of the layers define an
+// array element with the same name, ex. servers.svr00, and set the
+// same value of the element differently.
+func checkConfigFragments(layers ConfigLayers) error {
+	var (
+		err  error
+		seen = map[string][]configFragmentElement{}
+	)
+	for _, layer := range layers {
+		walkNamedElements(layer.Config, "", func(
+			path string, el map[string]interface{}) {
+
+			if err != nil {
+				return
+			}
+			key := strings.ToLower(path)
+			for _, prev := range seen[key] {
+				if prev.source == layer.Source {
+					continue
+				}
+				if p, ok := conflictingConfigValue(prev.value, el, path); ok {
+					err = fmt.Errorf(
+						"error: conflicting config fragments: path=%s: %s and %s",
+						p, prev.source, layer.Source)
+					return
+				}
+			}
+			seen[key] = append(seen[key], configFragmentElement{layer.Source, el})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkNamedElements invokes f with the path of every array element in
+// v that has a name.
+func walkNamedElements(
+	v interface{}, path string, f func(string, map[string]interface{})) {
+
+	switch tv := v.(type) {
+	case Config:
+		walkNamedElements(map[string]interface{}(tv), path, f)
+	case map[string]interface{}:
+		for _, k := range sortedKeys(tv) {
+			if !isConfigMetaKey(k) {
+				walkNamedElements(tv[k], joinConfigPath(path, k), f)
+			}
+		}
+	case []interface{}:
+		if !isNamedArray(tv) {
+			return
+		}
+		for i, e := range tv {
+			epath := elementPath(path, i, e)
+			f(epath, e.(map[string]interface{}))
+			walkNamedElements(e, epath, f)
+		}
+	}
+}
+
+// conflictingConfigValue returns the path of the first value that a and
+// b both define but define differently. The elements of named arrays
+// are compared by walkNamedElements and are not compared here.
+func conflictingConfigValue(a, b interface{}, path string) (string, bool) {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		bv := reflect.ValueOf(bm)
+		for _, k := range sortedKeys(am) {
+			bk, ok := findMapKey(bv, k)
+			if !ok {
+				continue
+			}
+
+			// names are matched case-insensitively
+			if strings.EqualFold(k, "name") &&
+				strings.EqualFold(toString(am[k]), toString(bm[bk.String()])) {
+				continue
+			}
+			if p, ok := conflictingConfigValue(
+				am[k], bm[bk.String()], joinConfigPath(path, k)); ok {
+				return p, true
+			}
+		}
+		return "", false
+	}
+	aa, aok := a.([]interface{})
+	ba, bok := b.([]interface{})
+	if aok && bok && isNamedArray(aa) && isNamedArray(ba) {
+		return "", false
+	}
+	return path, !reflect.DeepEqual(a, b)
+}
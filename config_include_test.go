@@ -0,0 +1,137 @@
+package lsx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config includes", func() {
+
+	var (
+		ctx        context.Context
+		tmpDir     string
+		configFile string
+	)
+
+	write := func(name, data string) string {
+		f := filepath.Join(tmpDir, name)
+		Ω(os.MkdirAll(filepath.Dir(f), 0755)).Should(Succeed())
+		Ω(ioutil.WriteFile(f, []byte(data), 0644)).Should(Succeed())
+		return f
+	}
+	load := func() (lsx.Config, lsx.ConfigLayers, error) {
+		return (&lsx.ConfigLoader{Files: []string{configFile}}).Load(ctx)
+	}
+
+	BeforeEach(func() {
+		var err error
+		ctx = context.Background()
+		tmpDir, err = ioutil.TempDir("", "lsx-config-include")
+		Ω(err).ShouldNot(HaveOccurred())
+		configFile = write("config.json", string(exampleConfigJSON))
+	})
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("should merge the included files in lexical order", func() {
+		configFile = write("main.json", `{
+			"include": ["frags/*.json"],
+			"logging": {"level": "info"},
+			"services": [{"name": "svc00", "servers": ["svr00"]}]
+		}`)
+		write("frags/20-b.json", `{
+			"logging": {"level": "error"},
+			"services": [{"name": "svc01"}]
+		}`)
+		a := write("frags/10-a.json", `{
+			"logging": {"level": "warn", "format": "json"},
+			"services": [{"name": "svc00", "logging": {"level": "debug"}}]
+		}`)
+		config, layers, err := load()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(layers).Should(HaveLen(3))
+		Ω(layers[1].Source).Should(Equal(a))
+		Ω(config.Get(ctx, "include")).Should(BeNil())
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("error"))
+		Ω(config.Get(ctx, "logging.format")).Should(Equal("json"))
+		Ω(config.Get(ctx, "services")).Should(HaveLen(2))
+		Ω(config.Get(ctx, "services.svc00.servers")).Should(
+			Equal([]interface{}{"svr00"}))
+		Ω(config.Get(ctx, "services.svc00.logging.level")).Should(
+			Equal("debug"))
+		e := config.Explain(ctx, "logging.format")
+		Ω(e.Steps[len(e.Steps)-1].Origin.Source).Should(Equal(a))
+	})
+
+	It("should merge the implicit conf.d directory", func() {
+		write("config.d/10-svr02.json",
+			`{"servers": [{"name": "svr02", "type": "csi"}]}`)
+		write("config.d/20-svr00.json",
+			`{"servers": [{"name": "svr00", "addrs": ["tcp://:7980"]}]}`)
+		write("config.d/README.md", "not a config file")
+		config, layers, err := load()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(layers.ByKind(lsx.DirConfigLayer)).Should(HaveLen(2))
+		Ω(config.Get(ctx, "servers")).Should(HaveLen(3))
+		Ω(config.Get(ctx, "servers.svr02.type")).Should(Equal("csi"))
+		Ω(config.Get(ctx, "servers.svr00.type")).Should(Equal("libstorage"))
+		Ω(config.Get(ctx, "servers.svr00.addrs")).Should(
+			Equal([]interface{}{"tcp://:7980"}))
+	})
+
+	It("should merge duplicate names that do not conflict", func() {
+		write("config.d/10-a.json",
+			`{"servers": [{"name": "svr02", "type": "csi"}]}`)
+		write("config.d/20-b.json",
+			`{"servers": [{"name": "SVR02", "type": "csi", "addrs": []}]}`)
+		config, _, err := load()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Get(ctx, "servers")).Should(HaveLen(3))
+	})
+
+	It("should fail for conflicting duplicate names", func() {
+		a := write("config.d/10-a.json",
+			`{"servers": [{"name": "svr02", "type": "csi"}]}`)
+		b := write("config.d/20-b.json",
+			`{"servers": [{"name": "svr02", "type": "libstorage"}]}`)
+		_, _, err := load()
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("path=servers.svr02.type"))
+		Ω(err.Error()).Should(ContainSubstring(a))
+		Ω(err.Error()).Should(ContainSubstring(b))
+	})
+
+	It("should fail for include cycles", func() {
+		configFile = write("a.json", `{"include": ["b.json"]}`)
+		write("b.json", `{"include": ["c/*.json"]}`)
+		c := write("c/c.json", `{"include": ["../a.json"]}`)
+		_, _, err := load()
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal(
+			"error: config include cycle: " + c + " includes " + configFile))
+
+		configFile = write("a.json", `{"include": ["a.json"]}`)
+		_, _, err = load()
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(Equal(
+			"error: config include cycle: " + configFile + " includes " +
+				configFile))
+	})
+
+	It("should fail for a missing or invalid include", func() {
+		configFile = write("a.json", `{"include": ["missing.json"]}`)
+		_, _, err := load()
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("missing config include"))
+
+		configFile = write("a.json", `{"include": [1]}`)
+		_, _, err = load()
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("invalid config include"))
+	})
+})
@@ -0,0 +1,231 @@
+package lsx
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// configScope is the metadata stored in a Config instance returned by
+// Scope. The metadata is stored in the returned Config instance instead
+// of in the scoped map, so it does not modify the scoped map.
+type configScope struct {
+	// tokens is the parsed, absolute path of the scope.
+	tokens []configPathToken
+
+	// env is the name of the environment variable that overrides the
+	// scope, without a prefix.
+	env string
+
+	// indexed is a flag indicating whether the scope refers to a map in
+	// the root Config instance's index. A scope whose map was provided
+	// by an environment variable is not indexed.
+	indexed bool
+}
+
+// rootConfigScope is the scope of a root Config instance.
+var rootConfigScope = &configScope{indexed: true}
+
+// scopeInfo returns the scope metadata of the Config instance. The
+// metadata is derived from the Config instance's full path if it was
+// not stored by Scope.
+func (c Config) scopeInfo(ctx context.Context) *configScope {
+	if s, ok := c[configMetaKey].(*configScope); ok {
+		return s
+	}
+	if _, ok := c[configParentKey]; !ok {
+		return rootConfigScope
+	}
+	tokens, _ := parseConfigPath(c.FullPath(ctx, ""))
+	return &configScope{tokens: tokens, env: envVarBody(tokens)}
+}
+
+// newConfigScope returns the scope metadata of a Config instance that
+// is the scope at the provided path relative to the Config instance.
+func (c Config) newConfigScope(
+	ctx context.Context, p *ConfigPath, fromEnv bool) *configScope {
+
+	parent := c.scopeInfo(ctx)
+	s := &configScope{
+		tokens:  append(parent.tokens[:len(parent.tokens):len(parent.tokens)], p.tokens...),
+		indexed: parent.indexed && !fromEnv,
+	}
+	s.env = envVarBody(s.tokens)
+	return s
+}
+
+// configIndex is a case-folded index of a config tree. The index is
+// stored in the metadata of a root Config instance, which only the
+// configs returned by ConfigLayers.Merge have, so other configs are not
+// indexed. The index is built lazily, the first time the root Config
+// instance or one of its scopes is queried, and is discarded whenever the root
+// Config instance or one of its scopes is modified with Set or Delete.
+// Modifications made directly to the maps returned by Get are not
+// indexed, so a value the index does not have is confirmed by
+// reflection.
+type configIndex struct {
+	root *configIndexNode
+}
+
+// configIndexNode is a value in the index.
+type configIndexNode struct {
+	// value is the indexed value.
+	value interface{}
+
+	// keys are the children of a map keyed by their lower-case keys, or
+	// the elements of an array keyed by their lower-case names.
+	keys map[string]*configIndexNode
+
+	// exact are the children of a map keyed by their keys. The children
+	// are only indexed this way if any of the keys differ only in case.
+	exact map[string]*configIndexNode
+
+	// elems are the elements of an array.
+	elems []*configIndexNode
+
+	// opaque is a flag indicating whether the value's children are not
+	// indexed, such as the fields of a struct, in which case they are
+	// looked up by reflection instead.
+	opaque bool
+}
+
+// index returns the index of the root Config instance or nil if the
+// root Config instance has no metadata in which to store the index.
+func (c Config) index(ctx context.Context) *configIndex {
+	root := c.root(ctx)
+	meta, ok := root[configMetaKey].(*configMeta)
+	if !ok {
+		return nil
+	}
+	if idx, _ := meta.index.Load().(*configIndex); idx != nil {
+		return idx
+	}
+	idx := &configIndex{root: newConfigIndexNode(root)}
+	meta.index.Store(idx)
+	return idx
+}
+
+// invalidateIndex discards the index of the root Config instance.
+func (c Config) invalidateIndex(ctx context.Context) {
+	if meta := c.meta(ctx); meta != nil {
+		meta.index.Store((*configIndex)(nil))
+	}
+}
+
+// newConfigIndexNode indexes v and its children.
+func newConfigIndexNode(v interface{}) *configIndexNode {
+	n := &configIndexNode{value: v}
+	switch tv := v.(type) {
+	case Config:
+		n.indexMap(tv)
+	case map[string]interface{}:
+		n.indexMap(tv)
+	case []interface{}:
+		n.elems = make([]*configIndexNode, len(tv))
+		n.keys = map[string]*configIndexNode{}
+		for i, e := range tv {
+			n.elems[i] = newConfigIndexNode(e)
+			switch derefValue(reflect.ValueOf(e)).Kind() {
+			case reflect.Map:
+				ev := derefValue(reflect.ValueOf(e))
+				if k, ok := findMapKey(ev, "name"); ok {
+					name := derefValue(ev.MapIndex(k)).Interface()
+					fold := strings.ToLower(toStringWithOpts(name, false))
+					if _, ok := n.keys[fold]; !ok {
+						n.keys[fold] = n.elems[i]
+					}
+				}
+			case reflect.Struct:
+				n.opaque = true
+			}
+		}
+	default:
+		switch derefValue(reflect.ValueOf(v)).Kind() {
+		case reflect.Map, reflect.Array, reflect.Slice, reflect.Struct:
+			n.opaque = true
+		}
+	}
+	return n
+}
+
+func (n *configIndexNode) indexMap(m map[string]interface{}) {
+	var (
+		keys     = make([]string, 0, len(m))
+		exact    = make(map[string]*configIndexNode, len(m))
+		collides bool
+	)
+	for k := range m {
+		if !isConfigMetaKey(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	n.keys = make(map[string]*configIndexNode, len(keys))
+	for _, k := range keys {
+		kn := newConfigIndexNode(m[k])
+		exact[k] = kn
+		fold := strings.ToLower(k)
+		if _, ok := n.keys[fold]; ok {
+			collides = true
+			continue
+		}
+		n.keys[fold] = kn
+	}
+
+	// the keys of a map with keys that differ only in case are also
+	// indexed exactly since an exact match is preferred; please see
+	// findMapKey
+	if collides {
+		n.exact = exact
+	}
+}
+
+// lookup returns the value at the path formed by the scope and path
+// tokens or nil if there is no such value in the index.
+//
+// The value is read from its parent container rather than from the
+// index, since the maps returned by Get may be modified directly, and
+// the index does not see such modifications. Please see lookupPath for
+// how a value missing from the index is confirmed.
+func (idx *configIndex) lookup(scope, path []configPathToken) interface{} {
+	var (
+		n       = idx.root
+		parent  *configIndexNode
+		lastTok configPathToken
+	)
+	for x, tokens := range [2][]configPathToken{scope, path} {
+		for i, tok := range tokens {
+			if n.opaque {
+				v := lookupConfigPathTokens(n.value, tokens[i:])
+				if x == 0 && v != nil {
+					v = lookupConfigPathTokens(v, path)
+				}
+				return v
+			}
+			parent, lastTok = n, tok
+			switch tok.kind {
+			case keyConfigPathToken:
+				if en, ok := n.exact[tok.key]; ok {
+					n = en
+				} else {
+					n = n.keys[tok.fold]
+				}
+			case indexConfigPathToken:
+				if tok.index >= len(n.elems) {
+					return nil
+				}
+				n = n.elems[tok.index]
+			default:
+				return nil
+			}
+			if n == nil {
+				return nil
+			}
+		}
+	}
+	if parent == nil {
+		return n.value
+	}
+	return lookupConfigPathToken(parent.value, lastTok)
+}
@@ -0,0 +1,187 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/akutz/lsx"
+)
+
+// newIndexedConfig returns the example config as a merged Config, which
+// has the metadata in which the index is stored.
+func newIndexedConfig(ctx context.Context) lsx.Config {
+	config := lsx.Config{}
+	if err := json.Unmarshal(exampleConfigJSON, &config); err != nil {
+		panic(err)
+	}
+	return lsx.ConfigLayers{
+		{Kind: lsx.FileConfigLayer, Config: config},
+	}.Merge(ctx)
+}
+
+var _ = Describe("Config compiled paths", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = newIndexedConfig(ctx)
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("should compile paths", func() {
+		p, err := lsx.CompilePath(`services.svc00."a.b"[0]`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(p.String()).Should(Equal(`services.svc00."a.b"[0]`))
+		_, err = lsx.CompilePath("services..svc00")
+		Ω(err).Should(BeAssignableToTypeOf(&lsx.ConfigPathError{}))
+		Ω(func() { lsx.MustCompilePath("a[") }).Should(Panic())
+	})
+
+	It("should get the same values as Get", func() {
+		plain := lsx.Config{}
+		Ω(json.Unmarshal(exampleConfigJSON, &plain)).Should(Succeed())
+		for _, path := range []string{
+			"logging.level",
+			"SERVERS.SVR01.ADDRS[1]",
+			"servers[0].type",
+			"services.svc00.api.volume.mount.host",
+			"services.svc00.servers[1]",
+			"modules[3].names",
+			"servers.svr02",
+			"logging.level.x",
+		} {
+			p, expected := lsx.MustCompilePath(path), plain.Get(ctx, path)
+			if expected == nil {
+				Ω(config.GetPath(ctx, p)).Should(BeNil(), path)
+				continue
+			}
+			Ω(config.GetPath(ctx, p)).Should(Equal(expected), path)
+			Ω(config.Get(ctx, path)).Should(Equal(expected), path)
+		}
+	})
+
+	It("should get values from scopes and their parents", func() {
+		level := lsx.MustCompilePath("logging.level")
+		svc := config.Scope(ctx, "services.svc00")
+		Ω(svc.GetPath(ctx, level)).Should(Equal("info"))
+		svr := config.Scope(ctx, "servers.svr00")
+		Ω(svr.GetPath(ctx, level)).Should(Equal("debug"))
+		mount := svc.Scope(ctx, "API.volume.mount")
+		Ω(mount.GetPath(ctx, lsx.MustCompilePath("host"))).Should(
+			Equal("tcp://192.168.0.192:7979"))
+		Ω(mount.GetPath(ctx, level)).Should(Equal("info"))
+	})
+
+	It("should get values overridden by env vars", func() {
+		os.Setenv("LSX_SERVICES_SVC00_LOGGING_LEVEL", "error")
+		defer os.Unsetenv("LSX_SERVICES_SVC00_LOGGING_LEVEL")
+		p := lsx.MustCompilePath("logging.level")
+		Ω(config.Scope(ctx, "services.svc00").GetPath(ctx, p)).Should(
+			Equal("error"))
+		Ω(config.GetPath(ctx, p)).Should(Equal("debug"))
+	})
+
+	It("should discard the index when the config is modified", func() {
+		p := lsx.MustCompilePath("logging.level")
+		Ω(config.GetPath(ctx, p)).Should(Equal("debug"))
+		Ω(config.Set(ctx, "logging.level", "warn")).Should(Succeed())
+		Ω(config.GetPath(ctx, p)).Should(Equal("warn"))
+
+		svc := config.Scope(ctx, "services.svc00")
+		Ω(svc.GetPath(ctx, p)).Should(Equal("info"))
+		Ω(svc.Delete(ctx, "logging")).Should(Succeed())
+		Ω(svc.GetPath(ctx, p)).Should(Equal("warn"))
+		Ω(config.Get(ctx, "services.svc00.logging")).Should(BeNil())
+
+		Ω(config.Set(ctx, "data", struct{ Name string }{"hello"})).Should(
+			Succeed())
+		Ω(config.GetPath(ctx, lsx.MustCompilePath("data.name"))).Should(
+			Equal("hello"))
+	})
+
+	It("should see modifications of the maps returned by Get", func() {
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("debug"))
+		m := config.Get(ctx, "logging").(map[string]interface{})
+		m["format"] = "json"
+		m["level"] = "warn"
+		Ω(config.Get(ctx, "logging.format")).Should(Equal("json"))
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("warn"))
+		delete(m, "level")
+		Ω(config.Get(ctx, "logging.level")).Should(BeNil())
+	})
+
+	It("should build the index from many goroutines", func() {
+		var (
+			wg     sync.WaitGroup
+			mu     sync.Mutex
+			values []interface{}
+			host   = lsx.MustCompilePath("api.volume.mount.host")
+		)
+		for i := 0; i < 64; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				svc := config.Scope(ctx, "services.svc00")
+				v := svc.GetPath(ctx, host)
+				mu.Lock()
+				values = append(values, v)
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		Ω(values).Should(HaveLen(64))
+		for _, v := range values {
+			Ω(v).Should(Equal("tcp://192.168.0.192:7979"))
+		}
+	})
+})
+
+func BenchmarkConfigGet(b *testing.B) {
+	ctx := context.Background()
+	config := lsx.Config{}
+	if err := json.Unmarshal(exampleConfigJSON, &config); err != nil {
+		b.Fatal(err)
+	}
+	svc := config.Scope(ctx, "services.svc00")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if svc.Get(ctx, "api.volume.mount.host") == nil {
+			b.Fatal("missing value")
+		}
+	}
+}
+
+func BenchmarkConfigGetIndexed(b *testing.B) {
+	ctx := context.Background()
+	svc := newIndexedConfig(ctx).Scope(ctx, "services.svc00")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if svc.Get(ctx, "api.volume.mount.host") == nil {
+			b.Fatal("missing value")
+		}
+	}
+}
+
+func BenchmarkConfigGetPath(b *testing.B) {
+	ctx := context.Background()
+	svc := newIndexedConfig(ctx).Scope(ctx, "services.svc00")
+	p := lsx.MustCompilePath("api.volume.mount.host")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if svc.GetPath(ctx, p) == nil {
+			b.Fatal("missing value")
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package lsx
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// maxInterpolationDepth is the maximum number of nested references
+// that are followed when a value is interpolated.
+const maxInterpolationDepth = 64
+
+// ConfigInterpolationError describes an expression in a config value
+// that could not be interpolated.
+type ConfigInterpolationError struct {
+	// Path is the path of the value that contains the expression.
+	Path string
+
+	// Expr is the expression, ex. ${env:HOME}.
+	Expr string
+
+	// Err is the reason the expression could not be interpolated.
+	Err error
+}
+
+// Error returns the error message.
+func (e *ConfigInterpolationError) Error() string {
+	return fmt.Sprintf(
+		"error: invalid config interpolation: path=%s, expr=%s: %v",
+		e.Path, e.Expr, e.Err)
+}
+
+// GetE returns a value from the config map or an error if the value
+// is missing or cannot be interpolated.
+//
+// String values may contain the following expressions, which are
+// replaced each time the value is returned:
+//
+//	${env:NAME}        the value of the environment variable NAME
+//
+//	${file:PATH}       the contents of the file at PATH, less any
+//	                   trailing newline characters
+//
+//	${ref:PATH}        the value at PATH, which is always relative
+//	                   to the root Config instance; a value that
+//	                   consists of a single reference is replaced
+//	                   with the referenced value as-is, so arrays
+//	                   and maps may be referenced
+//
+// The env and file expressions in a value fetched from a remote source
+// are not expanded, and are reported as errors instead; please see
+// ConfigLayer.Remote.
+//
+// An expression may include a fallback value that is used when the
+// environment variable is not set or empty, the file does not exist,
+// or the referenced value is missing, ex. ${env:NAME:-fallback}. The
+// fallback value may itself contain expressions. The sequence $${ is
+// replaced with a literal ${.
+//
+// The expressions in the maps and arrays returned by GetE are also
+// replaced, in which case copies of the maps and arrays are returned.
+//
+// A Secret value is returned as a string, and a ConfigPathError is
+// returned if the path cannot be parsed.
+func (c Config) GetE(ctx context.Context, path string) (interface{}, error) {
+	p, err := CompilePath(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetPathE(ctx, p)
+}
+
+// Resolve returns a copy of the root Config instance with all of the
+// expressions in its values replaced. An error that aggregates each
+// of the expressions that could not be interpolated is returned along
+// with the copy, in which those expressions are left as-is.
+func (c Config) Resolve(ctx context.Context) (Config, error) {
+	root := c.root(ctx)
+	m, _ := toStringMap(root)
+	var errs MultiError
+	v := root.interpolateValue(ctx, "", m, &errs)
+	return Config(v.(map[string]interface{})), errs.ErrOrNil()
+}
+
+// root returns the root Config instance.
+func (c Config) root(ctx context.Context) Config {
+	root := c
+	for p := root.Parent(ctx); p != nil; p = root.Parent(ctx) {
+		root = p
+	}
+	return root
+}
+
+// interpolate replaces the expressions in the value at the provided
+// absolute path.
+func (c Config) interpolate(
+	ctx context.Context, path string, v interface{}) (interface{}, error) {
+
+	if !hasInterpolation(v) {
+		return v, nil
+	}
+	var errs MultiError
+	v = c.interpolateValue(ctx, path, v, &errs)
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	if len(errs) > 1 {
+		return nil, errs
+	}
+	return v, nil
+}
+
+// interpolateValue replaces the expressions in v and records the
+// expressions that cannot be interpolated in errs.
+func (c Config) interpolateValue(
+	ctx context.Context,
+	path string,
+	v interface{},
+	errs *MultiError) interface{} {
+
+	switch tv := v.(type) {
+	case string:
+		iv, err := c.interpolateString(ctx, path, tv)
+		if err != nil {
+			*errs = append(*errs, err)
+			return tv
+		}
+		return iv
+	case Config:
+		return Config(c.interpolateValue(
+			ctx, path, map[string]interface{}(tv), errs).(map[string]interface{}))
+	case map[string]interface{}:
+		if !hasInterpolation(tv) {
+			return tv
+		}
+		m := make(map[string]interface{}, len(tv))
+		for k, v := range tv {
+			if isConfigMetaKey(k) {
+				m[k] = v
+				continue
+			}
+			m[k] = c.interpolateValue(ctx, joinConfigPath(path, k), v, errs)
+		}
+		return m
+	case []interface{}:
+		if !hasInterpolation(tv) {
+			return tv
+		}
+		a := make([]interface{}, len(tv))
+		for i, e := range tv {
+			a[i] = c.interpolateValue(ctx, elementPath(path, i, e), e, errs)
+		}
+		return a
+	}
+	return v
+}
+
+// hasInterpolation returns a flag indicating whether the value is or
+// contains a string with an expression.
+func hasInterpolation(v interface{}) bool {
+	switch tv := v.(type) {
+	case string:
+		return strings.Contains(tv, "${")
+	case Config:
+		return hasInterpolation(map[string]interface{}(tv))
+	case map[string]interface{}:
+		for k, v := range tv {
+			if !isConfigMetaKey(k) && hasInterpolation(v) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range tv {
+			if hasInterpolation(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// interpolationStack is the list of the paths of the values being
+// interpolated, used to detect reference cycles.
+type interpolationStack []string
+
+type interpolationStackKey struct{}
+
+// interpolateString replaces the expressions in the string at the
+// provided absolute path.
+func (c Config) interpolateString(
+	ctx context.Context, path, s string) (interface{}, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	stack, _ := ctx.Value(interpolationStackKey{}).(interpolationStack)
+	if len(stack) >= maxInterpolationDepth {
+		return nil, &ConfigInterpolationError{
+			Path: path,
+			Expr: s,
+			Err:  fmt.Errorf("too many nested references"),
+		}
+	}
+	stack = append(append(interpolationStack{}, stack...), path)
+	ctx = context.WithValue(ctx, interpolationStackKey{}, stack)
+	return c.expandString(ctx, path, s)
+}
+
+// expandString replaces the expressions in the string.
+func (c Config) expandString(
+	ctx context.Context, path, s string) (interface{}, error) {
+
+	var (
+		w   strings.Builder
+		rem = s
+	)
+	for {
+		i := strings.Index(rem, "${")
+		if i < 0 {
+			w.WriteString(rem)
+			break
+		}
+
+		// $${ is an escaped ${
+		if i > 0 && rem[i-1] == '$' {
+			w.WriteString(rem[:i-1])
+			w.WriteString("${")
+			rem = rem[i+2:]
+			continue
+		}
+		w.WriteString(rem[:i])
+
+		j := matchingBrace(rem, i+2)
+		if j < 0 {
+			return nil, &ConfigInterpolationError{
+				Path: path,
+				Expr: rem[i:],
+				Err:  fmt.Errorf("missing closing brace"),
+			}
+		}
+		v, err := c.evalExpr(ctx, path, rem[i:j+1])
+		if err != nil {
+			return nil, err
+		}
+
+		// a value that consists of a single expression is replaced
+		// with the expression's value as-is
+		if rem == s && i == 0 && j == len(s)-1 {
+			return v, nil
+		}
+		w.WriteString(toString(v))
+		rem = rem[j+1:]
+	}
+	return w.String(), nil
+}
+
+// matchingBrace returns the index of the brace that closes the
+// expression whose contents begin at i, or -1 if there is no such
+// brace.
+func matchingBrace(s string, i int) int {
+	depth := 1
+	for ; i < len(s); i++ {
+		switch {
+		case s[i] == '{' && i > 0 && s[i-1] == '$':
+			depth++
+		case s[i] == '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// evalExpr returns the value of an expression.
+func (c Config) evalExpr(
+	ctx context.Context, path, expr string) (interface{}, error) {
+
+	fail := func(format string, args ...interface{}) error {
+		return &ConfigInterpolationError{
+			Path: path,
+			Expr: expr,
+			Err:  fmt.Errorf(format, args...),
+		}
+	}
+
+	body := expr[2 : len(expr)-1]
+	p := strings.SplitN(body, ":", 2)
+	if len(p) != 2 || p[1] == "" {
+		return nil, fail("expected ${env:NAME}, ${file:PATH}, or ${ref:PATH}")
+	}
+	kind, arg := p[0], p[1]
+
+	var (
+		fallback    string
+		hasFallback bool
+	)
+	if i := strings.Index(arg, ":-"); i >= 0 {
+		arg, fallback, hasFallback = arg[:i], arg[i+2:], true
+	}
+	useFallback := func() (interface{}, error) {
+		return c.expandString(ctx, path, fallback)
+	}
+
+	if (kind == "env" || kind == "file") && c.isRemoteValue(ctx, path) {
+		return nil, fail("%s expressions are not allowed in remote configs",
+			kind)
+	}
+
+	switch kind {
+	case "env":
+		if v, ok := os.LookupEnv(arg); ok && v != "" {
+			return v, nil
+		} else if hasFallback {
+			return useFallback()
+		} else if ok {
+			return v, nil
+		}
+		return nil, fail("env var not set: %s", arg)
+
+	case "file":
+		buf, err := ioutil.ReadFile(arg)
+		if err != nil {
+			if hasFallback && os.IsNotExist(err) {
+				return useFallback()
+			}
+			return nil, fail("%v", err)
+		}
+		return strings.TrimRight(string(buf), "\r\n"), nil
+
+	case "ref":
+		stack, _ := ctx.Value(interpolationStackKey{}).(interpolationStack)
+		for i, p := range stack {
+			if isConfigPathOrChild(p, arg) {
+				cycle := append(append([]string{}, stack[i:]...), arg)
+				return nil, fail(
+					"reference cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		root := c.root(ctx)
+		v := root.get(ctx, arg, false)
+		if v == nil {
+			if hasFallback {
+				return useFallback()
+			}
+			return nil, fail("missing config value: path=%s", arg)
+		}
+		v, err := root.interpolate(ctx, arg, v)
+		if err != nil {
+			if _, ok := err.(*ConfigInterpolationError); ok {
+				return nil, err
+			}
+			return nil, fail("%v", err)
+		}
+		return v, nil
+	}
+
+	return nil, fail("unknown expression type: %s", kind)
+}
+
+// isRemoteValue returns a flag indicating whether the value at the
+// provided absolute path was fetched from a remote source.
+func (c Config) isRemoteValue(ctx context.Context, path string) bool {
+	meta := c.meta(ctx)
+	return meta != nil && meta.origins[strings.ToLower(path)].Remote
+}
+
+// isConfigPathOrChild returns a flag indicating whether path is the
+// same as parent or is the path of a value inside of parent.
+func isConfigPathOrChild(path, parent string) bool {
+	if len(path) < len(parent) || !strings.EqualFold(path[:len(parent)], parent) {
+		return false
+	}
+	return len(path) == len(parent) ||
+		path[len(parent)] == '.' || path[len(parent)] == '['
+}
@@ -0,0 +1,160 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config interpolation", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+		tmpDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal(
+			exampleConfigJSON,
+			&config)).ShouldNot(HaveOccurred())
+		tmpDir, err = ioutil.TempDir("", "lsx-config-interpolate")
+		Ω(err).ShouldNot(HaveOccurred())
+		os.Setenv("LSX_TEST_HOST", "192.168.0.1")
+	})
+	AfterEach(func() {
+		os.Unsetenv("LSX_TEST_HOST")
+		os.RemoveAll(tmpDir)
+		config = nil
+	})
+
+	interpolationError := func(err error) *lsx.ConfigInterpolationError {
+		Ω(err).Should(HaveOccurred())
+		Ω(err).Should(BeAssignableToTypeOf(&lsx.ConfigInterpolationError{}))
+		return err.(*lsx.ConfigInterpolationError)
+	}
+
+	It("should interpolate env vars", func() {
+		Ω(config.Set(ctx, "a", "tcp://${env:LSX_TEST_HOST}:7979")).Should(
+			Succeed())
+		Ω(config.Get(ctx, "a")).Should(Equal("tcp://192.168.0.1:7979"))
+	})
+	It("should use fallback values", func() {
+		Ω(config.Set(ctx, "a", "${env:LSX_TEST_MISSING:-localhost}")).Should(
+			Succeed())
+		Ω(config.Set(ctx, "b",
+			"${env:LSX_TEST_MISSING:-${env:LSX_TEST_HOST}}")).Should(Succeed())
+		Ω(config.Set(ctx, "c", "${ref:x.y:-${ref:logging.level}}")).Should(
+			Succeed())
+		Ω(config.Get(ctx, "a")).Should(Equal("localhost"))
+		Ω(config.Get(ctx, "b")).Should(Equal("192.168.0.1"))
+		Ω(config.Get(ctx, "c")).Should(Equal("debug"))
+	})
+	It("should interpolate files", func() {
+		f := filepath.Join(tmpDir, "token")
+		Ω(ioutil.WriteFile(f, []byte("s3cr3t\n"), 0600)).Should(Succeed())
+		Ω(config.Set(ctx, "a", "${file:"+f+"}")).Should(Succeed())
+		Ω(config.Get(ctx, "a")).Should(Equal("s3cr3t"))
+	})
+	It("should interpolate references", func() {
+		Ω(config.Set(ctx, "servers.svr00.addrs",
+			"${ref:servers.svr01.addrs}")).Should(Succeed())
+		Ω(config.Set(ctx, "a", "level=${ref:logging.level}")).Should(
+			Succeed())
+		Ω(config.Get(ctx, "servers.svr00.addrs")).Should(Equal(
+			config.Get(ctx, "servers.svr01.addrs")))
+		Ω(config.Get(ctx, "a")).Should(Equal("level=debug"))
+	})
+	It("should interpolate references from a scope", func() {
+		Ω(config.Set(ctx, "services.svc00.logging.level",
+			"${ref:logging.level}")).Should(Succeed())
+		svc := config.Scope(ctx, "services.svc00")
+		Ω(svc.Get(ctx, "logging.level")).Should(Equal("debug"))
+		Ω(svc.GetStringMap(ctx, "logging")).Should(
+			HaveKeyWithValue("level", "debug"))
+	})
+	It("should interpolate maps and arrays", func() {
+		Ω(config.Set(ctx, "timeouts", map[string]interface{}{
+			"read":  "${env:LSX_TEST_MISSING:-1m}",
+			"hosts": []interface{}{"${env:LSX_TEST_HOST}"},
+		})).Should(Succeed())
+		Ω(config.Get(ctx, "timeouts")).Should(Equal(map[string]interface{}{
+			"read":  "1m",
+			"hosts": []interface{}{"192.168.0.1"},
+		}))
+		Ω(config.GetDuration(ctx, "timeouts.read")).Should(Equal(time.Minute))
+		Ω(config.GetStringSlice(ctx, "timeouts.hosts")).Should(Equal(
+			[]string{"192.168.0.1"}))
+	})
+	It("should unescape $${", func() {
+		Ω(config.Set(ctx, "a", "$${env:LSX_TEST_HOST}")).Should(Succeed())
+		Ω(config.Get(ctx, "a")).Should(Equal("${env:LSX_TEST_HOST}"))
+	})
+
+	It("should report missing values", func() {
+		Ω(config.Set(ctx, "a", "${env:LSX_TEST_MISSING}")).Should(Succeed())
+		_, err := config.GetE(ctx, "a")
+		ie := interpolationError(err)
+		Ω(ie.Path).Should(Equal("a"))
+		Ω(ie.Expr).Should(Equal("${env:LSX_TEST_MISSING}"))
+		Ω(config.Get(ctx, "a")).Should(BeNil())
+		Ω(config.Set(ctx, "b", "${ref:x.y}")).Should(Succeed())
+		_, err = config.GetStrE(ctx, "b")
+		Ω(err.Error()).Should(Equal(
+			"error: invalid config interpolation: path=b, " +
+				"expr=${ref:x.y}: missing config value: path=x.y"))
+	})
+	It("should report invalid expressions", func() {
+		Ω(config.Set(ctx, "a", "${bad:x}")).Should(Succeed())
+		_, err := config.GetE(ctx, "a")
+		Ω(interpolationError(err).Path).Should(Equal("a"))
+		Ω(config.Set(ctx, "a", "${env:X")).Should(Succeed())
+		_, err = config.GetE(ctx, "a")
+		Ω(interpolationError(err).Path).Should(Equal("a"))
+	})
+	It("should report reference cycles", func() {
+		Ω(config.Set(ctx, "a", "${ref:b}")).Should(Succeed())
+		Ω(config.Set(ctx, "b", "x${ref:c}")).Should(Succeed())
+		Ω(config.Set(ctx, "c", "${ref:a}")).Should(Succeed())
+		_, err := config.GetE(ctx, "a")
+		ie := interpolationError(err)
+		Ω(ie.Path).Should(Equal("c"))
+		Ω(ie.Expr).Should(Equal("${ref:a}"))
+		Ω(ie.Err.Error()).Should(Equal("reference cycle: a -> b -> c -> a"))
+	})
+	It("should report references to a containing value", func() {
+		Ω(config.Set(ctx, "x.y", "${ref:x}")).Should(Succeed())
+		_, err := config.GetE(ctx, "x")
+		Ω(interpolationError(err).Err.Error()).Should(Equal(
+			"reference cycle: x.y -> x"))
+	})
+
+	It("should resolve the config", func() {
+		Ω(config.Set(ctx, "logging.level", "${env:LSX_TEST_MISSING:-warn}")).
+			Should(Succeed())
+		resolved, err := config.Scope(ctx, "services.svc00").Resolve(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(resolved.Get(ctx, "logging.level")).Should(Equal("warn"))
+		Ω(resolved.Get(ctx, "services.svc00.logging.level")).Should(
+			Equal("info"))
+	})
+	It("should validate the interpolated config", func() {
+		Ω(config.Set(ctx, "servers.svr00.addrs",
+			[]interface{}{"tcp://${env:LSX_TEST_HOST}:7979"})).Should(Succeed())
+		Ω(config.Validate(ctx)).Should(Succeed())
+		Ω(config.Set(ctx, "logging.level", "${ref:missing}")).Should(
+			Succeed())
+		err := config.Validate(ctx)
+		Ω(err).Should(HaveOccurred())
+		Ω(err.(lsx.MultiError)[0].(*lsx.ConfigValidationError).Path).Should(
+			Equal("logging.level"))
+	})
+})
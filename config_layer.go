@@ -0,0 +1,575 @@
+package lsx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigLayerKind is the kind of source from which a ConfigLayer
+// was loaded.
+type ConfigLayerKind uint8
+
+const (
+	// InvalidConfigLayer is an invalid config layer kind.
+	InvalidConfigLayer ConfigLayerKind = iota
+
+	// DefaultsConfigLayer is a layer of built-in default values.
+	DefaultsConfigLayer
+
+	// FileConfigLayer is a layer loaded from a config file.
+	FileConfigLayer
+
+	// DirConfigLayer is a layer loaded from a file in a conf.d
+	// directory.
+	DirConfigLayer
+
+	// EnvConfigLayer is a layer of values loaded from environment
+	// variables.
+	EnvConfigLayer
+
+	// ArgsConfigLayer is a layer of values provided as command-line
+	// overrides.
+	ArgsConfigLayer
+
+	// ProviderConfigLayer is a layer loaded by a ConfigProvider.
+	ProviderConfigLayer
+)
+
+// String returns the config layer kind's string representation.
+func (k ConfigLayerKind) String() string {
+	switch k {
+	case DefaultsConfigLayer:
+		return "defaults"
+	case FileConfigLayer:
+		return "file"
+	case DirConfigLayer:
+		return "dir"
+	case EnvConfigLayer:
+		return "env"
+	case ArgsConfigLayer:
+		return "args"
+	case ProviderConfigLayer:
+		return "provider"
+	}
+	return "invalid"
+}
+
+// MarshalText marshals the config layer kind to its string
+// representation.
+func (k ConfigLayerKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ConfigLayer is a single source of configuration information.
+type ConfigLayer struct {
+	// Kind is the kind of source from which the layer was loaded.
+	Kind ConfigLayerKind `json:"kind"`
+
+	// Source describes the origin of the layer, such as the path to
+	// the file from which the layer was loaded.
+	Source string `json:"source,omitempty"`
+
+	// Config is the configuration information provided by the layer.
+	Config Config `json:"config"`
+
+	// Remote is a flag indicating whether the layer was fetched from a
+	// remote source, such as by the http config provider. The ${env:...}
+	// and ${file:...} expressions in the values of a remote layer are not
+	// expanded, so a remote config cannot read local files and
+	// environment variables.
+	Remote bool `json:"remote,omitempty"`
+
+	// Lines are the line numbers of the layer's values in the layer's
+	// source, keyed by the lower-case paths of the values. Lines is nil
+	// if the line numbers are not known.
+	Lines map[string]int `json:"-"`
+
+	// order are the keys of the layer's objects in the order in which
+	// they appear in the layer's source, keyed by the lower-case paths
+	// of the objects. order is nil if the order is not known.
+	order map[string][]string
+
+	// origins are the origins of the layer's values recorded by the
+	// config from which the layer was created, keyed by the lower-case
+	// paths of the values. A value without an origin is attributed to
+	// the layer itself.
+	origins map[string]ConfigOrigin
+}
+
+// ConfigLayers is a list of config layers ordered from the lowest
+// precedence to the highest.
+type ConfigLayers []*ConfigLayer
+
+// ByKind returns the layers of the provided kind.
+func (l ConfigLayers) ByKind(kind ConfigLayerKind) ConfigLayers {
+	var kl ConfigLayers
+	for _, layer := range l {
+		if layer.Kind == kind {
+			kl = append(kl, layer)
+		}
+	}
+	return kl
+}
+
+// Merge returns a new Config that is the result of merging all of the
+// layers, in order, on top of one another. The layers themselves are
+// not modified.
+//
+// Maps are merged recursively, and arrays of objects with a "name"
+// field are merged element-by-element by name. All other values,
+// including arrays of non-objects, replace the value from a lower
+// layer. Map keys and element names are matched case-insensitively,
+// the same way Get matches them.
+//
+// The merged Config remembers the layer that provided each of its
+// values, please see Explain, and the order in which the layers defined
+// its keys, please see MarshalJSON. The merged Config is also indexed
+// for faster lookups; please see ConfigPath.
+func (l ConfigLayers) Merge(ctx context.Context) Config {
+	var (
+		config  = Config{}
+		origins = map[string]ConfigOrigin{}
+		order   = map[string][]string{}
+	)
+	for _, layer := range l {
+		mergeConfigValue(config, layer.Config)
+		mergeConfigOrder(order, layer.order)
+		walkConfigPaths(layer.Config, "", func(path string) {
+			path = strings.ToLower(path)
+			if o, ok := layer.origins[path]; ok {
+				origins[path] = o
+				return
+			}
+			origins[path] = ConfigOrigin{
+				Layer:  layer.Kind,
+				Source: layer.Source,
+				Line:   layer.Lines[path],
+				Remote: layer.Remote,
+			}
+		})
+	}
+	config[configMetaKey] = &configMeta{origins: origins, order: order}
+	return config
+}
+
+// mergeConfigOrder appends the keys in src that are not in dst to dst,
+// so that the keys of an object are ordered by the first layer that
+// defines them. Keys are matched case-insensitively.
+func mergeConfigOrder(dst, src map[string][]string) {
+	for path, keys := range src {
+		for _, k := range keys {
+			found := false
+			for _, dk := range dst[path] {
+				if strings.EqualFold(k, dk) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				dst[path] = append(dst[path], k)
+			}
+		}
+	}
+}
+
+// ConfigLoader loads a layered configuration.
+//
+// The layers are loaded and merged with the following precedence,
+// from lowest to highest:
+//
+//	Defaults    built-in default values
+//
+//	Files       config files, in the order they are listed, each
+//	            followed by the fragments it includes
+//
+//	Dirs        the config files in each conf.d directory, in
+//	            lexical order, each followed by the fragments it
+//	            includes
+//
+//	Providers   the configs loaded by config providers, in the
+//	            order they are listed
+//
+//	Env         environment variables named after the path of a
+//	            value defined by a lower layer; see EnvVarName
+//
+//	Args        command-line overrides
+//
+// A config file may include fragments with a top-level "include" array
+// of file paths or glob patterns, ex. "include": ["conf.d/*.json"],
+// which are relative to the directory of the including file. The config
+// files in the including file's implicit conf.d directory, which is the
+// path of the file without its extension and with the suffix ".d", ex.
+// /etc/lsx/config.d for /etc/lsx/config.json, are included as well. The
+// fragments are merged after the including file in lexical order, and
+// arrays of objects with a "name" field, such as servers and services,
+// are merged element-by-element. Load fails if a file includes itself,
+// directly or indirectly, or if two fragments define the same value of
+// an array element with the same name differently; the errors name both
+// files.
+//
+// Load also fails if a layer has map keys that differ only in case, such
+// as Logging and logging, or an array with more than one element with
+// the same name, since Get matches both case-insensitively. The errors
+// are reported by a MultiError that contains a ConfigValidationError
+// for each such key or element that names the other one.
+//
+// Please note that Get continues to consult environment variables
+// at the time of each lookup, so values set in the environment after
+// the config is loaded are still honored. The prefix of the names of
+// the environment variables is read from the context; please see
+// WithEnvPrefix.
+type ConfigLoader struct {
+	// Defaults are the built-in default values.
+	Defaults Config
+
+	// Files are the paths of the config files to load. An element that
+	// is not the path to an existing file but is a JSON object is
+	// treated as an inline config document. The format of each file is
+	// detected from its extension or content.
+	Files []string
+
+	// Dirs are the paths of conf.d directories to load.
+	Dirs []string
+
+	// Providers are the config providers to load. Each provider's Load
+	// function is invoked with a context that stores the config merged
+	// from the lower layers with ConfigKey.
+	Providers []ConfigProvider
+
+	// Env is a flag indicating whether or not to load the environment
+	// variable layer.
+	Env bool
+
+	// Args are command-line overrides in the form path=value. A value
+	// that is valid JSON is decoded as such; otherwise the value is
+	// treated as a string.
+	Args []string
+
+	// Validate is an optional function used to validate the merged
+	// config. Load fails if Validate returns an error.
+	Validate func(ctx context.Context, config Config) error
+}
+
+// Load loads and merges the configured layers. The merged Config is
+// returned along with the individual layers.
+func (l *ConfigLoader) Load(ctx context.Context) (Config, ConfigLayers, error) {
+	var layers ConfigLayers
+
+	if len(l.Defaults) > 0 {
+		layers = append(layers, &ConfigLayer{
+			Kind:   DefaultsConfigLayer,
+			Config: copyConfig(l.Defaults),
+		})
+	}
+
+	for _, f := range l.Files {
+		fileLayers, err := loadConfigFileTree(f, FileConfigLayer)
+		if err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, fileLayers...)
+	}
+
+	for _, d := range l.Dirs {
+		dirLayers, err := loadConfigDir(d)
+		if err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, dirLayers...)
+	}
+
+	for _, p := range l.Providers {
+		pctx := context.WithValue(ctx, ConfigKey, layers.Merge(ctx))
+		config, err := p.Load(pctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, newProviderConfigLayer(p, config))
+	}
+
+	// reject ambiguous keys and names before they are merged away
+	if err := checkConfigLayerKeys(layers); err != nil {
+		return nil, nil, err
+	}
+
+	if l.Env {
+		envLayer, err := loadConfigEnv(ctx, layers.Merge(ctx))
+		if err != nil {
+			return nil, nil, err
+		}
+		if envLayer.Config.Len() > 0 {
+			layers = append(layers, envLayer)
+		}
+	}
+
+	if len(l.Args) > 0 {
+		argsLayer, err := loadConfigArgs(ctx, l.Args)
+		if err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, argsLayer)
+	}
+
+	config := layers.Merge(ctx)
+	if l.Validate != nil {
+		if err := l.Validate(ctx, config); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return config, layers, nil
+}
+
+// ParseConfig parses a config document into a Config object. The
+// format of the document is detected from its content.
+func ParseConfig(buf []byte) (Config, error) {
+	return DecodeConfig(buf, DetectConfigFormat("", buf))
+}
+
+func loadConfigFile(v string) (*ConfigLayer, error) {
+	if !FileExists(v) {
+		if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+			return nil, fmt.Errorf("error: missing config file: %s", v)
+		}
+		buf := []byte(v)
+		layer, err := decodeConfigLayer(buf, DetectConfigFormat("", buf))
+		if err != nil {
+			return nil, fmt.Errorf("error: invalid inline config: %v", err)
+		}
+		layer.Kind = FileConfigLayer
+		return layer, nil
+	}
+	buf, err := ioutil.ReadFile(v)
+	if err != nil {
+		return nil, fmt.Errorf("error: read config failed: %v", err)
+	}
+	layer, err := decodeConfigLayer(buf, DetectConfigFormat(v, buf))
+	if err != nil {
+		return nil, fmt.Errorf("error: invalid config file: %s: %v", v, err)
+	}
+	layer.Kind, layer.Source = FileConfigLayer, v
+	return layer, nil
+}
+
+func loadConfigDir(d string) (ConfigLayers, error) {
+	infos, err := ioutil.ReadDir(d)
+	if err != nil {
+		return nil, fmt.Errorf("error: read config dir failed: %v", err)
+	}
+	var layers ConfigLayers
+	for _, fi := range infos {
+		if fi.IsDir() || !isConfigFile(fi.Name()) {
+			continue
+		}
+		f := filepath.Join(d, fi.Name())
+		fileLayers, err := loadConfigFileTree(f, DirConfigLayer)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, fileLayers...)
+	}
+	return layers, nil
+}
+
+// loadConfigEnv returns a layer with the values of the environment
+// variables that match the paths of the values in the provided config.
+func loadConfigEnv(ctx context.Context, config Config) (*ConfigLayer, error) {
+	layer := &ConfigLayer{Kind: EnvConfigLayer, Source: "env", Config: Config{}}
+	var err error
+	walkConfigPaths(config, "", func(path string) {
+		if err != nil {
+			return
+		}
+		if _, v, ok := config.lookupEnv(ctx, path); ok {
+			err = layer.Config.Set(ctx, path, v)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+func loadConfigArgs(ctx context.Context, args []string) (*ConfigLayer, error) {
+	layer := &ConfigLayer{Kind: ArgsConfigLayer, Source: "args", Config: Config{}}
+	for _, a := range args {
+		p := strings.SplitN(a, "=", 2)
+		if len(p) != 2 || p[0] == "" {
+			return nil, fmt.Errorf("error: invalid config override: %s", a)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(p[1]), &v); err != nil {
+			v = p[1]
+		}
+		if err := layer.Config.Set(ctx, p[0], v); err != nil {
+			return nil, err
+		}
+	}
+	return layer, nil
+}
+
+// walkConfigPaths invokes f with the path of every value in the config
+// tree that is addressable with Get, in lexical order. Array elements
+// are addressed by their "name" field.
+func walkConfigPaths(v interface{}, prefix string, f func(path string)) {
+	join := func(k string) string {
+		return joinConfigPath(prefix, k)
+	}
+	switch tv := v.(type) {
+	case Config:
+		walkConfigPaths(map[string]interface{}(tv), prefix, f)
+	case map[string]interface{}:
+		for _, k := range sortedKeys(tv) {
+			if isConfigMetaKey(k) {
+				continue
+			}
+			f(join(k))
+			walkConfigPaths(tv[k], join(k), f)
+		}
+	case []interface{}:
+		for _, e := range tv {
+			if m, ok := e.(map[string]interface{}); ok {
+				if name, ok := m["name"].(string); ok && name != "" {
+					f(join(name))
+					walkConfigPaths(m, join(name), f)
+				}
+			}
+		}
+	}
+}
+
+// mergeConfigValue merges src into dst and returns the result. Values
+// from src are copied so that the merged result does not share any
+// maps or slices with src.
+func mergeConfigValue(dst, src interface{}) interface{} {
+	if c, ok := src.(Config); ok {
+		src, _ = toStringMap(c)
+	}
+	if c, ok := dst.(Config); ok {
+		dst = map[string]interface{}(c)
+	}
+
+	switch tsrc := src.(type) {
+
+	case map[string]interface{}:
+		switch tdst := dst.(type) {
+
+		// merge maps recursively
+		case map[string]interface{}:
+			dstVal := reflect.ValueOf(tdst)
+			for _, k := range sortedKeys(tsrc) {
+				v := tsrc[k]
+				if mk, ok := findMapKey(dstVal, k); ok {
+					dk := mk.String()
+					tdst[dk] = mergeConfigValue(tdst[dk], v)
+					continue
+				}
+				tdst[k] = copyConfigValue(v)
+			}
+			return tdst
+
+		// a map merged into an array is treated as a set of array
+		// elements keyed by name, which is how Set and the env and
+		// args layers address array elements
+		case []interface{}:
+			keys := make([]string, 0, len(tsrc))
+			for k := range tsrc {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				v := tsrc[k]
+				el, ok := v.(map[string]interface{})
+				if !ok {
+					return copyConfigValue(src)
+				}
+				if _, ok := el["name"]; !ok {
+					el = copyConfigValue(el).(map[string]interface{})
+					el["name"] = k
+				}
+				tdst = mergeNamedElement(tdst, el)
+			}
+			return tdst
+		}
+
+	case []interface{}:
+		if tdst, ok := dst.([]interface{}); ok && isNamedArray(tsrc) {
+			for _, e := range tsrc {
+				tdst = mergeNamedElement(tdst, e.(map[string]interface{}))
+			}
+			return tdst
+		}
+	}
+
+	return copyConfigValue(src)
+}
+
+// mergeNamedElement merges el into the element of dst with the same
+// name, or appends el to dst if no element has the same name.
+func mergeNamedElement(
+	dst []interface{}, el map[string]interface{}) []interface{} {
+
+	name := toString(el["name"])
+	for i, e := range dst {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(name, toString(m["name"])) {
+			dst[i] = mergeConfigValue(m, el)
+			return dst
+		}
+	}
+	return append(dst, copyConfigValue(el))
+}
+
+// isNamedArray returns a flag indicating whether every element of the
+// array is an object with a "name" field.
+func isNamedArray(a []interface{}) bool {
+	if len(a) == 0 {
+		return false
+	}
+	for _, e := range a {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m["name"].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// copyConfig returns a deep copy of the config less its metadata keys.
+func copyConfig(c Config) Config {
+	m, _ := toStringMap(c)
+	return Config(copyConfigValue(m).(map[string]interface{}))
+}
+
+// copyConfigValue returns a deep copy of the maps and slices in v.
+func copyConfigValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case Config:
+		return copyConfig(tv)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(tv))
+		for k, v := range tv {
+			m[k] = copyConfigValue(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(tv))
+		for i, v := range tv {
+			a[i] = copyConfigValue(v)
+		}
+		return a
+	}
+	return v
+}
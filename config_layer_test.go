@@ -0,0 +1,148 @@
+package lsx_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("ConfigLoader", func() {
+
+	var (
+		ctx    context.Context
+		tmpDir string
+		loader *lsx.ConfigLoader
+		config lsx.Config
+		layers lsx.ConfigLayers
+		err    error
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		tmpDir, err = ioutil.TempDir("", "lsx-config-layer")
+		Ω(err).ShouldNot(HaveOccurred())
+		confDir := filepath.Join(tmpDir, "conf.d")
+		Ω(os.Mkdir(confDir, 0755)).Should(Succeed())
+		Ω(ioutil.WriteFile(
+			filepath.Join(tmpDir, "config.json"),
+			exampleConfigJSON, 0644)).Should(Succeed())
+		Ω(ioutil.WriteFile(
+			filepath.Join(confDir, "10-svr01.json"),
+			[]byte(`{"servers":[{"name":"svr01","type":"libstorage"}]}`),
+			0644)).Should(Succeed())
+		Ω(ioutil.WriteFile(
+			filepath.Join(confDir, "20-svr02.json"),
+			[]byte(`{"servers":[{"name":"svr02","type":"csi"}],`+
+				`"logging":{"level":"warn"}}`),
+			0644)).Should(Succeed())
+		loader = &lsx.ConfigLoader{
+			Defaults: lsx.Config{
+				"logging": map[string]interface{}{
+					"level":  "info",
+					"format": "text",
+				},
+			},
+			Files: []string{filepath.Join(tmpDir, "config.json")},
+			Dirs:  []string{confDir},
+		}
+	})
+	JustBeforeEach(func() {
+		config, layers, err = loader.Load(ctx)
+	})
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+		config = nil
+		layers = nil
+	})
+
+	It("should load every layer", func() {
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(layers).Should(HaveLen(4))
+		Ω(layers.ByKind(lsx.DefaultsConfigLayer)).Should(HaveLen(1))
+		Ω(layers.ByKind(lsx.FileConfigLayer)).Should(HaveLen(1))
+		Ω(layers.ByKind(lsx.DirConfigLayer)).Should(HaveLen(2))
+	})
+	It("should not modify the layers", func() {
+		Ω(layers[0].Config.Get(ctx, "logging.level")).Should(Equal("info"))
+		Ω(layers[1].Config.Get(ctx, "servers")).Should(HaveLen(2))
+	})
+	It("should merge maps deeply", func() {
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("warn"))
+		Ω(config.Get(ctx, "logging.format")).Should(Equal("text"))
+		Ω(config.Get(ctx, "logging.requests")).Should(Equal(true))
+	})
+	It("should merge named arrays by name", func() {
+		Ω(config.Get(ctx, "servers")).Should(HaveLen(3))
+		Ω(config.Get(ctx, "servers.svr01.type")).Should(Equal("libstorage"))
+		Ω(config.GetStringSlice(ctx, "servers.svr01.addrs")).Should(
+			HaveLen(2))
+		Ω(config.Get(ctx, "servers.svr02.type")).Should(Equal("csi"))
+	})
+	It("should still scope the merged config", func() {
+		svr := config.Scope(ctx, "servers.svr00")
+		Ω(svr.Len()).Should(Equal(3))
+		Ω(svr.Get(ctx, "logging.level")).Should(Equal("warn"))
+	})
+
+	Context("with env and args", func() {
+		BeforeEach(func() {
+			os.Setenv("LSX_SERVERS_SVR00_TYPE", "csi")
+			os.Setenv("LSX_UNKNOWN_KEY", "value")
+			loader.Env = true
+			loader.Args = []string{
+				"logging.level=error",
+				"logging.requests=false",
+				"servers.svr03.addrs=[\"tcp://127.0.0.1:1\"]",
+			}
+		})
+		AfterEach(func() {
+			os.Setenv("LSX_SERVERS_SVR00_TYPE", "")
+			os.Setenv("LSX_UNKNOWN_KEY", "")
+		})
+		It("should have env and args layers", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(layers).Should(HaveLen(6))
+			env := layers.ByKind(lsx.EnvConfigLayer)
+			Ω(env).Should(HaveLen(1))
+			Ω(env[0].Config.Len()).Should(Equal(1))
+			Ω(layers.ByKind(lsx.ArgsConfigLayer)).Should(HaveLen(1))
+		})
+		It("should override lower layers", func() {
+			Ω(config.Get(ctx, "logging.level")).Should(Equal("error"))
+			Ω(config.Get(ctx, "logging.requests")).Should(Equal(false))
+			Ω(config.Get(ctx, "servers")).Should(HaveLen(4))
+			Ω(config.Get(ctx, "unknown")).Should(BeNil())
+		})
+		It("should merge env values into named arrays", func() {
+			os.Setenv("LSX_SERVERS_SVR00_TYPE", "")
+			Ω(config.Get(ctx, "servers.svr00.type")).Should(Equal("csi"))
+			Ω(config.GetStringSlice(ctx, "servers.svr00.addrs")).Should(
+				HaveLen(1))
+			Ω(config.GetStringSlice(ctx, "servers.svr03.addrs")).Should(
+				HaveLen(1))
+		})
+	})
+
+	Context("with an inline document", func() {
+		BeforeEach(func() {
+			loader.Files = append(loader.Files, `{"logging":{"level":"x"}}`)
+			loader.Dirs = nil
+		})
+		It("should load the inline document", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Get(ctx, "logging.level")).Should(Equal("x"))
+		})
+	})
+
+	Context("with a missing file", func() {
+		BeforeEach(func() {
+			loader.Files = []string{filepath.Join(tmpDir, "missing.json")}
+		})
+		It("should fail", func() {
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,145 @@
+package lsx
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Fingerprint returns a stable hash of the canonical form of the Config
+// instance, which is its JSON form with the keys of every object in
+// lexical order and secrets revealed. Two Config instances with the same
+// values have the same fingerprint regardless of the order in which
+// their keys were defined, and a change to a secret value changes the
+// fingerprint even though MarshalJSON redacts the secret.
+//
+// The fingerprint is the hex-encoded SHA-256 digest of the canonical
+// form. The values of the environment variables that override config
+// values at the time of each lookup are not part of the fingerprint.
+func (c Config) Fingerprint() (string, error) {
+	ctx := context.Background()
+	e := &configEncoder{reveal: true}
+	if err := e.encode(c, c.FullPath(ctx, "")); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(e.w.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// configEncoder writes the JSON form of a config tree.
+type configEncoder struct {
+	w bytes.Buffer
+
+	// secrets are the lower-case absolute paths of the values that are
+	// redacted; please see secretPaths.
+	secrets map[string]bool
+
+	// order are the keys of the objects in the order in which they are
+	// written, keyed by the lower-case absolute paths of the objects.
+	// Keys that are not listed are written in lexical order after the
+	// keys that are.
+	order map[string][]string
+
+	// reveal is a flag indicating whether Secret values are written
+	// instead of redacted.
+	reveal bool
+}
+
+// encode writes v, the value at the absolute path, to the encoder's
+// buffer.
+func (e *configEncoder) encode(v interface{}, path string) error {
+	if _, ok := v.(Secret); !ok && e.secrets[strings.ToLower(path)] {
+		return e.marshal(redactedSecret)
+	}
+	switch tv := v.(type) {
+	case Config:
+		return e.encodeMap(tv, path)
+	case map[string]interface{}:
+		return e.encodeMap(tv, path)
+	case []interface{}:
+		e.w.WriteByte('[')
+		for i, el := range tv {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			if err := e.encode(el, elementPath(path, i, el)); err != nil {
+				return err
+			}
+		}
+		e.w.WriteByte(']')
+		return nil
+	case Secret:
+		if e.reveal {
+			return e.marshal(string(tv))
+		}
+	}
+	return e.marshal(v)
+}
+
+// encodeMap writes the keys and values of m, the object at the absolute
+// path, to the encoder's buffer. The metadata keys are omitted.
+func (e *configEncoder) encodeMap(m map[string]interface{}, path string) error {
+	e.w.WriteByte('{')
+	for i, k := range e.keys(m, path) {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		if err := e.marshal(k); err != nil {
+			return err
+		}
+		e.w.WriteByte(':')
+		if err := e.encode(m[k], joinConfigPath(path, k)); err != nil {
+			return err
+		}
+	}
+	e.w.WriteByte('}')
+	return nil
+}
+
+// keys returns the keys of m, the object at the absolute path, in the
+// order in which they are written.
+func (e *configEncoder) keys(m map[string]interface{}, path string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if !isConfigMetaKey(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	order := e.order[strings.ToLower(path)]
+	if len(order) == 0 {
+		return keys
+	}
+	var (
+		ordered = make([]string, 0, len(keys))
+		used    = make(map[string]bool, len(keys))
+	)
+	for _, ok := range order {
+		for _, k := range keys {
+			if !used[k] && strings.EqualFold(ok, k) {
+				ordered, used[k] = append(ordered, k), true
+				break
+			}
+		}
+	}
+	for _, k := range keys {
+		if !used[k] {
+			ordered = append(ordered, k)
+		}
+	}
+	return ordered
+}
+
+// marshal writes the JSON encoding of v to the encoder's buffer.
+func (e *configEncoder) marshal(v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.w.Write(buf)
+	return nil
+}
@@ -0,0 +1,116 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config MarshalJSON", func() {
+
+	var (
+		ctx    context.Context
+		tmpDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		ctx = context.Background()
+		tmpDir, err = ioutil.TempDir("", "lsx-config-marshal")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	load := func(name, data string, args ...string) lsx.Config {
+		f := filepath.Join(tmpDir, name)
+		Ω(ioutil.WriteFile(f, []byte(data), 0644)).Should(Succeed())
+		config, _, err := (&lsx.ConfigLoader{
+			Files: []string{f},
+			Args:  args,
+		}).Load(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+		return config
+	}
+
+	It("should escape keys", func() {
+		config := lsx.Config{`a"b`: 1, `c\d`: 2, "<e>": 3}
+		buf, err := json.Marshal(config)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(Equal(
+			`{"\u003ce\u003e":3,"a\"b":1,"c\\d":2}`))
+		var m map[string]interface{}
+		Ω(json.Unmarshal(buf, &m)).Should(Succeed())
+		Ω(m).Should(HaveKey(`a"b`))
+	})
+
+	It("should sort keys when their order is not known", func() {
+		config := lsx.Config{}
+		Ω(json.Unmarshal(exampleConfigJSON, &config)).Should(Succeed())
+		buf, err := json.Marshal(config)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(HavePrefix(
+			`{"logging":{"level":"debug","requests":true,"responses":true},` +
+				`"modules":[{"path":"/tmp/lsx/lib/mods/config.so"},`))
+		for i := 0; i < 10; i++ {
+			again, err := json.Marshal(config)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(again).Should(Equal(buf))
+		}
+	})
+
+	It("should write keys in their original order", func() {
+		config := load("config.json", `{
+			"zulu": {"b": 1, "a": 2},
+			"alpha": [{"name": "x", "z": 1, "y": 2}],
+			"mike": 3
+		}`, "yankee=4", "zulu.c=5")
+		buf, err := json.Marshal(config)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(Equal(
+			`{"zulu":{"b":1,"a":2,"c":5},` +
+				`"alpha":[{"name":"x","z":1,"y":2}],"mike":3,"yankee":4}`))
+
+		buf, err = json.Marshal(config.Scope(ctx, "zulu"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(Equal(`{"b":1,"a":2,"c":5}`))
+
+		config = load("config.yaml", "zulu: 1\nalpha: 2\nmike: 3\n")
+		buf, err = json.Marshal(config)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(Equal(`{"zulu":1,"alpha":2,"mike":3}`))
+	})
+
+	It("should fingerprint the canonical form", func() {
+		a := load("a.json", `{"b": {"d": 1, "c": [1, 2]}, "a": "x"}`)
+		b := load("b.json", `{"a": "x", "b": {"c": [1, 2], "d": 1}}`)
+		fa, err := a.Fingerprint()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(fa).Should(HaveLen(64))
+		Ω(b.Fingerprint()).Should(Equal(fa))
+
+		plain := lsx.Config{}
+		Ω(json.Unmarshal(
+			[]byte(`{"a": "x", "b": {"c": [1, 2], "d": 1}}`), &plain)).Should(
+			Succeed())
+		Ω(plain.Fingerprint()).Should(Equal(fa))
+
+		Ω(b.Set(ctx, "b.d", 2)).Should(Succeed())
+		Ω(b.Fingerprint()).ShouldNot(Equal(fa))
+	})
+
+	It("should fingerprint secrets", func() {
+		a := lsx.Config{"password": lsx.Secret("a")}
+		b := lsx.Config{"password": lsx.Secret("b")}
+		Ω(json.Marshal(a)).Should(Equal([]byte(`{"password":"***"}`)))
+		Ω(json.Marshal(b)).Should(Equal([]byte(`{"password":"***"}`)))
+		fa, err := a.Fingerprint()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(b.Fingerprint()).ShouldNot(Equal(fa))
+	})
+})
@@ -0,0 +1,398 @@
+package lsx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ConfigPathError occurs when a config path cannot be parsed.
+type ConfigPathError struct {
+	// Path is the path that could not be parsed.
+	Path string
+
+	// Message describes why the path could not be parsed.
+	Message string
+}
+
+// Error returns the error message.
+func (e *ConfigPathError) Error() string {
+	return fmt.Sprintf("error: invalid config path: path=%s: %s",
+		e.Path, e.Message)
+}
+
+// configPathTokenKind is the kind of a parsed path token.
+type configPathTokenKind uint8
+
+const (
+	// keyConfigPathToken matches a map key, the name of an array
+	// element, or a struct field.
+	keyConfigPathToken configPathTokenKind = iota
+
+	// indexConfigPathToken matches an array element by its index.
+	indexConfigPathToken
+
+	// wildcardConfigPathToken matches every child of a value.
+	wildcardConfigPathToken
+)
+
+// configPathToken is a single token of a parsed config path.
+type configPathToken struct {
+	kind  configPathTokenKind
+	key   string
+	fold  string
+	index int
+}
+
+// String returns the token as it would appear in a canonical path.
+func (t configPathToken) String() string {
+	switch t.kind {
+	case indexConfigPathToken:
+		return fmt.Sprintf("[%d]", t.index)
+	case wildcardConfigPathToken:
+		return "*"
+	}
+	return quoteConfigPathKey(t.key)
+}
+
+// configPathTokensString returns the canonical path formed by tokens.
+func configPathTokensString(tokens []configPathToken) string {
+	w := &bytes.Buffer{}
+	for i, t := range tokens {
+		if i > 0 && t.kind != indexConfigPathToken {
+			w.WriteByte('.')
+		}
+		w.WriteString(t.String())
+	}
+	return w.String()
+}
+
+// parseConfigPath parses a config path into its tokens. The grammar of
+// a path is a series of segments separated by dots, where each segment
+// is one of:
+//
+//	key      a bare key, ex. servers. A backslash escapes the
+//	         character that follows it, ex. csi\.storage
+//
+//	"key"    a quoted key that may contain dots, ex.
+//	         params."csi.storage.k8s.io". A backslash escapes
+//	         the character that follows it, ex. "a\"b"
+//
+//	*        a wildcard that matches every child of a value
+//
+// Each segment may be followed by one or more indexes in brackets, ex.
+// addrs[1] or servers[*]. A path may also begin with an index.
+func parseConfigPath(path string) ([]configPathToken, error) {
+	var (
+		tokens []configPathToken
+		fail   = func(format string, args ...interface{}) error {
+			return &ConfigPathError{Path: path, Message: fmt.Sprintf(format, args...)}
+		}
+	)
+	if path == "" {
+		return nil, fail("empty path")
+	}
+
+	for i := 0; i < len(path); {
+
+		// parse the segment's key unless the segment begins with an index
+		if path[i] != '[' {
+			var (
+				quoted = path[i] == '"'
+
+				// escaped holds the key once an escape character is
+				// encountered; otherwise the key is a slice of the path
+				escaped []byte
+			)
+			if quoted {
+				i++
+			}
+			start := i
+			for ; i < len(path); i++ {
+				c := path[i]
+				if c == '\\' {
+					if i+1 == len(path) {
+						return nil, fail("trailing escape character")
+					}
+					if escaped == nil {
+						escaped = append([]byte{}, path[start:i]...)
+					}
+					i++
+					escaped = append(escaped, path[i])
+					continue
+				}
+				if quoted && c == '"' {
+					break
+				}
+				if !quoted && (c == '.' || c == '[') {
+					break
+				}
+				if !quoted && (c == ']' || c == '"') {
+					return nil, fail("unexpected %q at offset %d", c, i)
+				}
+				if escaped != nil {
+					escaped = append(escaped, c)
+				}
+			}
+			key := path[start:i]
+			if escaped != nil {
+				key = string(escaped)
+			}
+			if quoted {
+				if i == len(path) {
+					return nil, fail("unterminated quoted segment")
+				}
+				i++
+			} else if key == "" {
+				return nil, fail("empty segment at offset %d", i)
+			}
+			if !quoted && escaped == nil && key == "*" {
+				tokens = append(tokens, configPathToken{
+					kind: wildcardConfigPathToken})
+			} else {
+				tokens = append(tokens, configPathToken{
+					key: key, fold: strings.ToLower(key)})
+			}
+		}
+
+		// parse the segment's indexes
+		for i < len(path) && path[i] == '[' {
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fail("unterminated index at offset %d", i)
+			}
+			sz := path[i+1 : i+end]
+			if sz == "*" {
+				tokens = append(tokens, configPathToken{
+					kind: wildcardConfigPathToken})
+			} else {
+				idx, err := strconv.Atoi(sz)
+				if err != nil || idx < 0 {
+					return nil, fail("invalid index %q at offset %d", sz, i)
+				}
+				tokens = append(tokens, configPathToken{
+					kind: indexConfigPathToken, index: idx})
+			}
+			i += end + 1
+		}
+
+		if i == len(path) {
+			break
+		}
+		if path[i] != '.' {
+			return nil, fail("unexpected %q at offset %d", path[i], i)
+		}
+		if i++; i == len(path) {
+			return nil, fail("trailing separator")
+		}
+	}
+
+	return tokens, nil
+}
+
+// ConfigPath is a compiled config path. Compiling a path that is used
+// often, such as by a request handler, avoids parsing the path and
+// deriving the names of its environment variables on each lookup. A
+// ConfigPath is safe for concurrent use.
+//
+// Only the configs returned by ConfigLayers.Merge and ConfigLoader, and
+// their scopes, are indexed, since Get does not modify the config in
+// which an index would be stored. A config created any other way, ex.
+// with json.Unmarshal, is searched by reflection on each lookup, so a
+// config that is queried on a hot path should be loaded or merged and
+// queried with a ConfigPath.
+type ConfigPath struct {
+	path   string
+	tokens []configPathToken
+	env    string
+}
+
+// CompilePath parses a config path that uses the grammar described by
+// Get and returns a ConfigPath that may be used with GetPath.
+func CompilePath(path string) (*ConfigPath, error) {
+	tokens, err := parseConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigPath{path: path, tokens: tokens, env: envVarBody(tokens)}, nil
+}
+
+// MustCompilePath is like CompilePath but panics if the path cannot be
+// parsed.
+func MustCompilePath(path string) *ConfigPath {
+	p, err := CompilePath(path)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the path from which the ConfigPath was compiled.
+func (p *ConfigPath) String() string {
+	return p.path
+}
+
+// GetPath is like Get but for a compiled path.
+func (c Config) GetPath(ctx context.Context, p *ConfigPath) interface{} {
+	v, _ := c.GetPathE(ctx, p)
+	return v
+}
+
+// GetPathE is like GetE but for a compiled path.
+func (c Config) GetPathE(
+	ctx context.Context, p *ConfigPath) (interface{}, error) {
+
+	v := c.getPath(ctx, p, true)
+	if v == nil {
+		return nil, &ConfigNotFoundError{Path: c.FullPath(ctx, p.path)}
+	}
+	if s, ok := v.(Secret); ok {
+		return string(s), nil
+	}
+	if !hasInterpolation(v) {
+		return v, nil
+	}
+	return c.interpolate(ctx, c.FullPath(ctx, p.path), v)
+}
+
+// quoteConfigPathKey returns the key as a path segment. A key that
+// cannot appear as a bare segment is quoted.
+func quoteConfigPathKey(key string) string {
+	if key != "" && key != "*" && !strings.ContainsAny(key, `."[]\`) {
+		return key
+	}
+	w := &bytes.Buffer{}
+	w.WriteByte('"')
+	for i := 0; i < len(key); i++ {
+		if key[i] == '"' || key[i] == '\\' {
+			w.WriteByte('\\')
+		}
+		w.WriteByte(key[i])
+	}
+	w.WriteByte('"')
+	return w.String()
+}
+
+// ConfigPathValue is a value matched by GetAll.
+type ConfigPathValue struct {
+	// Path is the concrete path of the value relative to the Config
+	// instance from which it was matched.
+	Path string `json:"path"`
+
+	// Value is the value.
+	Value interface{} `json:"value"`
+}
+
+// GetAll returns the values that match the provided pattern, or nil
+// if the pattern is invalid or a matched value cannot be interpolated.
+// Please see GetAllE.
+func (c Config) GetAll(ctx context.Context, pattern string) []ConfigPathValue {
+	v, _ := c.GetAllE(ctx, pattern)
+	return v
+}
+
+// GetAllE returns the values that match the provided pattern along
+// with their concrete paths. The pattern uses the same grammar as Get,
+// and a wildcard segment, ex. servers.*.addrs, matches every key of a
+// map, every element of an array, and every field of a struct. Keys are
+// matched in sorted order and array elements in index order. An array
+// element that has a name is matched by its name, ex. servers.svr00,
+// otherwise by its index, ex. addrs[0].
+//
+// Each matched value is subject to the same environment variable
+// overrides and interpolation as Get. If the Config instance has no
+// matching values then its parent is consulted.
+func (c Config) GetAllE(
+	ctx context.Context, pattern string) ([]ConfigPathValue, error) {
+
+	tokens, err := parseConfigPath(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var matches []ConfigPathValue
+	for cur := c; cur != nil; cur = cur.Parent(ctx) {
+		matchConfigPath(cur, tokens, "", func(path string, v interface{}) {
+			matches = append(matches, ConfigPathValue{Path: path, Value: v})
+		})
+		if len(matches) == 0 {
+			continue
+		}
+		for i := range matches {
+			m := &matches[i]
+			if _, ev, ok := cur.lookupEnv(ctx, m.Path); ok {
+				m.Value = ev
+			}
+			if s, ok := m.Value.(Secret); ok {
+				m.Value = string(s)
+				continue
+			}
+			if m.Value, err = cur.interpolate(
+				ctx, cur.FullPath(ctx, m.Path), m.Value); err != nil {
+				return nil, err
+			}
+		}
+		return matches, nil
+	}
+	return nil, nil
+}
+
+// matchConfigPath calls f with the concrete path and value of each value
+// inside of cur that matches the tokens.
+func matchConfigPath(
+	cur interface{},
+	tokens []configPathToken,
+	path string,
+	f func(path string, v interface{})) {
+
+	if len(tokens) == 0 {
+		f(path, cur)
+		return
+	}
+	if cur == nil {
+		return
+	}
+	tok, tokens := tokens[0], tokens[1:]
+	if tok.kind != wildcardConfigPathToken {
+		if next := lookupConfigPathToken(cur, tok); next != nil {
+			if tok.kind == indexConfigPathToken {
+				path += tok.String()
+			} else {
+				path = joinConfigPath(path, tok.key)
+			}
+			matchConfigPath(next, tokens, path, f)
+		}
+		return
+	}
+
+	curVal := derefValue(reflect.ValueOf(cur))
+	switch curVal.Kind() {
+	case reflect.Map:
+		keys := map[string]reflect.Value{}
+		szKeys := make(map[string]interface{}, curVal.Len())
+		for _, k := range curVal.MapKeys() {
+			sz := toString(derefValue(k).Interface())
+			if isConfigMetaKey(sz) {
+				continue
+			}
+			keys[sz], szKeys[sz] = k, nil
+		}
+		for _, sz := range sortedKeys(szKeys) {
+			matchConfigPath(
+				curVal.MapIndex(keys[sz]).Interface(), tokens,
+				joinConfigPath(path, sz), f)
+		}
+	case reflect.Array, reflect.Slice:
+		for x := 0; x < curVal.Len(); x++ {
+			el := curVal.Index(x).Interface()
+			matchConfigPath(el, tokens, elementPath(path, x, el), f)
+		}
+	case reflect.Struct:
+		for _, fld := range structFields(curVal) {
+			matchConfigPath(
+				fld.value.Interface(), tokens, joinConfigPath(path, fld.name), f)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config paths", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal(
+			exampleConfigJSON,
+			&config)).ShouldNot(HaveOccurred())
+		Ω(config.Set(ctx, `params."csi.storage.k8s.io"`, "fstype")).Should(
+			Succeed())
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("should get array elements by index", func() {
+		Ω(config.Get(ctx, "servers.svr01.addrs[1]")).Should(
+			Equal("unix:///tmp/lsx/run/csi.sock"))
+		Ω(config.Get(ctx, "servers[0].name")).Should(Equal("svr00"))
+		Ω(config.Get(ctx, "modules[2].names[0]")).Should(Equal("libstorage"))
+		Ω(config.Get(ctx, "servers.svr01.addrs[2]")).Should(BeNil())
+	})
+
+	It("should get keys that contain dots", func() {
+		Ω(config.Get(ctx, `params."csi.storage.k8s.io"`)).Should(
+			Equal("fstype"))
+		Ω(config.Get(ctx, `params.csi\.storage\.k8s\.io`)).Should(
+			Equal("fstype"))
+		Ω(config.Get(ctx, "params.csi.storage.k8s.io")).Should(BeNil())
+		Ω(config.Get(ctx, "params")).Should(
+			HaveKeyWithValue("csi.storage.k8s.io", "fstype"))
+	})
+
+	It("should keep matching names and struct fields", func() {
+		Ω(config.Get(ctx, "servers.svr00.type")).Should(Equal("libstorage"))
+		Ω(config.Get(ctx, "SERVICES.SVC00.API.VOLUME.MOUNT.TYPE")).Should(
+			Equal("libstorage"))
+		Ω(config.Set(ctx, "s", struct{ Name, Type string }{"a", "b"})).Should(
+			Succeed())
+		Ω(config.Get(ctx, "s.type")).Should(Equal("b"))
+	})
+
+	It("should return an error for an invalid path", func() {
+		for _, path := range []string{
+			"", "servers.", "servers..svr00", `params."a.b`,
+			"addrs[x]", "addrs[1", `a\`,
+		} {
+			_, err := config.GetE(ctx, path)
+			Ω(err).Should(BeAssignableToTypeOf(&lsx.ConfigPathError{}), path)
+			Ω(config.Get(ctx, path)).Should(BeNil())
+		}
+	})
+
+	It("should set values by index and quoted keys", func() {
+		Ω(config.Set(ctx, "servers.svr01.addrs[0]", "tcp://:1")).Should(
+			Succeed())
+		Ω(config.Get(ctx, "servers.svr01.addrs")).Should(Equal(
+			[]interface{}{"tcp://:1", "unix:///tmp/lsx/run/csi.sock"}))
+		Ω(config.Set(ctx, "servers.svr01.addrs[2]", "tcp://:2")).Should(
+			Succeed())
+		Ω(config.Get(ctx, "servers.svr01.addrs[2]")).Should(Equal("tcp://:2"))
+		Ω(config.Set(ctx, "servers.svr01.addrs[4]", "x")).ShouldNot(
+			Succeed())
+		Ω(config.Set(ctx, "a.b[0].c", "d")).Should(Succeed())
+		Ω(config.Get(ctx, "a.b[0].c")).Should(Equal("d"))
+		Ω(config.Delete(ctx, "servers.svr01.addrs[0]")).Should(Succeed())
+		Ω(config.Get(ctx, "servers.svr01.addrs[0]")).Should(
+			Equal("unix:///tmp/lsx/run/csi.sock"))
+		Ω(config.Set(ctx, "servers.*.type", "x")).ShouldNot(Succeed())
+	})
+
+	It("should get all of the values that match a wildcard", func() {
+		Ω(config.GetAll(ctx, "servers.*.addrs[0]")).Should(Equal(
+			[]lsx.ConfigPathValue{
+				{Path: "servers.svr00.addrs[0]", Value: "tcp://127.0.0.1:7979"},
+				{Path: "servers.svr01.addrs[0]", Value: "tcp://127.0.0.1:8989"},
+			}))
+		Ω(config.GetAll(ctx, "servers[*].type")).Should(Equal(
+			[]lsx.ConfigPathValue{
+				{Path: "servers.svr00.type", Value: "libstorage"},
+				{Path: "servers.svr01.type", Value: "csi"},
+			}))
+		Ω(config.GetAll(ctx, "logging.*")).Should(Equal(
+			[]lsx.ConfigPathValue{
+				{Path: "logging.level", Value: "debug"},
+				{Path: "logging.requests", Value: true},
+				{Path: "logging.responses", Value: true},
+			}))
+		Ω(config.GetAll(ctx, "params.*")).Should(Equal(
+			[]lsx.ConfigPathValue{
+				{Path: `params."csi.storage.k8s.io"`, Value: "fstype"},
+			}))
+		Ω(config.GetAll(ctx, "modules.*.path")).Should(HaveLen(5))
+		Ω(config.GetAll(ctx, "servers.*.missing")).Should(BeEmpty())
+	})
+
+	It("should get all of the values from a scope or its parent", func() {
+		svc := config.Scope(ctx, "services.svc00")
+		Ω(svc.GetAll(ctx, "logging.level")).Should(Equal(
+			[]lsx.ConfigPathValue{{Path: "logging.level", Value: "info"}}))
+		Ω(svc.GetAll(ctx, "servers.*")).Should(Equal(
+			[]lsx.ConfigPathValue{
+				{Path: "servers[0]", Value: "svr00"},
+				{Path: "servers[1]", Value: "svr01"},
+			}))
+		Ω(svc.GetAll(ctx, "modules[*].names[*]")).Should(HaveLen(4))
+	})
+
+	It("should apply env overrides and interpolation to matches", func() {
+		Ω(config.Set(ctx, "servers.svr00.type", "${ref:logging.level}")).
+			Should(Succeed())
+		Ω(config.GetAll(ctx, "servers.*.type")[0].Value).Should(Equal("debug"))
+		os.Setenv("LSX_SERVERS_SVR01_TYPE", "nfs")
+		defer os.Unsetenv("LSX_SERVERS_SVR01_TYPE")
+		Ω(config.GetAll(ctx, "servers.*.type")[1].Value).Should(Equal("nfs"))
+		_, err := config.GetAllE(ctx, "servers.*.")
+		Ω(err).Should(HaveOccurred())
+	})
+})
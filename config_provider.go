@@ -0,0 +1,455 @@
+package lsx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ConfigProvider is the interface implemented by config modules, please
+// see ConfigModuleType. A config provider is a source of configuration
+// information, such as a file or an HTTP endpoint.
+//
+// When the provider's Init function is invoked, the context stores the
+// provider's scope of the bootstrap config with ConfigKey, ex. the
+// element of the bootstrap config's "configs" array whose "type" is the
+// name of the provider. Please see NewConfigProviders.
+type ConfigProvider interface {
+	Module
+
+	// Load loads the provider's configuration information. The context
+	// stores the config merged from the layers below the provider's
+	// layer with ConfigKey.
+	Load(ctx context.Context) (Config, error)
+}
+
+// ConfigProviderWatcher is an optional interface implemented by config
+// providers that can detect changes to their configuration information.
+type ConfigProviderWatcher interface {
+	// Watch returns a channel on which the provider's config is
+	// received each time it changes. The channel is closed when the
+	// provided context is cancelled.
+	Watch(ctx context.Context) (<-chan Config, error)
+}
+
+// NewConfigProviders returns the config providers listed in the
+// "configs" array of the bootstrap config, in the order they are
+// listed, ex.
+//
+//	"configs": [
+//	    {"type": "file", "path": "/etc/lsx/config.json"},
+//	    {"type": "dir", "path": "/etc/lsx/conf.d"},
+//	    {"type": "http", "url": "http://config/lsx.json"},
+//	    {"type": "env"}
+//	]
+//
+// Each element's "type" is the name of a config module registered with
+// the registry stored in the context, please see WithRegistry, and each
+// provider is initialized with the element as its scope.
+func NewConfigProviders(
+	ctx context.Context, bootstrap Config) ([]ConfigProvider, error) {
+
+	elems, _ := bootstrap.Get(ctx, ConfigModuleType.configKey()).([]interface{})
+	providers := make([]ConfigProvider, 0, len(elems))
+	for i := range elems {
+		scopePath := fmt.Sprintf("%s[%d]", ConfigModuleType.configKey(), i)
+		scope := bootstrap.Scope(ctx, scopePath)
+		if scope == nil {
+			return nil, fmt.Errorf(
+				"error: invalid config provider: %s: expected object",
+				scopePath)
+		}
+		name := scope.GetStr(ctx, "type")
+		mod := ContextRegistry(ctx).New(ConfigModuleType, name)
+		if mod == nil {
+			return nil, fmt.Errorf(
+				"error: unknown config provider: %s: %q", scopePath, name)
+		}
+		p, ok := mod.(ConfigProvider)
+		if !ok {
+			return nil, fmt.Errorf(
+				"error: invalid config provider: %s: %s is not a provider",
+				scopePath, name)
+		}
+		if err := p.Init(context.WithValue(ctx, ConfigKey, scope)); err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// configProviderSource returns the source of the layer loaded from the
+// provider, which is the provider's string representation if it has
+// one, or the provider's name otherwise.
+func configProviderSource(p ConfigProvider) string {
+	if s, ok := p.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return p.Name()
+}
+
+// newProviderConfigLayer returns the layer of the config loaded by the
+// provider. The layer remembers the origins and the key order recorded
+// by the config, so the values of a file provider are still explained
+// by the file from which they were read.
+func newProviderConfigLayer(p ConfigProvider, config Config) *ConfigLayer {
+	layer := &ConfigLayer{
+		Kind:   ProviderConfigLayer,
+		Source: configProviderSource(p),
+		Config: copyConfig(config),
+	}
+	if meta, ok := config[configMetaKey].(*configMeta); ok {
+		layer.origins = meta.origins
+		layer.order = meta.order
+	}
+	return layer
+}
+
+// configProviderScope returns the provider's scope of the bootstrap
+// config that is stored in the context with ConfigKey.
+func configProviderScope(ctx context.Context, name string) (Config, error) {
+	scope, ok := ctx.Value(ConfigKey).(Config)
+	if !ok {
+		return nil, fmt.Errorf("error: invalid config provider: %s: "+
+			"missing config", name)
+	}
+	return scope, nil
+}
+
+func init() {
+	MustRegisterModule(ConfigModuleType, "file",
+		func() Module { return &fileConfigProvider{} },
+		ModuleConfigKey{
+			Path:        "path",
+			Type:        "string",
+			Description: "The path to a config file or an inline config document.",
+		})
+	MustRegisterModule(ConfigModuleType, "dir",
+		func() Module { return &dirConfigProvider{} },
+		ModuleConfigKey{
+			Path:        "path",
+			Type:        "string",
+			Description: "The path to a conf.d directory of config files.",
+		})
+	MustRegisterModule(ConfigModuleType, "env",
+		func() Module { return &envConfigProvider{} })
+	MustRegisterModule(ConfigModuleType, "http",
+		func() Module { return &httpConfigProvider{} },
+		ModuleConfigKey{
+			Path:        "url",
+			Type:        "string",
+			Description: "The URL of a config document.",
+		},
+		ModuleConfigKey{
+			Path:        "interval",
+			Type:        "string",
+			Default:     "30s",
+			Description: "How often the URL is polled for changes.",
+		},
+		ModuleConfigKey{
+			Path:        "timeout",
+			Type:        "string",
+			Default:     "10s",
+			Description: "How long a request for the URL may take.",
+		},
+		ModuleConfigKey{
+			Path:    "trusted",
+			Type:    "boolean",
+			Default: false,
+			Description: "Whether the ${env:...} and ${file:...} expressions " +
+				"in the document are expanded.",
+		})
+}
+
+// fileConfigProvider loads a config file and the fragments it includes.
+type fileConfigProvider struct {
+	path string
+}
+
+func (p *fileConfigProvider) Name() string   { return "file" }
+func (p *fileConfigProvider) Type() string   { return ConfigModuleType.String() }
+func (p *fileConfigProvider) String() string { return p.path }
+
+func (p *fileConfigProvider) Init(ctx context.Context) error {
+	scope, err := configProviderScope(ctx, p.Name())
+	if err != nil {
+		return err
+	}
+	if p.path = scope.GetStr(ctx, "path"); p.path == "" {
+		return fmt.Errorf("error: invalid config provider: file: missing path")
+	}
+	return nil
+}
+
+func (p *fileConfigProvider) Load(ctx context.Context) (Config, error) {
+	layers, err := loadConfigFileTree(p.path, FileConfigLayer)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConfigLayerKeys(layers); err != nil {
+		return nil, err
+	}
+	return layers.Merge(ctx), nil
+}
+
+func (p *fileConfigProvider) Watch(ctx context.Context) (<-chan Config, error) {
+	return watchConfigLoader(ctx, &ConfigLoader{Files: []string{p.path}})
+}
+
+// dirConfigProvider loads the config files in a conf.d directory.
+type dirConfigProvider struct {
+	path string
+}
+
+func (p *dirConfigProvider) Name() string   { return "dir" }
+func (p *dirConfigProvider) Type() string   { return ConfigModuleType.String() }
+func (p *dirConfigProvider) String() string { return p.path }
+
+func (p *dirConfigProvider) Init(ctx context.Context) error {
+	scope, err := configProviderScope(ctx, p.Name())
+	if err != nil {
+		return err
+	}
+	if p.path = scope.GetStr(ctx, "path"); p.path == "" {
+		return fmt.Errorf("error: invalid config provider: dir: missing path")
+	}
+	return nil
+}
+
+func (p *dirConfigProvider) Load(ctx context.Context) (Config, error) {
+	layers, err := loadConfigDir(p.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConfigLayerKeys(layers); err != nil {
+		return nil, err
+	}
+	return layers.Merge(ctx), nil
+}
+
+func (p *dirConfigProvider) Watch(ctx context.Context) (<-chan Config, error) {
+	return watchConfigLoader(ctx, &ConfigLoader{Dirs: []string{p.path}})
+}
+
+// watchConfigLoader returns a channel on which the config loaded by the
+// loader is received each time the loader's files or directories
+// change. The channel is closed when the context is cancelled.
+func watchConfigLoader(
+	ctx context.Context, loader *ConfigLoader) (<-chan Config, error) {
+
+	w, err := NewConfigWatcher(ctx, loader)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan Config)
+	go func() {
+		defer close(c)
+		defer w.Close()
+		for change := range w.Watch(ctx, "") {
+			select {
+			case c <- change.New.(Config):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// envConfigProvider loads the values of the environment variables named
+// after the paths of the values defined by the lower layers; please see
+// EnvVarName.
+type envConfigProvider struct{}
+
+func (p *envConfigProvider) Name() string { return "env" }
+func (p *envConfigProvider) Type() string { return ConfigModuleType.String() }
+
+func (p *envConfigProvider) Init(ctx context.Context) error {
+	return nil
+}
+
+func (p *envConfigProvider) Load(ctx context.Context) (Config, error) {
+	lower, _ := ctx.Value(ConfigKey).(Config)
+	layer, err := loadConfigEnv(ctx, lower)
+	if err != nil {
+		return nil, err
+	}
+	return ConfigLayers{layer}.Merge(ctx), nil
+}
+
+// httpConfigProvider loads a config document from an HTTP endpoint. The
+// endpoint is polled for changes with conditional requests, so a server
+// that sets the ETag header of the document only sends the document
+// when it changes.
+//
+// The document is a remote layer, so its ${env:...} and ${file:...}
+// expressions are not expanded unless the provider is trusted; please
+// see ConfigLayer.Remote.
+type httpConfigProvider struct {
+	url      string
+	interval time.Duration
+	timeout  time.Duration
+	trusted  bool
+	client   *http.Client
+
+	mu   sync.Mutex
+	etag string
+	body []byte
+	last Config
+}
+
+func (p *httpConfigProvider) Name() string   { return "http" }
+func (p *httpConfigProvider) Type() string   { return ConfigModuleType.String() }
+func (p *httpConfigProvider) String() string { return p.url }
+
+func (p *httpConfigProvider) Init(ctx context.Context) error {
+	scope, err := configProviderScope(ctx, p.Name())
+	if err != nil {
+		return err
+	}
+	if p.url = scope.GetStr(ctx, "url"); p.url == "" {
+		return fmt.Errorf("error: invalid config provider: http: missing url")
+	}
+	if _, err := url.Parse(p.url); err != nil {
+		return fmt.Errorf("error: invalid config provider: http: %v", err)
+	}
+	if p.interval, err = scope.GetDurationE(ctx, "interval"); err != nil {
+		return fmt.Errorf("error: invalid config provider: http: %v", err)
+	}
+	if p.interval <= 0 {
+		return fmt.Errorf(
+			"error: invalid config provider: http: invalid interval: %v",
+			p.interval)
+	}
+	if p.timeout, err = scope.GetDurationE(ctx, "timeout"); err != nil {
+		return fmt.Errorf("error: invalid config provider: http: %v", err)
+	}
+	if p.timeout <= 0 {
+		return fmt.Errorf(
+			"error: invalid config provider: http: invalid timeout: %v",
+			p.timeout)
+	}
+	if p.trusted, err = scope.GetBoolE(ctx, "trusted"); err != nil {
+		return fmt.Errorf("error: invalid config provider: http: %v", err)
+	}
+	p.client = &http.Client{Timeout: p.timeout}
+	return nil
+}
+
+func (p *httpConfigProvider) Load(ctx context.Context) (Config, error) {
+	config, _, err := p.fetch(ctx)
+	return config, err
+}
+
+func (p *httpConfigProvider) Watch(ctx context.Context) (<-chan Config, error) {
+	c := make(chan Config)
+	go func() {
+		defer close(c)
+		t := time.NewTicker(p.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			config, changed, err := p.fetch(ctx)
+			if err != nil {
+				logf("error: watch config failed: %v", err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+			select {
+			case c <- config:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// fetch requests the document with the ETag of the last document that
+// was received, and returns the config along with a flag indicating
+// whether the document changed since the last request.
+func (p *httpConfigProvider) fetch(ctx context.Context) (Config, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	req, err := http.NewRequest(http.MethodGet, p.url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("error: fetch config failed: %v", err)
+	}
+	req = req.WithContext(ctx)
+	if p.etag != "" && p.last != nil {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("error: fetch config failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotModified:
+		// the document is only requested conditionally once one was
+		// received, so there is no document to reuse otherwise
+		if p.last == nil {
+			return nil, false, fmt.Errorf(
+				"error: fetch config failed: %s: %s without a document",
+				p.url, res.Status)
+		}
+		return copyProviderConfig(p.last), false, nil
+	case http.StatusOK:
+	default:
+		return nil, false, fmt.Errorf(
+			"error: fetch config failed: %s: %s", p.url, res.Status)
+	}
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("error: fetch config failed: %v", err)
+	}
+	if p.last != nil && bytes.Equal(buf, p.body) {
+		p.etag = res.Header.Get("ETag")
+		return copyProviderConfig(p.last), false, nil
+	}
+
+	var name string
+	if u, err := url.Parse(p.url); err == nil {
+		name = u.Path
+	}
+	layer, err := decodeConfigLayer(buf, DetectConfigFormat(name, buf))
+	if err != nil {
+		return nil, false, fmt.Errorf(
+			"error: invalid config document: %s: %v", p.url, err)
+	}
+	layer.Kind, layer.Source = ProviderConfigLayer, p.url
+	layer.Remote = !p.trusted
+	if err := checkConfigLayerKeys(ConfigLayers{layer}); err != nil {
+		return nil, false, err
+	}
+
+	p.etag, p.body = res.Header.Get("ETag"), buf
+	p.last = ConfigLayers{layer}.Merge(ctx)
+	return copyProviderConfig(p.last), true, nil
+}
+
+// copyProviderConfig returns a copy of a config loaded by a provider
+// that shares the config's origins and key order, so the caller may
+// modify the copy.
+func copyProviderConfig(config Config) Config {
+	c := copyConfig(config)
+	if meta, ok := config[configMetaKey].(*configMeta); ok {
+		c[configMetaKey] = &configMeta{origins: meta.origins, order: meta.order}
+	}
+	return c
+}
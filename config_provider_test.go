@@ -0,0 +1,367 @@
+package lsx_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akutz/lsx"
+)
+
+// staticConfigProvider is a test config provider that loads a fixed
+// config.
+type staticConfigProvider struct{}
+
+func (p *staticConfigProvider) Name() string                   { return "static" }
+func (p *staticConfigProvider) Type() string                   { return "config" }
+func (p *staticConfigProvider) Init(ctx context.Context) error { return nil }
+
+func (p *staticConfigProvider) Load(ctx context.Context) (lsx.Config, error) {
+	return lsx.Config{"logging": map[string]interface{}{"level": "warn"}}, nil
+}
+
+var _ = Describe("ConfigProvider", func() {
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		tmpDir string
+	)
+
+	newProviders := func(configs ...interface{}) ([]lsx.ConfigProvider, error) {
+		return lsx.NewConfigProviders(ctx, lsx.Config{"configs": configs})
+	}
+
+	BeforeEach(func() {
+		var err error
+		ctx, cancel = context.WithCancel(context.Background())
+		tmpDir, err = ioutil.TempDir("", "lsx-config-provider")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ioutil.WriteFile(
+			filepath.Join(tmpDir, "config.json"),
+			exampleConfigJSON, 0644)).Should(Succeed())
+		confDir := filepath.Join(tmpDir, "conf.d")
+		Ω(os.Mkdir(confDir, 0755)).Should(Succeed())
+		Ω(ioutil.WriteFile(
+			filepath.Join(confDir, "10-logging.json"),
+			[]byte(`{"logging":{"level":"warn"}}`),
+			0644)).Should(Succeed())
+	})
+	AfterEach(func() {
+		cancel()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("should create the providers in order", func() {
+		providers, err := newProviders(
+			map[string]interface{}{
+				"type": "file",
+				"path": filepath.Join(tmpDir, "config.json"),
+			},
+			map[string]interface{}{
+				"type": "dir",
+				"path": filepath.Join(tmpDir, "conf.d"),
+			},
+			map[string]interface{}{"type": "env"},
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(providers).Should(HaveLen(3))
+		Ω(providers[0].Name()).Should(Equal("file"))
+		Ω(providers[1].Name()).Should(Equal("dir"))
+		Ω(providers[2].Name()).Should(Equal("env"))
+		Ω(providers[2].Type()).Should(Equal("config"))
+	})
+	It("should reject an unknown provider", func() {
+		_, err := newProviders(map[string]interface{}{"type": "ftp"})
+		Ω(err).Should(MatchError(
+			`error: unknown config provider: configs[0]: "ftp"`))
+	})
+	It("should create the providers of the context's registry", func() {
+		_, err := newProviders(map[string]interface{}{"type": "static"})
+		Ω(err).Should(HaveOccurred())
+
+		r := &lsx.Registry{}
+		r.MustRegister(lsx.ConfigModuleType, "static", func() lsx.Module {
+			return &staticConfigProvider{}
+		})
+		ctx = lsx.WithRegistry(ctx, r)
+		providers, err := newProviders(map[string]interface{}{"type": "static"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(providers).Should(HaveLen(1))
+		config, err := providers[0].Load(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("warn"))
+		_, err = newProviders(map[string]interface{}{"type": "file"})
+		Ω(err).Should(MatchError(
+			`error: unknown config provider: configs[0]: "file"`))
+	})
+	It("should reject a provider with missing settings", func() {
+		_, err := newProviders(map[string]interface{}{"type": "file"})
+		Ω(err).Should(MatchError(
+			"error: invalid config provider: file: missing path"))
+	})
+
+	Context("ConfigLoader", func() {
+		It("should merge the providers' layers in order", func() {
+			providers, err := newProviders(
+				map[string]interface{}{
+					"type": "file",
+					"path": filepath.Join(tmpDir, "config.json"),
+				},
+				map[string]interface{}{
+					"type": "dir",
+					"path": filepath.Join(tmpDir, "conf.d"),
+				},
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			loader := &lsx.ConfigLoader{
+				Defaults: lsx.Config{
+					"logging": map[string]interface{}{"format": "text"},
+				},
+				Providers: providers,
+			}
+			config, layers, err := loader.Load(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(layers.ByKind(lsx.ProviderConfigLayer)).Should(HaveLen(2))
+			Ω(config.Get(ctx, "logging.level")).Should(Equal("warn"))
+			Ω(config.Get(ctx, "logging.format")).Should(Equal("text"))
+			Ω(config.Get(ctx, "servers")).Should(HaveLen(2))
+		})
+		It("should explain values by their original source", func() {
+			file := filepath.Join(tmpDir, "config.json")
+			providers, err := newProviders(map[string]interface{}{
+				"type": "file",
+				"path": file,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			loader := &lsx.ConfigLoader{Providers: providers}
+			config, _, err := loader.Load(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			e := config.Explain(ctx, "logging.level")
+			o := e.Steps[len(e.Steps)-1].Origin
+			Ω(o.Layer).Should(Equal(lsx.FileConfigLayer))
+			Ω(o.Source).Should(Equal(file))
+			Ω(o.Line).Should(Equal(3))
+		})
+		It("should resolve env vars against the lower layers", func() {
+			os.Setenv("LSX_LOGGING_LEVEL", "error")
+			defer os.Unsetenv("LSX_LOGGING_LEVEL")
+			providers, err := newProviders(
+				map[string]interface{}{
+					"type": "file",
+					"path": filepath.Join(tmpDir, "config.json"),
+				},
+				map[string]interface{}{"type": "env"},
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			loader := &lsx.ConfigLoader{Providers: providers}
+			_, layers, err := loader.Load(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(layers).Should(HaveLen(2))
+			Ω(layers[1].Config.Get(ctx, "logging.level")).Should(
+				Equal("error"))
+			Ω(layers[1].Config.Len()).Should(Equal(1))
+		})
+	})
+
+	Context("http", func() {
+
+		var (
+			srv      *httptest.Server
+			mu       sync.Mutex
+			doc      string
+			requests int32
+			notMod   int32
+		)
+
+		setDoc := func(v string) {
+			mu.Lock()
+			defer mu.Unlock()
+			doc = v
+		}
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&requests, 0)
+			atomic.StoreInt32(&notMod, 0)
+			setDoc(`{"logging":{"level":"debug"}}`)
+			srv = httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					atomic.AddInt32(&requests, 1)
+					mu.Lock()
+					body := doc
+					mu.Unlock()
+					etag := fmt.Sprintf(`"%d"`, len(body))
+					if r.Header.Get("If-None-Match") == etag {
+						atomic.AddInt32(&notMod, 1)
+						w.WriteHeader(http.StatusNotModified)
+						return
+					}
+					w.Header().Set("ETag", etag)
+					fmt.Fprint(w, body)
+				}))
+		})
+		AfterEach(func() {
+			srv.Close()
+		})
+
+		newHTTPProvider := func(interval string) lsx.ConfigProvider {
+			providers, err := newProviders(map[string]interface{}{
+				"type":     "http",
+				"url":      srv.URL + "/config.json",
+				"interval": interval,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			return providers[0]
+		}
+
+		It("should default the polling interval", func() {
+			providers, err := newProviders(map[string]interface{}{
+				"type": "http",
+				"url":  srv.URL,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(providers).Should(HaveLen(1))
+		})
+		It("should load the document", func() {
+			config, err := newHTTPProvider("1s").Load(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Get(ctx, "logging.level")).Should(Equal("debug"))
+		})
+		It("should send the ETag of the last document", func() {
+			p := newHTTPProvider("1s")
+			_, err := p.Load(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			config, err := p.Load(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Get(ctx, "logging.level")).Should(Equal("debug"))
+			Ω(atomic.LoadInt32(&requests)).Should(Equal(int32(2)))
+			Ω(atomic.LoadInt32(&notMod)).Should(Equal(int32(1)))
+		})
+		It("should fail on an error status", func() {
+			nf := httptest.NewServer(http.NotFoundHandler())
+			defer nf.Close()
+			providers, err := newProviders(map[string]interface{}{
+				"type": "http",
+				"url":  nf.URL,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = providers[0].Load(ctx)
+			Ω(err).Should(MatchError(
+				"error: fetch config failed: " + nf.URL + ": 404 Not Found"))
+		})
+		It("should fail on an unrequested not modified status", func() {
+			nm := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusNotModified)
+				}))
+			defer nm.Close()
+			providers, err := newProviders(map[string]interface{}{
+				"type": "http",
+				"url":  nm.URL,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			_, err = providers[0].Load(ctx)
+			Ω(err).Should(MatchError("error: fetch config failed: " +
+				nm.URL + ": 304 Not Modified without a document"))
+		})
+		It("should not limit requests to the polling interval", func() {
+			slow := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(100 * time.Millisecond)
+					fmt.Fprint(w, `{"logging":{"level":"warn"}}`)
+				}))
+			defer slow.Close()
+			newSlowProvider := func(timeout string) lsx.ConfigProvider {
+				providers, err := newProviders(map[string]interface{}{
+					"type":     "http",
+					"url":      slow.URL,
+					"interval": "10ms",
+					"timeout":  timeout,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+				return providers[0]
+			}
+			config, err := newSlowProvider("10s").Load(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Get(ctx, "logging.level")).Should(Equal("warn"))
+			_, err = newSlowProvider("20ms").Load(ctx)
+			Ω(err).Should(HaveOccurred())
+		})
+		It("should not expand env and file expressions", func() {
+			os.Setenv("LSX_TEST_HTTP_SECRET", "s3cr3t")
+			defer os.Unsetenv("LSX_TEST_HTTP_SECRET")
+			setDoc(`{"logging":{"level":"${env:LSX_TEST_HTTP_SECRET}",` +
+				`"format":"${ref:logging.level}","path":"${file:/etc/hosts}"}}`)
+			load := func(trusted bool) lsx.Config {
+				providers, err := newProviders(map[string]interface{}{
+					"type":    "http",
+					"url":     srv.URL + "/config.json",
+					"trusted": trusted,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+				loader := &lsx.ConfigLoader{Providers: providers}
+				config, _, err := loader.Load(ctx)
+				Ω(err).ShouldNot(HaveOccurred())
+				return config
+			}
+
+			config := load(false)
+			_, err := config.GetE(ctx, "logging.level")
+			Ω(err).Should(MatchError("error: invalid config interpolation: " +
+				"path=logging.level, expr=${env:LSX_TEST_HTTP_SECRET}: " +
+				"env expressions are not allowed in remote configs"))
+			_, err = config.GetE(ctx, "logging.format")
+			Ω(err).Should(HaveOccurred())
+			_, err = config.GetE(ctx, "logging.path")
+			Ω(err).Should(MatchError(ContainSubstring(
+				"file expressions are not allowed in remote configs")))
+			e := config.Explain(ctx, "logging.level")
+			Ω(e.Steps[len(e.Steps)-1].Origin.Remote).Should(BeTrue())
+
+			config = load(true)
+			Ω(config.Get(ctx, "logging.level")).Should(Equal("s3cr3t"))
+			Ω(config.Get(ctx, "logging.format")).Should(Equal("s3cr3t"))
+		})
+		It("should send the document when it changes", func() {
+			p := newHTTPProvider("20ms")
+			_, err := p.Load(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			c, err := p.(lsx.ConfigProviderWatcher).Watch(ctx)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(func() int32 {
+				return atomic.LoadInt32(&notMod)
+			}).Should(BeNumerically(">", 0))
+			Consistently(c, 100*time.Millisecond).ShouldNot(Receive())
+
+			setDoc(`{"logging":{"level":"warn"}}`)
+			var config lsx.Config
+			Eventually(c).Should(Receive(&config))
+			Ω(config.Get(ctx, "logging.level")).Should(Equal("warn"))
+
+			cancel()
+			Eventually(c).Should(BeClosed())
+		})
+		It("should reload a watched config", func() {
+			loader := &lsx.ConfigLoader{
+				Providers: []lsx.ConfigProvider{newHTTPProvider("20ms")},
+			}
+			w, err := lsx.NewConfigWatcher(ctx, loader)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer w.Close()
+			levels := w.Watch(ctx, "logging.level")
+
+			setDoc(`{"logging":{"level":"warn"}}`)
+			var change lsx.ConfigChange
+			Eventually(levels, 2*time.Second).Should(Receive(&change))
+			Ω(change.Old).Should(Equal("debug"))
+			Ω(change.New).Should(Equal("warn"))
+		})
+	})
+})
@@ -0,0 +1,546 @@
+package lsx
+
+import (
+	"context"
+	// embed is imported for the config schema
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// configSchemaJSON is the JSON schema for the config.
+//
+//go:embed config_schema.json
+var configSchemaJSON []byte
+
+// ConfigSchema returns the JSON schema for the config.
+func ConfigSchema() []byte {
+	buf := make([]byte, len(configSchemaJSON))
+	copy(buf, configSchemaJSON)
+	return buf
+}
+
+var (
+	rootSchema     = mustParseSchema(configSchemaJSON)
+	modSchemas     = map[ModuleType]map[string]*jsonSchema{}
+	modSchemasRWL  = sync.RWMutex{}
+	schemaPatterns = sync.Map{}
+)
+
+// ConfigValidationError describes a value that does not adhere to the
+// config schema.
+type ConfigValidationError struct {
+	// Path is the path of the invalid value in the same dot-style
+	// notation used by Get. Array elements that are objects with a
+	// "name" field are referred to by name, and all other array
+	// elements are referred to by index, ex. servers.svr01.addrs[1].
+	Path string
+
+	// Message describes why the value is invalid.
+	Message string
+}
+
+// Error returns the error message.
+func (e *ConfigValidationError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("error: invalid config: path=%s: %s", path, e.Message)
+}
+
+// RegisterConfigSchema registers a JSON schema fragment for the config
+// sections that belong to a module.
+//
+// The fragment is applied to the following sections:
+//
+//	server          the elements of "servers" whose "type" is modName
+//
+//	service         the elements of "services" whose "type" is modName
+//
+//	client/volume   the objects in "services.*.api.volume" whose
+//	                "type" is modName
+//
+// The properties defined by the fragment are also permitted by the
+// config schema for those sections, so a module's settings are not
+// reported as unknown properties.
+func RegisterConfigSchema(
+	modType ModuleType, modName string, schema []byte) error {
+
+	s, err := parseSchema(schema)
+	if err != nil {
+		return fmt.Errorf(
+			"error: invalid schema: type=%s, name=%s: %v",
+			modType, modName, err)
+	}
+	modSchemasRWL.Lock()
+	defer modSchemasRWL.Unlock()
+	m, ok := modSchemas[modType]
+	if !ok {
+		m = map[string]*jsonSchema{}
+		modSchemas[modType] = m
+	}
+	m[modName] = s
+	return nil
+}
+
+// Validate validates the config against the config schema and the
+// schema fragments registered by modules. If the Config instance is
+// scoped then the root Config instance is validated. The values are
+// validated after their expressions are interpolated.
+//
+// All of the invalid values are reported by a single MultiError that
+// contains a ConfigValidationError for each of the values, including
+// the values with expressions that cannot be interpolated, the map keys
+// that differ from another key in the same map only in case, and the
+// array elements with duplicate names.
+func (c Config) Validate(ctx context.Context) error {
+	v := &schemaValidator{extraProps: map[string]map[string]bool{}}
+
+	resolved, err := c.Resolve(ctx)
+	if err != nil {
+		for _, err := range err.(MultiError) {
+			ie := err.(*ConfigInterpolationError)
+			v.fail(ie.Path, "%s: %v", ie.Expr, ie.Err)
+		}
+	}
+	m, _ := toStringMap(resolved)
+
+	// collect the module schemas for the config's sections so that the
+	// properties they define are permitted by the root schema
+	type section struct {
+		path   string
+		value  interface{}
+		schema *jsonSchema
+	}
+	var sections []section
+	modSchemasRWL.RLock()
+	for _, s := range configModuleSections(m) {
+		schema, ok := modSchemas[s.Type][s.Name]
+		if !ok {
+			continue
+		}
+		sections = append(sections, section{s.Path, s.Value, schema})
+		props := v.extraProps[s.Path]
+		if props == nil {
+			props = map[string]bool{}
+			v.extraProps[s.Path] = props
+		}
+		for k := range schema.props() {
+			props[strings.ToLower(k)] = true
+		}
+	}
+	modSchemasRWL.RUnlock()
+
+	checkConfigKeys(m, "", "", &v.errs)
+	v.validate(rootSchema, rootSchema.node, m, "")
+	for _, s := range sections {
+		v.validate(s.schema, s.schema.node, s.value, s.path)
+	}
+
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		return v.errs[i].(*ConfigValidationError).Path <
+			v.errs[j].(*ConfigValidationError).Path
+	})
+	return v.errs.ErrOrNil()
+}
+
+// configModuleSection is a section of the config that is handled by a
+// module.
+type configModuleSection struct {
+	Type  ModuleType
+	Name  string
+	Path  string
+	Value interface{}
+}
+
+// configModuleSections returns the sections of the config that are
+// handled by modules.
+func configModuleSections(m map[string]interface{}) []configModuleSection {
+	var sections []configModuleSection
+
+	for _, svr := range namedElements(m, "servers") {
+		if typ, ok := svr.value["type"].(string); ok {
+			sections = append(sections, configModuleSection{
+				ServerModuleType, typ, "servers." + svr.name, svr.value,
+			})
+		}
+	}
+
+	for _, svc := range namedElements(m, "services") {
+		if typ, ok := svc.value["type"].(string); ok {
+			sections = append(sections, configModuleSection{
+				ServiceModuleType, typ, "services." + svc.name, svc.value,
+			})
+		}
+		api, _ := svc.value["api"].(map[string]interface{})
+		vol, _ := api["volume"].(map[string]interface{})
+		for _, op := range sortedKeys(vol) {
+			opm, ok := vol[op].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			typ, ok := opm["type"].(string)
+			if !ok {
+				continue
+			}
+			path := "services." + svc.name + ".api.volume." + op
+			sections = append(sections,
+				configModuleSection{ClientModuleType, typ, path, opm},
+				configModuleSection{VolumeModuleType, typ, path, opm})
+		}
+	}
+
+	return sections
+}
+
+type namedElement struct {
+	name  string
+	value map[string]interface{}
+}
+
+// namedElements returns the elements of the array at m[key] that are
+// objects with a "name" field.
+func namedElements(m map[string]interface{}, key string) []namedElement {
+	a, _ := m[key].([]interface{})
+	var els []namedElement
+	for _, e := range a {
+		em, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, ok := em["name"].(string); ok && name != "" {
+			els = append(els, namedElement{name, em})
+		}
+	}
+	return els
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonSchema is a parsed JSON schema document.
+type jsonSchema struct {
+	node map[string]interface{}
+}
+
+func mustParseSchema(buf []byte) *jsonSchema {
+	s, err := parseSchema(buf)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func parseSchema(buf []byte) (*jsonSchema, error) {
+	var node map[string]interface{}
+	if err := json.Unmarshal(buf, &node); err != nil {
+		return nil, err
+	}
+	return &jsonSchema{node: node}, nil
+}
+
+// resolve follows a node's local "$ref", if any.
+func (s *jsonSchema) resolve(node map[string]interface{}) map[string]interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := node["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#") {
+			return node
+		}
+		var cur interface{} = s.node
+		for _, tok := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+			if tok == "" {
+				continue
+			}
+			m, _ := cur.(map[string]interface{})
+			cur = m[tok]
+		}
+		next, ok := cur.(map[string]interface{})
+		if !ok {
+			return map[string]interface{}{}
+		}
+		node = next
+	}
+	return node
+}
+
+// props returns the properties defined by the schema's root node.
+func (s *jsonSchema) props() map[string]interface{} {
+	props, _ := s.resolve(s.node)["properties"].(map[string]interface{})
+	return props
+}
+
+// schemaValidator validates values against the subset of the JSON
+// schema specification used by the config schema.
+type schemaValidator struct {
+	errs MultiError
+
+	// extraProps are the properties that are permitted at a path in
+	// addition to those defined by the schema. The keys of the inner
+	// maps are lower-case.
+	extraProps map[string]map[string]bool
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ConfigValidationError{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return quoteConfigPathKey(key)
+	}
+	return path + "." + quoteConfigPathKey(key)
+}
+
+// elementPath returns the path of an array element. An element that
+// is an object with a "name" field is referred to by its name so that
+// the path may be used with Get.
+func elementPath(path string, i int, el interface{}) string {
+	if m, ok := el.(map[string]interface{}); ok {
+		if name, ok := m["name"].(string); ok && name != "" {
+			return joinConfigPath(path, name)
+		}
+	}
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// validate validates the value against the schema node and returns
+// the number of errors that occurred.
+func (v *schemaValidator) validate(
+	s *jsonSchema,
+	node map[string]interface{},
+	value interface{},
+	path string) int {
+
+	n := len(v.errs)
+	node = s.resolve(node)
+	if secret, ok := value.(Secret); ok {
+		value = string(secret)
+	}
+
+	if t, ok := node["type"]; ok && !schemaTypeMatches(t, value) {
+		v.fail(path, "expected %s, actual %s",
+			schemaTypeString(t), jsonTypeOf(value))
+		return len(v.errs) - n
+	}
+
+	if enum, ok := node["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "value must be one of %s", toString(enum))
+		}
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, ok := node[key].([]interface{})
+		if !ok {
+			continue
+		}
+		matched := 0
+		for _, sub := range subs {
+			subNode, _ := sub.(map[string]interface{})
+			sv := &schemaValidator{extraProps: v.extraProps}
+			if sv.validate(s, subNode, value, path) == 0 {
+				matched++
+			} else if key == "allOf" {
+				v.errs = append(v.errs, sv.errs...)
+			}
+		}
+		switch {
+		case key == "anyOf" && matched == 0:
+			v.fail(path, "value must match at least one schema")
+		case key == "oneOf" && matched != 1:
+			v.fail(path, "value must match exactly one schema")
+		}
+	}
+
+	switch tv := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(s, node, tv, path)
+	case []interface{}:
+		v.validateArray(s, node, tv, path)
+	case string:
+		if min, ok := node["minLength"].(float64); ok &&
+			float64(len(tv)) < min {
+			v.fail(path, "length must be >= %v", min)
+		}
+		if patt, ok := node["pattern"].(string); ok {
+			if rx := schemaPattern(patt); rx != nil && !rx.MatchString(tv) {
+				v.fail(path, "value %q must match %s", tv, patt)
+			}
+		}
+	case float64:
+		if min, ok := node["minimum"].(float64); ok && tv < min {
+			v.fail(path, "value must be >= %v", min)
+		}
+		if max, ok := node["maximum"].(float64); ok && tv > max {
+			v.fail(path, "value must be <= %v", max)
+		}
+	}
+
+	return len(v.errs) - n
+}
+
+func (v *schemaValidator) validateObject(
+	s *jsonSchema,
+	node map[string]interface{},
+	m map[string]interface{},
+	path string) {
+
+	props, _ := node["properties"].(map[string]interface{})
+
+	if required, ok := node["required"].([]interface{}); ok {
+		for _, r := range required {
+			if _, ok := m[toString(r)]; !ok {
+				v.fail(joinConfigPath(path, toString(r)),
+					"missing required property")
+			}
+		}
+	}
+
+	for _, k := range sortedKeys(m) {
+		if isConfigMetaKey(k) {
+			continue
+		}
+		kpath := joinConfigPath(path, k)
+		if p, ok := props[k].(map[string]interface{}); ok {
+			v.validate(s, p, m[k], kpath)
+			continue
+		}
+		switch ap := node["additionalProperties"].(type) {
+		case bool:
+			if !ap && !v.extraProps[path][strings.ToLower(k)] {
+				v.fail(kpath, "unknown property")
+			}
+		case map[string]interface{}:
+			v.validate(s, ap, m[k], kpath)
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(
+	s *jsonSchema,
+	node map[string]interface{},
+	a []interface{},
+	path string) {
+
+	if min, ok := node["minItems"].(float64); ok && float64(len(a)) < min {
+		v.fail(path, "length must be >= %v", min)
+	}
+	if unique, _ := node["uniqueItems"].(bool); unique {
+		for i := range a {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(a[i], a[j]) {
+					v.fail(elementPath(path, i, a[i]),
+						"duplicate of %s", elementPath(path, j, a[j]))
+				}
+			}
+		}
+	}
+	if items, ok := node["items"].(map[string]interface{}); ok {
+		for i, e := range a {
+			v.validate(s, items, e, elementPath(path, i, e))
+		}
+	}
+}
+
+func schemaPattern(patt string) *regexp.Regexp {
+	if rx, ok := schemaPatterns.Load(patt); ok {
+		return rx.(*regexp.Regexp)
+	}
+	rx, err := regexp.Compile(patt)
+	if err != nil {
+		return nil
+	}
+	schemaPatterns.Store(patt, rx)
+	return rx
+}
+
+func schemaTypeMatches(t interface{}, value interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		actual := jsonTypeOf(value)
+		if tt == "number" && actual == "integer" {
+			return true
+		}
+		return tt == actual
+	case []interface{}:
+		for _, e := range tt {
+			if schemaTypeMatches(e, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func schemaTypeString(t interface{}) string {
+	if a, ok := t.([]interface{}); ok {
+		s := make([]string, len(a))
+		for i, e := range a {
+			s[i] = toString(e)
+		}
+		return strings.Join(s, " or ")
+	}
+	return toString(t)
+}
+
+// jsonTypeOf returns the JSON schema type name of a decoded JSON value.
+func jsonTypeOf(value interface{}) string {
+	switch tv := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if tv == float64(int64(tv)) {
+			return "integer"
+		}
+		return "number"
+	case map[string]interface{}, Config:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	vv := derefValue(reflect.ValueOf(value))
+	switch vv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return strconv.Quote(fmt.Sprintf("%T", value))
+}
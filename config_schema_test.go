@@ -0,0 +1,143 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config Validate", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal(
+			exampleConfigJSON,
+			&config)).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	validationErrors := func(err error) []*lsx.ConfigValidationError {
+		Ω(err).Should(HaveOccurred())
+		Ω(err).Should(BeAssignableToTypeOf(lsx.MultiError{}))
+		var errs []*lsx.ConfigValidationError
+		for _, e := range err.(lsx.MultiError) {
+			Ω(e).Should(BeAssignableToTypeOf(&lsx.ConfigValidationError{}))
+			errs = append(errs, e.(*lsx.ConfigValidationError))
+		}
+		return errs
+	}
+
+	It("should embed a valid JSON schema", func() {
+		var schema map[string]interface{}
+		Ω(json.Unmarshal(lsx.ConfigSchema(), &schema)).Should(Succeed())
+		Ω(schema).Should(HaveKey("definitions"))
+	})
+
+	It("should validate the example config", func() {
+		Ω(config.Validate(ctx)).Should(Succeed())
+	})
+	It("should validate the root of a scoped config", func() {
+		Ω(config.Set(ctx, "logging.level", "loud")).Should(Succeed())
+		errs := validationErrors(
+			config.Scope(ctx, "services.svc00").Validate(ctx))
+		Ω(errs).Should(HaveLen(1))
+		Ω(errs[0].Path).Should(Equal("logging.level"))
+	})
+
+	It("should report unknown properties", func() {
+		Ω(config.Set(ctx, "servers.svr01.adrs", []interface{}{})).Should(
+			Succeed())
+		errs := validationErrors(config.Validate(ctx))
+		Ω(errs).Should(HaveLen(1))
+		Ω(errs[0].Path).Should(Equal("servers.svr01.adrs"))
+		Ω(errs[0].Error()).Should(Equal(
+			"error: invalid config: path=servers.svr01.adrs: " +
+				"unknown property"))
+	})
+	It("should report invalid array elements by index", func() {
+		Ω(config.Set(ctx, "servers.svr01.addrs", []interface{}{
+			"tcp://127.0.0.1:8989", "127.0.0.1:8990",
+		})).Should(Succeed())
+		errs := validationErrors(config.Validate(ctx))
+		Ω(errs).Should(HaveLen(1))
+		Ω(errs[0].Path).Should(Equal("servers.svr01.addrs[1]"))
+	})
+	It("should report missing required properties", func() {
+		Ω(config.Delete(ctx, "servers.svr00.type")).Should(Succeed())
+		errs := validationErrors(config.Validate(ctx))
+		Ω(errs).Should(HaveLen(1))
+		Ω(errs[0].Path).Should(Equal("servers.svr00.type"))
+	})
+	It("should report all of the invalid values", func() {
+		Ω(config.Set(ctx, "logging.requests", "yes")).Should(Succeed())
+		Ω(config.Set(ctx, "services.svc00.api.volume.mount.host",
+			"192.168.0.192")).Should(Succeed())
+		Ω(config.Set(ctx, "modules", 1)).Should(Succeed())
+		errs := validationErrors(config.Validate(ctx))
+		Ω(errs).Should(HaveLen(3))
+		Ω(errs[0].Path).Should(Equal("logging.requests"))
+		Ω(errs[0].Message).Should(Equal("expected boolean, actual string"))
+		Ω(errs[1].Path).Should(Equal("modules"))
+		Ω(errs[2].Path).Should(Equal(
+			"services.svc00.api.volume.mount.host"))
+	})
+
+	Context("with module schemas", func() {
+		BeforeEach(func() {
+			Ω(lsx.RegisterConfigSchema(
+				lsx.ServerModuleType, "csi", []byte(`{
+					"type": "object",
+					"properties": {
+						"endpoint": {"type": "string", "minLength": 1}
+					}
+				}`))).Should(Succeed())
+			Ω(lsx.RegisterConfigSchema(
+				lsx.VolumeModuleType, "vfs", []byte(`{
+					"type": "object",
+					"properties": {
+						"root": {"type": "string"}
+					}
+				}`))).Should(Succeed())
+		})
+
+		It("should permit the properties defined by a module", func() {
+			Ω(config.Set(ctx, "servers.svr01.endpoint", "/csi")).Should(
+				Succeed())
+			Ω(config.Set(ctx, "services.svc00.api.volume.attach.root",
+				"/tmp")).Should(Succeed())
+			Ω(config.Validate(ctx)).Should(Succeed())
+		})
+		It("should validate the properties defined by a module", func() {
+			Ω(config.Set(ctx, "servers.svr01.endpoint", "")).Should(
+				Succeed())
+			Ω(config.Set(ctx, "services.svc00.api.volume.attach.root",
+				true)).Should(Succeed())
+			errs := validationErrors(config.Validate(ctx))
+			Ω(errs).Should(HaveLen(2))
+			Ω(errs[0].Path).Should(Equal("servers.svr01.endpoint"))
+			Ω(errs[1].Path).Should(Equal(
+				"services.svc00.api.volume.attach.root"))
+		})
+		It("should not permit a module's properties elsewhere", func() {
+			Ω(config.Set(ctx, "servers.svr00.endpoint", "/csi")).Should(
+				Succeed())
+			errs := validationErrors(config.Validate(ctx))
+			Ω(errs).Should(HaveLen(1))
+			Ω(errs[0].Path).Should(Equal("servers.svr00.endpoint"))
+		})
+		It("should reject an invalid schema", func() {
+			Ω(lsx.RegisterConfigSchema(
+				lsx.ServerModuleType, "bad", []byte(`{`))).Should(
+				HaveOccurred())
+		})
+	})
+})
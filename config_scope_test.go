@@ -0,0 +1,98 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config scopes", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal(
+			exampleConfigJSON,
+			&config)).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("should not modify the scoped map", func() {
+		svc := config.Scope(ctx, "services.svc00")
+		Ω(svc.Len()).Should(Equal(4))
+		Ω(svc.Parent(ctx)).Should(Equal(config))
+		Ω(svc.Scope(ctx, "api.volume").FullPath(ctx, "mount")).Should(
+			Equal("services.svc00.api.volume.mount"))
+		Ω(config.Get(ctx, "services.svc00")).ShouldNot(HaveKey("@parent@"))
+		Ω(config.Get(ctx, "services.svc00")).ShouldNot(HaveKey("@scope@"))
+		Ω(config.Get(ctx, "services.svc00.api.volume")).ShouldNot(
+			HaveKey("@parent@"))
+
+		// the source map may be marshaled without the Config type
+		_, err := json.Marshal(map[string]interface{}(config))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("should write top-level values through to the scoped map", func() {
+		svc := config.Scope(ctx, "services.svc00")
+		Ω(svc.Set(ctx, "timeout", "1m")).Should(Succeed())
+		Ω(svc.Get(ctx, "timeout")).Should(Equal("1m"))
+		Ω(config.Get(ctx, "services.svc00.timeout")).Should(Equal("1m"))
+		Ω(svc.Delete(ctx, "logging")).Should(Succeed())
+		Ω(config.Get(ctx, "services.svc00.logging")).Should(BeNil())
+		Ω(svc.Get(ctx, "logging.level")).Should(Equal("debug"))
+	})
+
+	It("should scope and read from many goroutines", func() {
+		var (
+			wg  sync.WaitGroup
+			mu  sync.Mutex
+			bad []string
+		)
+		fail := func(s string) {
+			mu.Lock()
+			bad = append(bad, s)
+			mu.Unlock()
+		}
+		for i := 0; i < 64; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					svc := config.Scope(ctx, "services.svc00")
+					if svc.Get(ctx, "logging.level") != "info" {
+						fail("services.svc00.logging.level")
+					}
+					if svc.Get(ctx, "servers[1]") != "svr01" {
+						fail("services.svc00.servers[1]")
+					}
+					mount := svc.Scope(ctx, "api.volume.mount")
+					if mount.Get(ctx, "type") != "libstorage" {
+						fail("services.svc00.api.volume.mount.type")
+					}
+					if mount.Parent(ctx).Len() != 4 {
+						fail("services.svc00.api.volume.mount parent")
+					}
+					svr := config.Scope(ctx, "servers.svr01")
+					if len(svr.GetAll(ctx, "addrs[*]")) != 2 {
+						fail("servers.svr01.addrs")
+					}
+					if _, err := json.Marshal(svr); err != nil {
+						fail(err.Error())
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		Ω(bad).Should(BeEmpty())
+	})
+})
@@ -0,0 +1,130 @@
+package lsx
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// redactedSecret replaces secrets in marshaled and logged output.
+const redactedSecret = "***"
+
+// Secret is a string config value that is redacted when the config is
+// marshaled or logged. Get and the typed getters return the secret's
+// actual value.
+//
+// A value that is a string may also be marked as secret by the config
+// schema, or by a schema fragment registered with RegisterConfigSchema,
+// with the non-standard annotation "secret": true.
+type Secret string
+
+// String returns the redacted form of the secret.
+func (s Secret) String() string {
+	return redactedSecret
+}
+
+// GoString returns the redacted form of the secret.
+func (s Secret) GoString() string {
+	return strconv.Quote(redactedSecret)
+}
+
+// MarshalJSON returns the redacted form of the secret.
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redactedSecret)
+}
+
+// Reveal returns a copy of the Config instance without the metadata
+// keys and in which secrets are not redacted. The copy is deliberately
+// not a Config, so marshaling it with encoding/json reveals the secrets
+// as well.
+func (c Config) Reveal(ctx context.Context) map[string]interface{} {
+	m, _ := toStringMap(c)
+	return revealConfigValue(m).(map[string]interface{})
+}
+
+// revealConfigValue returns a copy of v in which the Secret values are
+// replaced with strings.
+func revealConfigValue(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case Secret:
+		return string(tv)
+	case Config:
+		m, _ := toStringMap(tv)
+		return revealConfigValue(m)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(tv))
+		for k, v := range tv {
+			m[k] = revealConfigValue(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(tv))
+		for i, e := range tv {
+			a[i] = revealConfigValue(e)
+		}
+		return a
+	}
+	return v
+}
+
+// secretPaths returns the lower-case absolute paths of the values that
+// the schemas mark as secret.
+func (c Config) secretPaths(ctx context.Context) map[string]bool {
+	m, _ := toStringMap(c.root(ctx))
+	secrets := map[string]bool{}
+	collectSecretPaths(rootSchema, rootSchema.node, m, "", secrets)
+	modSchemasRWL.RLock()
+	defer modSchemasRWL.RUnlock()
+	for _, s := range configModuleSections(m) {
+		if schema, ok := modSchemas[s.Type][s.Name]; ok {
+			collectSecretPaths(schema, schema.node, s.Value, s.Path, secrets)
+		}
+	}
+	return secrets
+}
+
+// collectSecretPaths records the paths of the values in v that the
+// schema node marks as secret.
+func collectSecretPaths(
+	s *jsonSchema,
+	node map[string]interface{},
+	v interface{},
+	path string,
+	secrets map[string]bool) {
+
+	node = s.resolve(node)
+	if secret, _ := node["secret"].(bool); secret {
+		secrets[strings.ToLower(path)] = true
+		return
+	}
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, _ := node[key].([]interface{})
+		for _, sub := range subs {
+			if subNode, ok := sub.(map[string]interface{}); ok {
+				collectSecretPaths(s, subNode, v, path, secrets)
+			}
+		}
+	}
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		props, _ := node["properties"].(map[string]interface{})
+		for k, e := range tv {
+			if isConfigMetaKey(k) {
+				continue
+			}
+			kpath := joinConfigPath(path, k)
+			if p, ok := props[k].(map[string]interface{}); ok {
+				collectSecretPaths(s, p, e, kpath, secrets)
+			} else if ap, ok := node["additionalProperties"].(map[string]interface{}); ok {
+				collectSecretPaths(s, ap, e, kpath, secrets)
+			}
+		}
+	case []interface{}:
+		if items, ok := node["items"].(map[string]interface{}); ok {
+			for i, e := range tv {
+				collectSecretPaths(s, items, e, elementPath(path, i, e), secrets)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config secrets", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal(
+			exampleConfigJSON,
+			&config)).ShouldNot(HaveOccurred())
+		Ω(lsx.RegisterConfigSchema(
+			lsx.ServerModuleType, "libstorage", []byte(`{
+				"type": "object",
+				"properties": {
+					"token": {"type": "string", "secret": true}
+				}
+			}`))).Should(Succeed())
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("should redact a Secret", func() {
+		s := lsx.Secret("s3cr3t")
+		Ω(fmt.Sprintf("%v %s %#v", s, s, s)).Should(
+			Equal(`*** *** "***"`))
+		buf, err := json.Marshal(s)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(Equal(`"***"`))
+	})
+
+	Context("with a Secret value", func() {
+		BeforeEach(func() {
+			Ω(config.Set(ctx, "services.svc00.api.volume.mount.password",
+				lsx.Secret("s3cr3t"))).Should(Succeed())
+		})
+		It("should return the secret from Get", func() {
+			path := "services.svc00.api.volume.mount.password"
+			Ω(config.Get(ctx, path)).Should(Equal("s3cr3t"))
+			Ω(config.GetStr(ctx, path)).Should(Equal("s3cr3t"))
+			v, err := config.GetStrE(ctx, path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(v).Should(Equal("s3cr3t"))
+		})
+		It("should redact the secret from MarshalJSON", func() {
+			buf, err := json.Marshal(config)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(buf)).ShouldNot(ContainSubstring("s3cr3t"))
+			Ω(string(buf)).Should(ContainSubstring(`"password":"***"`))
+		})
+		It("should reveal the secret", func() {
+			buf, err := json.Marshal(config.Reveal(ctx))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(buf)).Should(ContainSubstring(`"password":"s3cr3t"`))
+		})
+		It("should redact the secret from a type error", func() {
+			path := "services.svc00.api.volume.mount.password"
+			Ω(config.GetInt(ctx, path)).Should(BeZero())
+			_, err := config.GetIntE(ctx, path)
+			Ω(err).Should(MatchError("error: invalid config value: " +
+				"path=" + path + ", expected=int, actual=lsx.Secret(***)"))
+		})
+	})
+
+	Context("with a value marked as secret by a schema", func() {
+		BeforeEach(func() {
+			Ω(config.Set(ctx, "servers.svr00.token", "s3cr3t")).Should(
+				Succeed())
+			Ω(config.Set(ctx, "servers.svr01.token", "public")).Should(
+				Succeed())
+		})
+		It("should return the secret from Get", func() {
+			Ω(config.Get(ctx, "servers.svr00.token")).Should(Equal("s3cr3t"))
+			svr := config.Scope(ctx, "servers.svr00")
+			Ω(svr.GetStr(ctx, "token")).Should(Equal("s3cr3t"))
+		})
+		It("should redact the secret from MarshalJSON", func() {
+			buf, err := json.Marshal(config)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(buf)).ShouldNot(ContainSubstring("s3cr3t"))
+			Ω(string(buf)).Should(ContainSubstring(`"token":"***"`))
+			Ω(string(buf)).Should(ContainSubstring(`"token":"public"`))
+		})
+		It("should redact the secret from a scope", func() {
+			buf, err := json.Marshal(config.Scope(ctx, "servers.svr00"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(buf)).Should(ContainSubstring(`"token":"***"`))
+		})
+		It("should reveal the secret", func() {
+			buf, err := json.Marshal(config.Reveal(ctx))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(buf)).Should(ContainSubstring(`"token":"s3cr3t"`))
+		})
+		It("should redact the secret from a type error", func() {
+			_, err := config.GetIntE(ctx, "servers.svr00.token")
+			Ω(err).Should(HaveOccurred())
+			Ω(err.Error()).ShouldNot(ContainSubstring("s3cr3t"))
+			_, err = config.GetIntE(ctx, "servers.svr01.token")
+			Ω(err.Error()).Should(ContainSubstring("string(public)"))
+		})
+	})
+})
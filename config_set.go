@@ -0,0 +1,407 @@
+package lsx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Set sets a value in the config map.
+//
+// The path parameter adheres to the same JSON path, dot-style notation
+// used by Get. Maps that do not exist along the path are created. A
+// path token that refers to an array matches the element whose "name"
+// field matches the token, and a new element with that name is
+// appended to the array if no element matches. A value set at a named
+// element must be an object, and the element keeps its name. A path
+// token that is an index, ex. addrs[1], refers to the array element at
+// that index, and an index equal to the length of the array appends an
+// element. Wildcards are not supported.
+//
+// Values cannot be set through struct values, and an error is returned
+// if the path traverses a struct or a non-container value.
+func (c Config) Set(ctx context.Context, path string, value interface{}) error {
+	return c.set(ctx, path, value, false)
+}
+
+// Delete removes a value from the config map.
+//
+// The path parameter adheres to the same JSON path, dot-style notation
+// used by Get. If the final path token refers to an array then the
+// element whose "name" field matches the token is removed from the
+// array. A ConfigNotFoundError is returned if there is no value at the
+// path.
+func (c Config) Delete(ctx context.Context, path string) error {
+	return c.set(ctx, path, nil, true)
+}
+
+func (c Config) set(
+	ctx context.Context,
+	path string,
+	value interface{},
+	del bool) error {
+
+	if c == nil {
+		return fmt.Errorf("error: cannot set config value: nil config")
+	}
+	if path == "" {
+		return fmt.Errorf("error: invalid config path: %q", path)
+	}
+
+	tokens, err := parseConfigPath(path)
+	if err != nil {
+		return err
+	}
+	if isConfigMetaKey(tokens[0].key) {
+		return fmt.Errorf("error: invalid config path: %s", path)
+	}
+	for _, tok := range tokens {
+		if tok.kind == wildcardConfigPathToken {
+			return &ConfigPathError{
+				Path: path, Message: "wildcards are not supported"}
+		}
+	}
+
+	// store nested Config objects as plain maps so that they are
+	// discoverable by Get and Scope
+	if config, ok := value.(Config); ok {
+		value, _ = toStringMap(config)
+	}
+
+	s := &configSetter{tokens: tokens, value: value, del: del}
+	// discard the index once the value is set, or even if the value
+	// could not be set since containers along the path may be created
+	defer c.invalidateIndex(ctx)
+
+	_, err = s.set(map[string]interface{}(c), 0)
+	if err != nil {
+		if _, ok := err.(*ConfigNotFoundError); ok {
+			return &ConfigNotFoundError{Path: c.FullPath(ctx, path)}
+		}
+		return fmt.Errorf("error: cannot set config value: path=%s: %v",
+			c.FullPath(ctx, path), err)
+	}
+
+	// write the top-level value through to the map from which a scoped
+	// Config instance was created; nested values are already shared
+	if src := c.source(ctx); src != nil {
+		if k, ok := findMapKey(reflect.ValueOf(c), tokens[0].key); ok {
+			src[k.String()] = c[k.String()]
+		} else if k, ok := findMapKey(reflect.ValueOf(src), tokens[0].key); ok {
+			delete(src, k.String())
+		}
+	}
+	return nil
+}
+
+// configSetter walks a path in a config tree in order to set or delete
+// the value at the end of the path.
+type configSetter struct {
+	tokens []configPathToken
+	value  interface{}
+	del    bool
+}
+
+// set sets or deletes the value for the path token at tokIdx inside
+// of cur. The returned value is the possibly new container, such as a
+// slice that grew, that should be stored in place of cur.
+func (s *configSetter) set(
+	cur interface{}, tokIdx int) (interface{}, error) {
+
+	var (
+		tok          = s.tokens[tokIdx].key
+		isFinalToken = tokIdx == len(s.tokens)-1
+		curVal       = derefValue(reflect.ValueOf(cur))
+	)
+
+	if s.tokens[tokIdx].kind == indexConfigPathToken {
+		return s.setIndex(cur, curVal, tokIdx)
+	}
+
+	switch curVal.Kind() {
+
+	case reflect.Map:
+		if curVal.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type: %s",
+				curVal.Type().Key())
+		}
+
+		// a nil map, ex. a null value decoded into a typed map, is
+		// replaced with an empty one that is stored in the parent
+		if curVal.IsNil() {
+			if s.del {
+				return nil, &ConfigNotFoundError{}
+			}
+			curVal = reflect.MakeMap(curVal.Type())
+			cur = curVal.Interface()
+		}
+
+		// match the path token against the map keys the same way
+		// Get does, but fall back to the token itself so that new
+		// keys can be added
+		key := reflect.ValueOf(tok).Convert(curVal.Type().Key())
+		if k, ok := findMapKey(curVal, tok); ok {
+			key = k
+		} else if s.del {
+			return nil, &ConfigNotFoundError{}
+		}
+
+		if isFinalToken {
+			if s.del {
+				curVal.SetMapIndex(key, reflect.Value{})
+				return cur, nil
+			}
+			return cur, setMapIndex(curVal, key, s.value)
+		}
+
+		var next interface{}
+		if v := curVal.MapIndex(key); v.IsValid() {
+			next = v.Interface()
+		}
+		if next == nil {
+			if s.del {
+				return nil, &ConfigNotFoundError{}
+			}
+			next = s.newContainer(tokIdx + 1)
+		}
+		next, err := s.set(next, tokIdx+1)
+		if err != nil {
+			return nil, err
+		}
+		return cur, setMapIndex(curVal, key, next)
+
+	case reflect.Array, reflect.Slice:
+		idx, elName := -1, tok
+		for x := 0; x < curVal.Len(); x++ {
+			el := derefValue(curVal.Index(x))
+			switch el.Kind() {
+			case reflect.Map:
+				if k, ok := findMapKey(el, "name"); ok {
+					name := derefValue(el.MapIndex(k))
+					n := toStringWithOpts(name.Interface(), false)
+					if strings.EqualFold(tok, n) {
+						idx, elName = x, n
+					}
+				}
+			case reflect.Struct:
+				if name, ok := structName(el); ok &&
+					strings.EqualFold(tok, name) {
+					return nil, fmt.Errorf(
+						"cannot set through struct: %s", el.Type())
+				}
+			}
+			if idx >= 0 {
+				break
+			}
+		}
+
+		if curVal.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("cannot set array element: %s",
+				curVal.Type())
+		}
+
+		if idx < 0 {
+			if s.del {
+				return nil, &ConfigNotFoundError{}
+			}
+			el := map[string]interface{}{"name": tok}
+			if isFinalToken {
+				el, err := namedArrayElement(tok, s.value)
+				if err != nil {
+					return nil, err
+				}
+				return appendValue(curVal, el)
+			}
+			next, err := s.set(el, tokIdx+1)
+			if err != nil {
+				return nil, err
+			}
+			return appendValue(curVal, next)
+		}
+
+		if isFinalToken {
+			if s.del {
+				return reflect.AppendSlice(
+					curVal.Slice(0, idx),
+					curVal.Slice(idx+1, curVal.Len())).Interface(), nil
+			}
+			el, err := namedArrayElement(elName, s.value)
+			if err != nil {
+				return nil, err
+			}
+			return cur, setIndex(curVal, idx, el)
+		}
+
+		next, err := s.set(curVal.Index(idx).Interface(), tokIdx+1)
+		if err != nil {
+			return nil, err
+		}
+		return cur, setIndex(curVal, idx, next)
+
+	case reflect.Struct:
+		return nil, fmt.Errorf("cannot set through struct: %s",
+			curVal.Type())
+	}
+
+	if s.del {
+		return nil, &ConfigNotFoundError{}
+	}
+	return nil, fmt.Errorf("cannot set through value: %T", cur)
+}
+
+// namedArrayElement returns a copy of the object value with its "name" key
+// set to the provided name, so that the array element it becomes is
+// found by the name. An error is returned if the value is not an
+// object.
+func namedArrayElement(name string, value interface{}) (interface{}, error) {
+	m, ok := toStringMap(value)
+	if !ok {
+		return nil, fmt.Errorf(
+			"cannot set named array element: %s: %T", name, value)
+	}
+	el := map[string]interface{}{"name": name}
+	for k, v := range m {
+		if !strings.EqualFold(k, "name") {
+			el[k] = v
+		}
+	}
+	return el, nil
+}
+
+// setIndex sets or deletes the value for the index path token at tokIdx
+// inside of the reflected slice curVal.
+func (s *configSetter) setIndex(
+	cur interface{}, curVal reflect.Value, tokIdx int) (interface{}, error) {
+
+	var (
+		idx          = s.tokens[tokIdx].index
+		isFinalToken = tokIdx == len(s.tokens)-1
+	)
+
+	if curVal.Kind() != reflect.Slice {
+		if s.del {
+			return nil, &ConfigNotFoundError{}
+		}
+		return nil, fmt.Errorf("cannot index value: %T", cur)
+	}
+
+	if s.del && idx >= curVal.Len() {
+		return nil, &ConfigNotFoundError{}
+	}
+	if idx > curVal.Len() {
+		return nil, fmt.Errorf("index out of range: %d", idx)
+	}
+
+	if idx == curVal.Len() {
+		if isFinalToken {
+			return appendValue(curVal, s.value)
+		}
+		next, err := s.set(s.newContainer(tokIdx+1), tokIdx+1)
+		if err != nil {
+			return nil, err
+		}
+		return appendValue(curVal, next)
+	}
+
+	if isFinalToken {
+		if s.del {
+			return reflect.AppendSlice(
+				curVal.Slice(0, idx),
+				curVal.Slice(idx+1, curVal.Len())).Interface(), nil
+		}
+		return cur, setIndex(curVal, idx, s.value)
+	}
+
+	next := curVal.Index(idx).Interface()
+	if next == nil {
+		if s.del {
+			return nil, &ConfigNotFoundError{}
+		}
+		next = s.newContainer(tokIdx + 1)
+	}
+	next, err := s.set(next, tokIdx+1)
+	if err != nil {
+		return nil, err
+	}
+	return cur, setIndex(curVal, idx, next)
+}
+
+// newContainer returns the container that is created for the path token
+// at tokIdx when no value exists for it: an array for an index and a map
+// otherwise.
+func (s *configSetter) newContainer(tokIdx int) interface{} {
+	if s.tokens[tokIdx].kind == indexConfigPathToken {
+		return []interface{}{}
+	}
+	return map[string]interface{}{}
+}
+
+// findMapKey returns the key in the reflected map whose string
+// representation matches the provided path token. A key that matches
+// the token exactly is preferred; otherwise the lexically smallest of
+// the keys that match the token case-insensitively is returned so that
+// the result does not depend on the order in which the keys are
+// iterated.
+func findMapKey(m reflect.Value, tok string) (reflect.Value, bool) {
+	if kt := m.Type().Key(); kt.Kind() == reflect.String {
+		if k := reflect.ValueOf(tok).Convert(kt); m.MapIndex(k).IsValid() {
+			return k, true
+		}
+	}
+	var (
+		match   reflect.Value
+		szMatch string
+		ok      bool
+	)
+	for _, mapKey := range m.MapKeys() {
+		szMapKey := toString(derefValue(mapKey).Interface())
+		if szMapKey == tok {
+			return mapKey, true
+		}
+		if strings.EqualFold(tok, szMapKey) && (!ok || szMapKey < szMatch) {
+			match, szMatch, ok = mapKey, szMapKey, true
+		}
+	}
+	return match, ok
+}
+
+func setMapIndex(m, k reflect.Value, v interface{}) error {
+	vv, err := assignableValue(v, m.Type().Elem())
+	if err != nil {
+		return err
+	}
+	m.SetMapIndex(k, vv)
+	return nil
+}
+
+func setIndex(a reflect.Value, i int, v interface{}) error {
+	vv, err := assignableValue(v, a.Type().Elem())
+	if err != nil {
+		return err
+	}
+	a.Index(i).Set(vv)
+	return nil
+}
+
+func appendValue(a reflect.Value, v interface{}) (interface{}, error) {
+	vv, err := assignableValue(v, a.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	return reflect.Append(a, vv).Interface(), nil
+}
+
+// assignableValue returns the reflected value of v if v is assignable
+// to the provided type.
+func assignableValue(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+	vv := reflect.ValueOf(v)
+	if !vv.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf(
+			"value of type %T is not assignable to %s", v, t)
+	}
+	return vv, nil
+}
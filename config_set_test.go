@@ -0,0 +1,115 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("Config Set and Delete", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal(
+			exampleConfigJSON,
+			&config)).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("should replace an existing value", func() {
+		Ω(config.Set(ctx, "logging.level", "warn")).Should(Succeed())
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("warn"))
+	})
+	It("should match existing keys case-insensitively", func() {
+		Ω(config.Set(ctx, "Logging.Level", "warn")).Should(Succeed())
+		Ω(config.GetStringMap(ctx, "logging")).Should(HaveLen(3))
+		Ω(config.Get(ctx, "logging.level")).Should(Equal("warn"))
+	})
+	It("should create intermediate maps", func() {
+		Ω(config.Set(ctx, "a.b.c", 1)).Should(Succeed())
+		Ω(config.Get(ctx, "a.b.c")).Should(Equal(1))
+		Ω(config.Len()).Should(Equal(5))
+	})
+	It("should replace nil intermediate maps", func() {
+		var data map[string]map[string]interface{}
+		Ω(json.Unmarshal([]byte(`{"b":null}`), &data)).Should(Succeed())
+		config["data"] = data
+		Ω(config.Set(ctx, "data.b.c", 1)).Should(Succeed())
+		Ω(config.Get(ctx, "data.b.c")).Should(Equal(1))
+		Ω(config.Delete(ctx, "data.b.c")).Should(Succeed())
+
+		data["b"] = nil
+		err := config.Delete(ctx, "data.b.c")
+		Ω(err).Should(BeAssignableToTypeOf(&lsx.ConfigNotFoundError{}))
+	})
+	It("should set a value in a named array element", func() {
+		Ω(config.Set(ctx, "servers.svr00.type", "csi")).Should(Succeed())
+		Ω(config.Get(ctx, "servers.svr00.type")).Should(Equal("csi"))
+	})
+	It("should create a named array element", func() {
+		Ω(config.Set(
+			ctx, "servers.svr02.addrs",
+			[]interface{}{"tcp://127.0.0.1:9999"})).Should(Succeed())
+		Ω(config.Get(ctx, "servers")).Should(HaveLen(3))
+		Ω(config.Get(ctx, "servers.svr02.name")).Should(Equal("svr02"))
+		Ω(config.GetStringSlice(ctx, "servers.svr02.addrs")).Should(
+			Equal([]string{"tcp://127.0.0.1:9999"}))
+	})
+	It("should create a named array element from an object", func() {
+		Ω(config.Set(ctx, "servers.svr02",
+			map[string]interface{}{"type": "csi"})).Should(Succeed())
+		Ω(config.Get(ctx, "servers.svr02.name")).Should(Equal("svr02"))
+		Ω(config.Get(ctx, "servers.svr02.type")).Should(Equal("csi"))
+		Ω(config.Set(ctx, "servers.svr02",
+			map[string]interface{}{"type": "nfs"})).Should(Succeed())
+		Ω(config.Get(ctx, "servers")).Should(HaveLen(3))
+		Ω(config.Get(ctx, "servers.svr02.type")).Should(Equal("nfs"))
+	})
+	It("should refuse to create a named array element from a scalar", func() {
+		Ω(config.Set(ctx, "servers.svr02", "csi")).Should(MatchError(
+			"error: cannot set config value: path=servers.svr02: " +
+				"cannot set named array element: svr02: string"))
+		Ω(config.Get(ctx, "servers")).Should(HaveLen(2))
+	})
+	It("should write through a scope", func() {
+		scoped := config.Scope(ctx, "services.svc00")
+		Ω(scoped.Set(ctx, "logging.level", "error")).Should(Succeed())
+		Ω(config.Get(ctx, "services.svc00.logging.level")).Should(
+			Equal("error"))
+	})
+	It("should refuse to write through a struct", func() {
+		config["data"] = &testStruct{Name: "hello"}
+		err := config.Set(ctx, "data.name", "world")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("cannot set through struct"))
+	})
+	It("should refuse to write through a scalar", func() {
+		err := config.Set(ctx, "logging.level.x", "world")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("path=logging.level.x"))
+	})
+	It("should delete a value", func() {
+		Ω(config.Delete(ctx, "logging.level")).Should(Succeed())
+		Ω(config.Get(ctx, "logging.level")).Should(BeNil())
+		Ω(config.GetStringMap(ctx, "logging")).Should(HaveLen(2))
+	})
+	It("should delete a named array element", func() {
+		Ω(config.Delete(ctx, "servers.svr00")).Should(Succeed())
+		Ω(config.Get(ctx, "servers")).Should(HaveLen(1))
+		Ω(config.Get(ctx, "servers.svr00")).Should(BeNil())
+		Ω(config.Get(ctx, "servers.svr01")).ShouldNot(BeNil())
+	})
+	It("should fail to delete a missing value", func() {
+		err := config.Delete(ctx, "servers.svr09")
+		Ω(err).Should(BeAssignableToTypeOf(&lsx.ConfigNotFoundError{}))
+	})
+})
@@ -0,0 +1,129 @@
+package lsx
+
+import (
+	"reflect"
+	"strings"
+)
+
+// configStructField is a field of a struct value and the name by which
+// the field is queried.
+type configStructField struct {
+	name  string
+	value reflect.Value
+}
+
+// structFields returns the fields of the struct value v in declaration
+// order, named the way encoding/json names them so that a struct stored
+// in a Config instance is queried with the same paths that MarshalJSON
+// writes:
+//
+//	the name of a field is read from its "lsx" tag, falling back to its
+//	"json" tag and then the field's name; please see structFieldName
+//
+//	unexported fields, fields with a tag of "-", and fields that can
+//	only be read through an unexported embedded struct are skipped
+//
+//	the fields of an embedded struct without a tag are promoted into the
+//	outer struct, and the fields of a nil embedded pointer are skipped
+//
+//	a promoted field is hidden by a field with the same name that is
+//	less deeply embedded. Of the fields with the same name at the same
+//	depth, a tagged field hides the others, otherwise all of them are
+//	hidden
+func structFields(v reflect.Value) []configStructField {
+	type candidate struct {
+		configStructField
+		depth  int
+		tagged bool
+	}
+	var (
+		fields []candidate
+		walk   func(v reflect.Value, depth int)
+	)
+	walk = func(v reflect.Value, depth int) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			var (
+				sf           = t.Field(i)
+				fv           = v.Field(i)
+				name, tagged = structFieldName(sf)
+			)
+			if name == "" {
+				continue
+			}
+			if sf.Anonymous && !tagged {
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+					if !fv.IsNil() {
+						walk(fv.Elem(), depth+1)
+					}
+					continue
+				}
+				if ft.Kind() == reflect.Struct {
+					walk(fv, depth+1)
+					continue
+				}
+			}
+			if !fv.CanInterface() {
+				continue
+			}
+			fields = append(fields, candidate{
+				configStructField{name, fv}, depth, tagged})
+		}
+	}
+	walk(v, 0)
+
+	// find the field that is not hidden for each name
+	type dominant struct {
+		index, depth, count int
+		tagged              bool
+	}
+	names := map[string]*dominant{}
+	for i, f := range fields {
+		d, ok := names[f.name]
+		switch {
+		case !ok || f.depth < d.depth:
+			names[f.name] = &dominant{i, f.depth, 1, f.tagged}
+		case f.depth > d.depth:
+		case f.tagged && !d.tagged:
+			d.index, d.count, d.tagged = i, 1, true
+		case f.tagged == d.tagged:
+			d.count++
+		}
+	}
+
+	visible := make([]configStructField, 0, len(names))
+	for i, f := range fields {
+		if d := names[f.name]; d.index == i && d.count == 1 {
+			visible = append(visible, f.configStructField)
+		}
+	}
+	return visible
+}
+
+// structField returns the value of the first field of the struct value
+// v whose name matches the token case-insensitively. Please see
+// structFields for how fields are named.
+func structField(v reflect.Value, tok string) (reflect.Value, bool) {
+	for _, f := range structFields(v) {
+		if strings.EqualFold(tok, f.name) {
+			return f.value, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// structName returns the value of the struct value v's string field
+// named "name", matched case-insensitively, and a flag indicating
+// whether the struct has such a field.
+func structName(v reflect.Value) (string, bool) {
+	f, ok := structField(v, "name")
+	if !ok {
+		return "", false
+	}
+	f = derefValue(f)
+	if f.Kind() != reflect.String {
+		return "", false
+	}
+	return f.String(), true
+}
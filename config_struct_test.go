@@ -0,0 +1,128 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/akutz/lsx"
+)
+
+type testShadowConfig struct {
+	testCommonConfig
+	*testServerTLSConf
+	Name string `json:"name"`
+}
+
+type testMarshalConfig struct {
+	testCommonConfig
+	Type     string   `json:"type"`
+	Addrs    []string `json:"addrs"`
+	Ignored  string   `json:"-"`
+	Port     int
+	internal string
+}
+
+var _ = Describe("Config struct values", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+		svr    *testServerConfig
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		svr = &testServerConfig{
+			testCommonConfig: testCommonConfig{Name: "svr02"},
+			Type:             "csi",
+			Addrs:            []string{"tcp://:7980"},
+			Logging:          testLoggingConfig{Level: "warn", Requests: true},
+			Timeout:          time.Second,
+			Ignored:          "ignored",
+		}
+		config["server"] = svr
+		config["servers"] = []interface{}{svr}
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("should get fields by their tag names", func() {
+		Ω(config.Get(ctx, "server.type")).Should(Equal("csi"))
+		Ω(config.Get(ctx, "server.addrs[0]")).Should(Equal("tcp://:7980"))
+		Ω(config.Get(ctx, "server.logging.level")).Should(Equal("warn"))
+		Ω(config.Get(ctx, "server.timeout")).Should(Equal(time.Second))
+		Ω(config.Get(ctx, "server.maxBody")).Should(Equal(int64(0)))
+	})
+
+	It("should prefer the lsx tag to the json tag", func() {
+		Ω(config.Get(ctx, "server.logging.requests")).Should(Equal(true))
+		Ω(config.Get(ctx, "server.logging.logRequests")).Should(BeNil())
+		Ω(config.Get(ctx, "server.logging.responses")).Should(Equal(false))
+	})
+
+	It("should skip ignored and unexported fields", func() {
+		Ω(config.Get(ctx, "server.ignored")).Should(BeNil())
+		Ω(config.Get(ctx, "server.internal")).Should(BeNil())
+	})
+
+	It("should get the fields of embedded structs", func() {
+		Ω(config.Get(ctx, "server.name")).Should(Equal("svr02"))
+		Ω(config.Get(ctx, "server.testCommonConfig")).Should(BeNil())
+		Ω(config.Get(ctx, "servers.svr02.type")).Should(Equal("csi"))
+		Ω(config.Get(ctx, "servers.svr02.logging.level")).Should(Equal("warn"))
+	})
+
+	It("should hide promoted fields and skip nil embedded pointers", func() {
+		config["shadow"] = &testShadowConfig{
+			testCommonConfig: testCommonConfig{Name: "inner"},
+			Name:             "outer",
+		}
+		Ω(config.Get(ctx, "shadow.name")).Should(Equal("outer"))
+		Ω(config.Get(ctx, "shadow.enabled")).Should(BeNil())
+
+		config["shadow"] = &testShadowConfig{
+			testServerTLSConf: &testServerTLSConf{Enabled: true},
+		}
+		Ω(config.Get(ctx, "shadow.enabled")).Should(Equal(true))
+	})
+
+	It("should match the fields the way they are marshaled", func() {
+		config["server"] = &testMarshalConfig{
+			testCommonConfig: testCommonConfig{Name: "svr02"},
+			Type:             "csi",
+			Addrs:            []string{"tcp://:7980"},
+			Port:             7980,
+		}
+		delete(config, "servers")
+		buf, err := json.Marshal(config)
+		Ω(err).ShouldNot(HaveOccurred())
+		var m map[string]map[string]interface{}
+		Ω(json.Unmarshal(buf, &m)).Should(Succeed())
+		var expected []string
+		for k := range m["server"] {
+			expected = append(expected, "server."+k)
+		}
+		sort.Strings(expected)
+
+		values, err := config.GetAllE(ctx, "server.*")
+		Ω(err).ShouldNot(HaveOccurred())
+		var paths []string
+		for _, v := range values {
+			paths = append(paths, v.Path)
+		}
+		Ω(paths).Should(Equal([]string{
+			"server.name", "server.type", "server.addrs", "server.Port"}))
+		sort.Strings(paths)
+		Ω(paths).Should(Equal(expected))
+	})
+
+	It("should refuse to set through a struct", func() {
+		err := config.Set(ctx, "servers.svr02.type", "libstorage")
+		Ω(err).Should(HaveOccurred())
+		Ω(err.Error()).Should(ContainSubstring("cannot set through struct"))
+	})
+})
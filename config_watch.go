@@ -0,0 +1,343 @@
+package lsx
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configWatchDelay is how long the watcher waits after the last file
+// system event before reloading the config. Editors often emit several
+// events for a single save.
+var configWatchDelay = 100 * time.Millisecond
+
+// ConfigChange describes a change to the value at a watched path.
+type ConfigChange struct {
+	// Path is the watched path.
+	Path string
+
+	// Old is the value at the path before the change. Old is nil if
+	// the path did not have a value.
+	Old interface{}
+
+	// New is the value at the path after the change. New is nil if the
+	// path no longer has a value.
+	New interface{}
+}
+
+// ConfigWatcher monitors the files and directories from which a
+// config was loaded and reloads the config when they change. The config
+// is also reloaded when a provider that implements
+// ConfigProviderWatcher reports a change.
+//
+// A reloaded config that fails to load or validate is rejected and
+// logged, and the previous config remains active. A valid config
+// atomically replaces the active config, and subscribers are notified
+// of changes to the paths they watch.
+type ConfigWatcher struct {
+	loader  *ConfigLoader
+	fsw     *fsnotify.Watcher
+	files   map[string]bool
+	dirs    map[string]bool
+	config  atomic.Value
+	loadMu  sync.Mutex
+	subs    map[*configSubscriber]struct{}
+	subsRWL sync.RWMutex
+	changed chan struct{}
+	cancel  context.CancelFunc
+	done    chan struct{}
+	once    sync.Once
+}
+
+type configSubscriber struct {
+	ctx  context.Context
+	path string
+	c    chan ConfigChange
+}
+
+// NewConfigWatcher loads the config described by the loader and
+// returns a watcher that reloads the config when the loader's files or
+// directories, or the fragments and conf.d directories of its files,
+// change. The watcher stops when the provided context is
+// cancelled or when Close is invoked.
+func NewConfigWatcher(
+	ctx context.Context, loader *ConfigLoader) (*ConfigWatcher, error) {
+
+	config, layers, err := loader.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error: watch config failed: %v", err)
+	}
+
+	w := &ConfigWatcher{
+		loader:  loader,
+		fsw:     fsw,
+		files:   map[string]bool{},
+		dirs:    map[string]bool{},
+		subs:    map[*configSubscriber]struct{}{},
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	w.config.Store(config)
+
+	// watch the parent directories of the files instead of the files
+	// themselves so that files replaced by a rename are still watched
+	watched := map[string]bool{}
+	watch := func(dir string) error {
+		if watched[dir] {
+			return nil
+		}
+		watched[dir] = true
+		return fsw.Add(dir)
+	}
+	files := append([]string{}, loader.Files...)
+	for _, layer := range layers {
+		if layer.Source != "" && (layer.Kind == FileConfigLayer ||
+			layer.Kind == DirConfigLayer) {
+			files = append(files, layer.Source)
+		}
+	}
+	dirs := append([]string{}, loader.Dirs...)
+	for _, f := range files {
+		if !FileExists(f) {
+			continue
+		}
+		if d := configIncludeDir(f); FileExists(d) {
+			dirs = append(dirs, d)
+		}
+		f, err := filepath.Abs(f)
+		if err != nil {
+			fsw.Close()
+			return nil, err
+		}
+		w.files[f] = true
+		if err := watch(filepath.Dir(f)); err != nil {
+			fsw.Close()
+			return nil, fmt.Errorf("error: watch config failed: %v", err)
+		}
+	}
+	for _, d := range dirs {
+		d, err := filepath.Abs(d)
+		if err != nil {
+			fsw.Close()
+			return nil, err
+		}
+		w.dirs[d] = true
+		if err := watch(d); err != nil {
+			fsw.Close()
+			return nil, fmt.Errorf("error: watch config failed: %v", err)
+		}
+	}
+
+	// the providers stop watching when the watcher is closed
+	watchCtx, cancel := context.WithCancel(ctx)
+	w.cancel = cancel
+	for _, p := range loader.Providers {
+		pw, ok := p.(ConfigProviderWatcher)
+		if !ok {
+			continue
+		}
+		c, err := pw.Watch(watchCtx)
+		if err != nil {
+			cancel()
+			fsw.Close()
+			return nil, fmt.Errorf("error: watch config failed: %v", err)
+		}
+		go w.watchProvider(c)
+	}
+
+	go w.run(ctx)
+	return w, nil
+}
+
+// watchProvider signals the watcher to reload the config each time a
+// config is received from a provider.
+func (w *ConfigWatcher) watchProvider(c <-chan Config) {
+	for range c {
+		select {
+		case w.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Config returns the active config.
+func (w *ConfigWatcher) Config() Config {
+	return w.config.Load().(Config)
+}
+
+// Watch returns a channel on which changes to the value at the provided
+// path are received. An empty path watches the entire config.
+//
+// The channel is closed when the provided context is cancelled or the
+// watcher is closed. Receivers should drain the channel promptly as
+// slow receivers delay the notification of other subscribers.
+func (w *ConfigWatcher) Watch(ctx context.Context, path string) <-chan ConfigChange {
+	sub := &configSubscriber{
+		ctx:  ctx,
+		path: path,
+		c:    make(chan ConfigChange, 8),
+	}
+
+	w.subsRWL.Lock()
+	select {
+	case <-w.done:
+		w.subsRWL.Unlock()
+		close(sub.c)
+		return sub.c
+	default:
+	}
+	w.subs[sub] = struct{}{}
+	w.subsRWL.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.done:
+		}
+		w.subsRWL.Lock()
+		defer w.subsRWL.Unlock()
+		if _, ok := w.subs[sub]; ok {
+			delete(w.subs, sub)
+			close(sub.c)
+		}
+	}()
+
+	return sub.c
+}
+
+// Reload reloads the config. If the config fails to load or validate
+// then the error is returned and the active config is not changed.
+func (w *ConfigWatcher) Reload(ctx context.Context) error {
+	w.loadMu.Lock()
+	defer w.loadMu.Unlock()
+	config, _, err := w.loader.Load(ctx)
+	if err != nil {
+		return err
+	}
+	old := w.Config()
+	w.config.Store(config)
+	w.notify(ctx, old, config)
+	return nil
+}
+
+// Close stops the watcher and closes the channels of all subscribers.
+func (w *ConfigWatcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		w.cancel()
+		err = w.fsw.Close()
+		close(w.done)
+		w.subsRWL.Lock()
+		for sub := range w.subs {
+			delete(w.subs, sub)
+			close(sub.c)
+		}
+		w.subsRWL.Unlock()
+	})
+	return err
+}
+
+func (w *ConfigWatcher) run(ctx context.Context) {
+	defer w.Close()
+
+	var (
+		timer  *time.Timer
+		reload <-chan time.Time
+	)
+
+	// delay (re)starts the timer that delays reloading the config
+	delay := func() {
+		if timer == nil {
+			timer = time.NewTimer(configWatchDelay)
+		} else {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(configWatchDelay)
+		}
+		reload = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.done:
+			return
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			logf("error: watch config failed: %v", err)
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if !w.isWatched(event.Name) {
+				continue
+			}
+			delay()
+		case <-w.changed:
+			delay()
+		case <-reload:
+			reload = nil
+			if err := w.Reload(ctx); err != nil {
+				logf("error: reload config rejected: %v", err)
+			}
+		}
+	}
+}
+
+// isWatched returns a flag indicating whether the file is one of the
+// config files or is a config file in one of the conf.d directories.
+func (w *ConfigWatcher) isWatched(name string) bool {
+	name = filepath.Clean(name)
+	if w.files[name] {
+		return true
+	}
+	return w.dirs[filepath.Dir(name)] && isConfigFile(name)
+}
+
+func (w *ConfigWatcher) notify(ctx context.Context, old, config Config) {
+	w.subsRWL.RLock()
+	defer w.subsRWL.RUnlock()
+	for sub := range w.subs {
+		var oldVal, newVal interface{}
+		if sub.path == "" {
+			// compare the configs without their metadata so that a
+			// change to only the origins of the values, such as a line
+			// number, is not a change
+			oldMap, _ := toStringMap(old)
+			newMap, _ := toStringMap(config)
+			if reflect.DeepEqual(oldMap, newMap) {
+				continue
+			}
+			oldVal, newVal = old, config
+		} else {
+			oldVal, newVal = old.Get(ctx, sub.path), config.Get(ctx, sub.path)
+		}
+		if reflect.DeepEqual(oldVal, newVal) {
+			continue
+		}
+		select {
+		case sub.c <- ConfigChange{Path: sub.path, Old: oldVal, New: newVal}:
+		case <-sub.ctx.Done():
+		case <-ctx.Done():
+		case <-w.done:
+		}
+	}
+}
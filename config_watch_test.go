@@ -0,0 +1,102 @@
+package lsx_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("ConfigWatcher", func() {
+
+	var (
+		ctx        context.Context
+		cancel     context.CancelFunc
+		tmpDir     string
+		configFile string
+		watcher    *lsx.ConfigWatcher
+		loader     *lsx.ConfigLoader
+	)
+
+	writeConfig := func(data string) {
+		tmpFile := configFile + ".tmp"
+		Ω(ioutil.WriteFile(tmpFile, []byte(data), 0644)).Should(Succeed())
+		Ω(os.Rename(tmpFile, configFile)).Should(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		ctx, cancel = context.WithCancel(context.Background())
+		tmpDir, err = ioutil.TempDir("", "lsx-config-watch")
+		Ω(err).ShouldNot(HaveOccurred())
+		configFile = filepath.Join(tmpDir, "config.json")
+		Ω(ioutil.WriteFile(configFile, exampleConfigJSON, 0644)).Should(
+			Succeed())
+		loader = &lsx.ConfigLoader{
+			Files: []string{configFile},
+			Validate: func(ctx context.Context, config lsx.Config) error {
+				if config.Get(ctx, "logging.level") == "invalid" {
+					return errors.New("error: invalid log level")
+				}
+				return nil
+			},
+		}
+		watcher, err = lsx.NewConfigWatcher(ctx, loader)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+	AfterEach(func() {
+		cancel()
+		watcher.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("should notify subscribers of changes", func() {
+		levels := watcher.Watch(ctx, "logging.level")
+		addrs := watcher.Watch(ctx, "servers.svr00.addrs")
+		Ω(watcher.Config().Get(ctx, "logging.level")).Should(Equal("debug"))
+
+		writeConfig(`{"logging":{"level":"warn"},` +
+			`"servers":[{"name":"svr00","addrs":["tcp://127.0.0.1:7979"]}]}`)
+
+		var change lsx.ConfigChange
+		Eventually(levels, 5*time.Second).Should(Receive(&change))
+		Ω(change.Path).Should(Equal("logging.level"))
+		Ω(change.Old).Should(Equal("debug"))
+		Ω(change.New).Should(Equal("warn"))
+		Ω(watcher.Config().Get(ctx, "logging.level")).Should(Equal("warn"))
+		Consistently(addrs, 300*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should keep the previous config after an invalid edit", func() {
+		levels := watcher.Watch(ctx, "logging.level")
+
+		writeConfig(`{"logging":{"level":"warn"`)
+		Consistently(levels, 500*time.Millisecond).ShouldNot(Receive())
+		Ω(watcher.Config().Get(ctx, "logging.level")).Should(Equal("debug"))
+
+		writeConfig(`{"logging":{"level":"invalid"}}`)
+		Consistently(levels, 500*time.Millisecond).ShouldNot(Receive())
+		Ω(watcher.Config().Get(ctx, "logging.level")).Should(Equal("debug"))
+
+		writeConfig(`{"logging":{"level":"error"}}`)
+		Eventually(levels, 5*time.Second).Should(Receive())
+		Ω(watcher.Config().Get(ctx, "logging.level")).Should(Equal("error"))
+	})
+
+	It("should close the channel when the context is cancelled", func() {
+		subCtx, subCancel := context.WithCancel(ctx)
+		levels := watcher.Watch(subCtx, "logging.level")
+		subCancel()
+		Eventually(levels).Should(BeClosed())
+	})
+
+	It("should close the channel when the watcher is closed", func() {
+		levels := watcher.Watch(ctx, "logging.level")
+		Ω(watcher.Close()).Should(Succeed())
+		Eventually(levels).Should(BeClosed())
+	})
+})
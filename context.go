@@ -7,4 +7,13 @@ const (
 	// ConfigKey is the context key used to store and retrieve a
 	// Config object in and from a Go context.
 	ConfigKey ContextKey = iota
+
+	// EnvPrefixKey is the context key used to store and retrieve the
+	// prefix of the names of the environment variables that override
+	// config values.
+	EnvPrefixKey
+
+	// RegistryKey is the context key used to store and retrieve the
+	// Registry of the modules consulted by configs and module graphs.
+	RegistryKey
 )
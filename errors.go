@@ -0,0 +1,31 @@
+package lsx
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MultiError is an error that aggregates one or more errors.
+type MultiError []error
+
+// Error returns the error message.
+func (e MultiError) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	w := &bytes.Buffer{}
+	fmt.Fprintf(w, "error: %d errors occurred:", len(e))
+	for _, err := range e {
+		fmt.Fprintf(w, "\n\t* %v", err)
+	}
+	return w.String()
+}
+
+// ErrOrNil returns nil if the MultiError is empty; otherwise the
+// MultiError is returned.
+func (e MultiError) ErrOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
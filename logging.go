@@ -1 +1,14 @@
 package lsx
+
+import (
+	"log"
+	"os"
+)
+
+// logger is used to report errors that occur in the background and
+// thus cannot be returned to a caller.
+var logger = log.New(os.Stderr, "lsx: ", log.LstdFlags)
+
+func logf(format string, args ...interface{}) {
+	logger.Printf(format, args...)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/akutz/lsx"
+)
+
+// configCmds are the sub-commands of the "config" command.
+var configCmds = map[string]func(ctx context.Context, args []string) error{
+	"defaults": configDefaultsCmd,
+	"env":      configEnvCmd,
+	"explain":  configExplainCmd,
+	"fmt":      configFmtCmd,
+}
+
+// configCmd executes the "config" command.
+func configCmd(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lsx config <command> [arguments]")
+	}
+	cmd, ok := configCmds[args[0]]
+	if !ok {
+		return fmt.Errorf("error: unknown config command: %s", args[0])
+	}
+	return cmd(ctx, args[1:])
+}
+
+// configFmtCmd converts a config document between formats:
+//
+//	lsx config fmt [-from FORMAT] [-to FORMAT] [FILE]
+//
+// The document is read from standard input if FILE is omitted.
+func configFmtCmd(ctx context.Context, args []string) error {
+	var (
+		fs   = flag.NewFlagSet("config fmt", flag.ContinueOnError)
+		from = fs.String("from", "", "the input format; detected if omitted")
+		to   = fs.String("to", "json", "the output format")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		name string
+		buf  []byte
+		err  error
+	)
+	if fs.NArg() > 0 {
+		name = fs.Arg(0)
+		buf, err = ioutil.ReadFile(name)
+	} else {
+		buf, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+
+	fromFormat := lsx.DetectConfigFormat(name, buf)
+	if *from != "" {
+		if fromFormat, err = lsx.ParseConfigFormat(*from); err != nil {
+			return err
+		}
+	}
+	toFormat, err := lsx.ParseConfigFormat(*to)
+	if err != nil {
+		return err
+	}
+
+	if buf, err = lsx.FormatConfig(buf, fromFormat, toFormat); err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(buf)
+	return err
+}
+
+// configEnvCmd prints the environment variables that override values
+// in the config:
+//
+//	lsx config env [-config FILE] [-confd DIR] [-set PATH=VALUE]
+//	               [-env-prefix PREFIX] [-scope PATH] [FILE...]
+func configEnvCmd(ctx context.Context, args []string) error {
+	var (
+		fs     = flag.NewFlagSet("config env", flag.ContinueOnError)
+		loader = newConfigLoader(fs)
+		scope  = fs.String("scope", "", "the path of a scope")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, err := loader.init(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+	config, _, err := loader.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if *scope != "" {
+		if config = config.Scope(ctx, *scope); config == nil {
+			return fmt.Errorf("error: invalid scope: %s", *scope)
+		}
+	}
+	vars := config.EnvVars(ctx)
+	if vars == nil {
+		vars = []lsx.ConfigEnvVar{}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(vars)
+}
+
+// configExplainCmd prints where the value at a path came from:
+//
+//	lsx config explain PATH [-scope PATH] [-json] [-show-secrets]
+//	                   [-config FILE] [-confd DIR] [-set PATH=VALUE]
+//	                   [-env-prefix PREFIX] [FILE...]
+//
+// The config is not validated so that an invalid config may be
+// explained.
+func configExplainCmd(ctx context.Context, args []string) error {
+	var (
+		fs          = flag.NewFlagSet("config explain", flag.ContinueOnError)
+		loader      = newConfigLoader(fs)
+		scope       = fs.String("scope", "", "the path of a scope")
+		asJSON      = fs.Bool("json", false, "print the trace as JSON")
+		showSecrets = fs.Bool("show-secrets", false,
+			"print secret values instead of redacting them")
+		path string
+	)
+
+	// the path may precede the flags
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		path, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	files := fs.Args()
+	if path == "" {
+		if len(files) == 0 {
+			return fmt.Errorf("usage: lsx config explain PATH [arguments]")
+		}
+		path, files = files[0], files[1:]
+	}
+
+	loader.Validate = nil
+	ctx, err := loader.init(ctx, files)
+	if err != nil {
+		return err
+	}
+	config, _, err := loader.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if *scope != "" {
+		if config = config.Scope(ctx, *scope); config == nil {
+			return fmt.Errorf("error: invalid scope: %s", *scope)
+		}
+	}
+
+	// the trace's String function redacts secrets, but its values do
+	// not, so redact the values for the JSON output
+	e := config.Explain(ctx, path)
+	if *showSecrets {
+		e.Secret = false
+	} else if e.Secret {
+		if e.Value != nil {
+			e.Value = "***"
+		}
+		if e.RawValue != nil {
+			e.RawValue = "***"
+		}
+	}
+	if !*asJSON {
+		_, err := fmt.Fprint(os.Stdout, e)
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
+
+// configDefaultsCmd prints the config keys declared by the registered
+// modules:
+//
+//	lsx config defaults [-type TYPE] [-name NAME] [-json]
+//	                    [-config FILE] [-confd DIR] [-bootstrap FILE]
+//
+// If a config is specified then the modules of the plug-ins listed in
+// the "modules" sections of the bootstrap config and of the config are
+// included.
+func configDefaultsCmd(ctx context.Context, args []string) error {
+	var (
+		fs      = flag.NewFlagSet("config defaults", flag.ContinueOnError)
+		loader  = newConfigLoader(fs)
+		modType = fs.String("type", "", "list the keys of this module type")
+		modName = fs.String("name", "", "list the keys of this module name")
+		asJSON  = fs.Bool("json", false, "print the keys as JSON")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: lsx config defaults [arguments]")
+	}
+	ctx, err := loader.init(ctx, nil)
+	switch err {
+	case nil:
+		if _, _, err := loader.Load(ctx); err != nil {
+			return err
+		}
+	case errMissingConfig:
+	default:
+		return err
+	}
+
+	var filterType lsx.ModuleType
+	if *modType != "" {
+		if filterType, err = lsx.ParseModuleType(*modType); err != nil {
+			return err
+		}
+	}
+	configs := []lsx.ModuleConfig{}
+	for _, mc := range lsx.ContextRegistry(ctx).Configs() {
+		if filterType != lsx.InvalidModuleType && mc.Type != filterType {
+			continue
+		}
+		if *modName != "" && !strings.EqualFold(*modName, mc.Name) {
+			continue
+		}
+		configs = append(configs, mc)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(configs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tPATH\tTYPE\tDEFAULT\tDEPRECATED\tDESCRIPTION")
+	for _, mc := range configs {
+		for _, k := range mc.Keys {
+			def := ""
+			if k.Default != nil {
+				buf, err := json.Marshal(k.Default)
+				if err != nil {
+					return err
+				}
+				def = string(buf)
+			}
+			fmt.Fprintf(w, "%s:%s\t%s\t%s\t%s\t%s\t%s\n",
+				mc.Type, mc.Name, k.Path, k.Type, def, k.Deprecated,
+				k.Description)
+		}
+	}
+	return w.Flush()
+}
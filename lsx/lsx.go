@@ -1,57 +1,294 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/akutz/lsx"
 )
 
+// errMissingConfig is returned by configLoader.init if no config file,
+// conf.d directory, or config provider other than env is specified.
+var errMissingConfig = errors.New("error: missing config")
+
+// defaultConfig is the lowest config layer.
+var defaultConfig = lsx.Config{
+	"logging": map[string]interface{}{
+		"level":     "info",
+		"requests":  false,
+		"responses": false,
+	},
+}
+
 func main() {
 	var (
-		ok     bool
-		config lsx.Config
+		ctx         = context.Background()
+		loader      = newConfigLoader(flag.CommandLine)
+		layers      bool
+		watch       bool
+		showSecrets bool
 	)
 
-	// load the config either first from the CLI and then attempt
-	// to read the config from LSX_CONFIG
-	if len(os.Args) >= 2 {
-		config, ok = loadConfig(os.Args[1])
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := configCmd(ctx, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
-	if !ok {
-		if config, ok = loadConfig(os.Getenv("LSX_CONFIG")); !ok {
-			fmt.Fprintln(os.Stderr, "error: missing config")
+
+	if len(os.Args) > 1 && os.Args[1] == "modules" {
+		if err := modulesCmd(ctx, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
+		return
 	}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.Encode(config)
-}
+	flag.BoolVar(&layers, "layers", false,
+		"print each config layer instead of the merged config")
+	flag.BoolVar(&watch, "watch", false,
+		"print the merged config again each time it changes")
+	flag.BoolVar(&showSecrets, "show-secrets", false,
+		"print secret values instead of redacting them")
+	flag.Parse()
 
-func loadConfig(v string) (lsx.Config, bool) {
-	if v == "" {
-		return nil, false
+	ctx, err := loader.init(ctx, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	if lsx.FileExists(v) {
-		buf, err := ioutil.ReadFile(v)
+
+	enc := json.NewEncoder(os.Stdout)
+	encode := func(config lsx.Config) {
+		if showSecrets {
+			enc.Encode(config.Reveal(ctx))
+			return
+		}
+		enc.Encode(config)
+	}
+
+	if watch {
+		w, err := lsx.NewConfigWatcher(ctx, loader.ConfigLoader)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "read config failed: %v\n", err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
-		config := lsx.Config{}
-		if err := json.Unmarshal(buf, &config); err != nil {
-			fmt.Fprintf(os.Stderr, "unmarshal config failed: %v\n", err)
+		if err := loader.loadPlugins(ctx, w.Config()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
-		return config, true
+		encode(w.Config())
+		for change := range w.Watch(ctx, "") {
+			encode(change.New.(lsx.Config))
+		}
+		return
 	}
-	config := lsx.Config{}
-	if err := json.Unmarshal([]byte(v), config); err != nil {
-		fmt.Fprintf(os.Stderr, "unmarshal config failed: %v\n", err)
+
+	config, configLayers, err := loader.Load(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	return config, true
+
+	if layers {
+		if !showSecrets {
+			enc.Encode(configLayers)
+			return
+		}
+		revealed := make([]revealedLayer, len(configLayers))
+		for i, l := range configLayers {
+			revealed[i] = revealedLayer{l.Kind, l.Source, l.Config.Reveal(ctx)}
+		}
+		enc.Encode(revealed)
+		return
+	}
+	encode(config)
+}
+
+// revealedLayer is a config layer whose secrets are not redacted.
+type revealedLayer struct {
+	Kind   lsx.ConfigLayerKind    `json:"kind"`
+	Source string                 `json:"source,omitempty"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// configLoader is a config loader that is configured with command-line
+// flags.
+//
+// The loader's layers are loaded by the config providers listed in the
+// "configs" section of the bootstrap config, followed by a file provider
+// for each config file and a dir provider for each conf.d directory
+// specified on the command line. An env provider is appended if the
+// bootstrap config does not list one.
+//
+// A plug-in listed in the bootstrap config or the config that fails to
+// load is reported as a warning, so the config can still be printed and
+// explained, unless requirePlugins is set by a command that uses the
+// plug-ins' modules.
+type configLoader struct {
+	*lsx.ConfigLoader
+	files          []string
+	dirs           []string
+	bootstrap      string
+	envPrefix      string
+	requirePlugins bool
+}
+
+// newConfigLoader returns a config loader and registers the flags used
+// to configure it with the provided flag set.
+func newConfigLoader(fs *flag.FlagSet) *configLoader {
+	l := &configLoader{
+		ConfigLoader: &lsx.ConfigLoader{
+			Defaults: defaultConfig,
+			Validate: func(ctx context.Context, config lsx.Config) error {
+				return config.Validate(ctx)
+			},
+		},
+	}
+	fs.Var((*stringsFlag)(&l.files), "config",
+		"a config file or inline JSON document; may be repeated")
+	fs.Var((*stringsFlag)(&l.dirs), "confd",
+		"a conf.d directory of config files; may be repeated")
+	fs.Var((*stringsFlag)(&l.Args), "set",
+		"a config override in the form path=value; may be repeated")
+	fs.StringVar(&l.bootstrap, "bootstrap", "",
+		"a config file whose configs section lists the config providers")
+	fs.StringVar(&l.envPrefix, "env-prefix", lsx.DefaultEnvPrefix,
+		"the prefix of the env vars that override config values")
+	return l
+}
+
+// init appends the provided files to the loader's files, loads the
+// plug-ins listed in the "modules" section of the bootstrap config,
+// creates the loader's config providers, and returns a context that
+// carries the loader's env var prefix. The plug-ins listed in the
+// config itself are loaded by Load. If no files or directories are specified
+// then the file named by LSX_CONFIG is used, and if no bootstrap config
+// is specified then the file named by LSX_BOOTSTRAP is used.
+func (l *configLoader) init(
+	ctx context.Context, files []string) (context.Context, error) {
+
+	ctx = lsx.WithEnvPrefix(ctx, l.envPrefix)
+	l.files = append(l.files, files...)
+	if len(l.files) == 0 && len(l.dirs) == 0 {
+		if v := os.Getenv("LSX_CONFIG"); v != "" {
+			l.files = append(l.files, v)
+		}
+	}
+	if l.bootstrap == "" {
+		l.bootstrap = os.Getenv("LSX_BOOTSTRAP")
+	}
+
+	bootstrap, err := l.bootstrapConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.loadPlugins(ctx, bootstrap); err != nil {
+		return nil, err
+	}
+	if l.Providers, err = lsx.NewConfigProviders(ctx, bootstrap); err != nil {
+		return nil, err
+	}
+	for _, p := range l.Providers {
+		if p.Name() != "env" {
+			return ctx, nil
+		}
+	}
+	return nil, errMissingConfig
+}
+
+// Load loads the config and then the plug-ins listed in its "modules"
+// section, so that every command sees the modules, and the config keys
+// they declare, of the plug-ins listed in either the bootstrap config or
+// the config.
+func (l *configLoader) Load(
+	ctx context.Context) (lsx.Config, lsx.ConfigLayers, error) {
+
+	config, layers, err := l.ConfigLoader.Load(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := l.loadPlugins(ctx, config); err != nil {
+		return nil, nil, err
+	}
+	return config, layers, nil
+}
+
+// loadPlugins loads the plug-ins listed in the config's "modules"
+// section. The plug-ins that fail to load are printed as a warning
+// unless the loader requires them.
+func (l *configLoader) loadPlugins(ctx context.Context, config lsx.Config) error {
+	err := lsx.LoadPlugins(ctx, config)
+	if err == nil || l.requirePlugins {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "warning: %s\n",
+		strings.TrimPrefix(err.Error(), "error: "))
+	return nil
+}
+
+// bootstrapConfig returns the bootstrap config with the providers of
+// the config files and conf.d directories specified on the command line
+// appended to its configs section.
+func (l *configLoader) bootstrapConfig(ctx context.Context) (lsx.Config, error) {
+	bootstrap := lsx.Config{}
+	if l.bootstrap != "" {
+		var err error
+		loader := &lsx.ConfigLoader{Files: []string{l.bootstrap}}
+		if bootstrap, _, err = loader.Load(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var configs []interface{}
+	if v := bootstrap.Get(ctx, "configs"); v != nil {
+		var ok bool
+		if configs, ok = v.([]interface{}); !ok {
+			return nil, fmt.Errorf(
+				"error: invalid bootstrap config: configs must be an array")
+		}
+	}
+	hasEnv := false
+	for _, c := range configs {
+		if m, ok := c.(map[string]interface{}); ok && m["type"] == "env" {
+			hasEnv = true
+		}
+	}
+	for _, f := range l.files {
+		configs = append(configs, map[string]interface{}{
+			"type": "file",
+			"path": f,
+		})
+	}
+	for _, d := range l.dirs {
+		configs = append(configs, map[string]interface{}{
+			"type": "dir",
+			"path": d,
+		})
+	}
+	if !hasEnv {
+		configs = append(configs, map[string]interface{}{"type": "env"})
+	}
+	if err := bootstrap.Set(ctx, "configs", configs); err != nil {
+		return nil, err
+	}
+	return bootstrap, nil
+}
+
+// stringsFlag is a flag.Value that may be specified more than once.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
 }
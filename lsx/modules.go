@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/akutz/lsx"
+)
+
+// modulesCmds are the sub-commands of the "modules" command.
+var modulesCmds = map[string]func(ctx context.Context, args []string) error{
+	"graph": modulesGraphCmd,
+	"list":  modulesListCmd,
+}
+
+// modulesCmd executes the "modules" command.
+func modulesCmd(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lsx modules <command> [arguments]")
+	}
+	cmd, ok := modulesCmds[args[0]]
+	if !ok {
+		return fmt.Errorf("error: unknown modules command: %s", args[0])
+	}
+	return cmd(ctx, args[1:])
+}
+
+// modulesGraphCmd prints the graph of the module instances defined by
+// the config and the dependencies between them in the Graphviz DOT
+// language:
+//
+//	lsx modules graph [-check] [-config FILE] [-confd DIR]
+//	                  [-set PATH=VALUE] [-env-prefix PREFIX] [FILE...]
+//
+// The plug-ins listed in the config's "modules" section are loaded
+// first, and a plug-in that fails to load is an error. The graph is printed even if it has cycles or missing modules,
+// which are reported as an error if -check is specified.
+func modulesGraphCmd(ctx context.Context, args []string) error {
+	var (
+		fs     = flag.NewFlagSet("modules graph", flag.ContinueOnError)
+		loader = newConfigLoader(fs)
+		check  = fs.Bool("check", false,
+			"fail if the graph has cycles or missing modules")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	loader.requirePlugins = true
+	ctx, err := loader.init(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+	config, _, err := loader.Load(ctx)
+	if err != nil {
+		return err
+	}
+	g := lsx.NewModuleGraph(ctx, config)
+	if err := g.WriteDOT(os.Stdout); err != nil {
+		return err
+	}
+	if *check {
+		_, err := g.Sort()
+		return err
+	}
+	return nil
+}
+
+// modulesListCmd prints the registered modules and the packages and
+// plug-ins that registered them:
+//
+//	lsx modules list [-json] [-config FILE] [-confd DIR]
+//	                 [-set PATH=VALUE] [-env-prefix PREFIX] [FILE...]
+//
+// The plug-ins listed in the "modules" sections of the bootstrap config
+// and of the config are loaded first, and a plug-in that fails to load
+// is an error.
+func modulesListCmd(ctx context.Context, args []string) error {
+	var (
+		fs     = flag.NewFlagSet("modules list", flag.ContinueOnError)
+		loader = newConfigLoader(fs)
+		asJSON = fs.Bool("json", false, "print the modules as JSON")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	loader.requirePlugins = true
+	ctx, err := loader.init(ctx, fs.Args())
+	if err != nil {
+		return err
+	}
+	if _, _, err := loader.Load(ctx); err != nil {
+		return err
+	}
+
+	mods := lsx.ContextRegistry(ctx).List()
+	if *asJSON {
+		if mods == nil {
+			mods = []lsx.ModuleInfo{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(mods)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tNAME\tPACKAGE\tPLUGIN")
+	for _, m := range mods {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			m.Type, m.Name, m.Package, m.Plugin)
+	}
+	return w.Flush()
+}
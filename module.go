@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"math"
 	"strings"
-	"sync"
 )
 
 // Module is the interface that defines the basis for this program's
 // modular components.
+//
+// A module may also implement Starter, Stopper, and HealthChecker in
+// order to take part in the rest of its lifecycle; please see Runtime.
 type Module interface {
 	// Name returns the name of the module.
 	Name() string
@@ -21,11 +23,6 @@ type Module interface {
 	Init(ctx context.Context) error
 }
 
-var (
-	mods    = map[ModuleType]map[string]func() Module{}
-	modsRWL = sync.RWMutex{}
-)
-
 // ModuleType is used to define constant module types.
 type ModuleType uint8
 
@@ -52,12 +49,16 @@ const (
 	// VolumeModuleType is a module that provides an implementation of the
 	// VolumeDriver interface.
 	VolumeModuleType
+
+	// ServiceModuleType is a module that provides an implementation of
+	// the Service interface.
+	ServiceModuleType
 )
 
 const (
 	// maxModuleType is the max, valid module type. Used for iterating the
 	// module type constants.
-	maxModuleType = VolumeModuleType
+	maxModuleType = ServiceModuleType
 )
 
 // String returns the module type's string representation.
@@ -73,10 +74,17 @@ func (t ModuleType) String() string {
 		return "server"
 	case VolumeModuleType:
 		return "volume"
+	case ServiceModuleType:
+		return "service"
 	}
 	return "invalid"
 }
 
+// MarshalText marshals the module type to its string representation.
+func (t ModuleType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 // ParseModuleType parses a numeric, string, or ModuleType value and
 // returns the corresponding module type.
 func ParseModuleType(v interface{}) (ModuleType, error) {
@@ -183,26 +191,27 @@ func errUnknownModuleType(v interface{}) (ModuleType, error) {
 	return 0, fmt.Errorf("error: invalid module type: %v", v)
 }
 
-// RegisterModule a new module.
-func RegisterModule(modType ModuleType, modName string, modCtor func() Module) {
-	modsRWL.Lock()
-	defer modsRWL.Unlock()
-	modCtorMap, ok := mods[modType]
-	if !ok {
-		modCtorMap = map[string]func() Module{}
-		mods[modType] = modCtorMap
-	}
-	modCtorMap[modName] = modCtor
+// RegisterModule a new module with DefaultRegistry, or with the
+// registry of the PluginLoader that is loading a plug-in; please see
+// Registry.Register.
+func RegisterModule(
+	modType ModuleType, modName string, modCtor func() Module,
+	keys ...ModuleConfigKey) error {
+
+	return registrationRegistry().Register(modType, modName, modCtor, keys...)
+}
+
+// MustRegisterModule is like RegisterModule but panics if the module
+// cannot be registered.
+func MustRegisterModule(
+	modType ModuleType, modName string, modCtor func() Module,
+	keys ...ModuleConfigKey) {
+
+	registrationRegistry().MustRegister(modType, modName, modCtor, keys...)
 }
 
-// NewModule returns a new instance of a registered module type.
+// NewModule returns a new instance of a module registered with
+// DefaultRegistry.
 func NewModule(modType ModuleType, modName string) Module {
-	serverCtorsRWL.RLock()
-	defer serverCtorsRWL.RUnlock()
-	if a, ok := mods[modType]; ok {
-		if b, ok := a[modName]; ok {
-			return b()
-		}
-	}
-	return nil
+	return DefaultRegistry.New(modType, modName)
 }
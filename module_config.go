@@ -0,0 +1,208 @@
+package lsx
+
+import (
+	"context"
+	"fmt"
+)
+
+// ModuleConfigKey describes a config key read by a module.
+type ModuleConfigKey struct {
+	// Path is the path of the key relative to the module's scope.
+	Path string `json:"path"`
+
+	// Type is the JSON schema type name of the key's value, ex. string,
+	// integer, number, boolean, object, or array.
+	Type string `json:"type,omitempty"`
+
+	// Default is the value used when the key is not defined.
+	Default interface{} `json:"default,omitempty"`
+
+	// Description describes the key.
+	Description string `json:"description,omitempty"`
+
+	// Deprecated is the deprecated path of the key relative to the
+	// module's scope, if the key was renamed.
+	Deprecated string `json:"deprecated,omitempty"`
+}
+
+// ModuleConfig describes the config keys declared by a registered
+// module.
+type ModuleConfig struct {
+	// Type is the type of the module.
+	Type ModuleType `json:"type"`
+
+	// Name is the name of the module.
+	Name string `json:"name"`
+
+	// Keys are the config keys declared by the module, in the order in
+	// which they were declared.
+	Keys []ModuleConfigKey `json:"keys"`
+}
+
+// moduleConfig is the compiled form of a module's config keys.
+type moduleConfig struct {
+	ModuleConfig
+
+	// defaults is a config tree of the keys' default values.
+	defaults Config
+
+	// aliases are the keys that have deprecated paths.
+	aliases []moduleConfigAlias
+}
+
+// moduleConfigAlias is a key with a deprecated path.
+type moduleConfigAlias struct {
+	path, alias []configPathToken
+}
+
+// newModuleConfig compiles the config keys declared by a module. An
+// error is returned if a key's path or deprecated path is invalid, or
+// if a key's default value is not of the key's type.
+func newModuleConfig(
+	modType ModuleType, modName string,
+	keys []ModuleConfigKey) (*moduleConfig, error) {
+
+	mc := &moduleConfig{
+		ModuleConfig: ModuleConfig{Type: modType, Name: modName, Keys: keys},
+		defaults:     Config{},
+	}
+	ctx := context.Background()
+	for _, k := range keys {
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf(
+				"error: invalid module config key: %s %s: path=%s: %s",
+				modType, modName, k.Path, fmt.Sprintf(format, args...))
+		}
+		p, err := CompilePath(k.Path)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if k.Default != nil {
+			if k.Type != "" && !schemaTypeMatches(k.Type, k.Default) {
+				return nil, fail("expected %s default, actual %s",
+					k.Type, jsonTypeOf(k.Default))
+			}
+			if err := mc.defaults.Set(ctx, k.Path, k.Default); err != nil {
+				return nil, fail("%v", err)
+			}
+		}
+		if k.Deprecated != "" {
+			alias, err := CompilePath(k.Deprecated)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			mc.aliases = append(mc.aliases, moduleConfigAlias{
+				path:  p.tokens,
+				alias: alias.tokens,
+			})
+		}
+	}
+	return mc, nil
+}
+
+// ModuleConfigs returns the config keys declared by the modules
+// registered with DefaultRegistry; please see Registry.Configs.
+func ModuleConfigs() []ModuleConfig {
+	return DefaultRegistry.Configs()
+}
+
+// configKey returns the top-level config key of the array that lists
+// the instances of the module type, ex. servers.
+func (t ModuleType) configKey() string {
+	return t.String() + "s"
+}
+
+// moduleConfigFor returns the config keys of the module whose scope
+// contains the value at the absolute path formed by the tokens, and
+// the tokens of the path relative to the module's scope.
+//
+// A module's scope is an element of the top-level array named after
+// the module's type, ex. servers for a server module, whose "type" is
+// the name of the module, ex. servers.svr01 with "type": "csi" is the
+// scope of the server module named csi.
+func (c Config) moduleConfigFor(
+	ctx context.Context,
+	tokens []configPathToken) (*moduleConfig, []configPathToken) {
+
+	if len(tokens) < 3 || tokens[0].kind != keyConfigPathToken {
+		return nil, nil
+	}
+	modType := InvalidModuleType
+	for mt := InvalidModuleType + 1; mt <= maxModuleType; mt++ {
+		if tokens[0].fold == mt.configKey() {
+			modType = mt
+			break
+		}
+	}
+	if modType == InvalidModuleType {
+		return nil, nil
+	}
+
+	reg := ContextRegistry(ctx)
+	if !reg.hasConfigs(modType) {
+		return nil, nil
+	}
+
+	el, ok := c.root(ctx).lookupPath(
+		ctx, &ConfigPath{tokens: tokens[:2]}).(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	mc := reg.config(modType, toStringWithOpts(el["type"], false))
+	if mc == nil {
+		return nil, nil
+	}
+	return mc, tokens[2:]
+}
+
+// moduleDefault returns the value of the path in the Config instance
+// that is provided by the declared config keys of the module whose
+// scope contains the path, along with the absolute path from which the
+// value was read. Please see moduleConfigFor.
+//
+// If the module's scope defines the deprecated path of the key, the
+// value at the deprecated path is returned. Otherwise the default
+// value of the key is returned.
+func (c Config) moduleDefault(
+	ctx context.Context, p *ConfigPath) (interface{}, string, *moduleConfig) {
+
+	scope := c.scopeInfo(ctx)
+	tokens := append(scope.tokens[:len(scope.tokens):len(scope.tokens)],
+		p.tokens...)
+	mc, rel := c.moduleConfigFor(ctx, tokens)
+	if mc == nil {
+		return nil, "", nil
+	}
+
+	for _, a := range mc.aliases {
+		if !hasConfigPathTokensPrefix(rel, a.path) {
+			continue
+		}
+		abs := append(tokens[:2:2], a.alias...)
+		abs = append(abs, rel[len(a.path):]...)
+		if v := c.root(ctx).lookupPath(ctx, &ConfigPath{tokens: abs}); v != nil {
+			return v, configPathTokensString(abs), mc
+		}
+	}
+
+	if v := lookupConfigPathTokens(mc.defaults, rel); v != nil {
+		return copyConfigValue(v), configPathTokensString(tokens), mc
+	}
+	return nil, "", nil
+}
+
+// hasConfigPathTokensPrefix returns a flag indicating whether the
+// prefix matches the leading tokens case-insensitively.
+func hasConfigPathTokensPrefix(tokens, prefix []configPathToken) bool {
+	if len(tokens) < len(prefix) {
+		return false
+	}
+	for i, tok := range prefix {
+		if tok.kind != tokens[i].kind ||
+			tok.fold != tokens[i].fold ||
+			tok.index != tokens[i].index {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package lsx_test
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/akutz/lsx"
+)
+
+var testModuleConfigKeys = []lsx.ModuleConfigKey{
+	{
+		Path:        "timeout",
+		Type:        "string",
+		Default:     "30s",
+		Description: "The request timeout.",
+	},
+	{
+		Path:        "tls.enabled",
+		Type:        "boolean",
+		Default:     false,
+		Description: "A flag indicating whether TLS is enabled.",
+	},
+	{
+		Path:       "addrs",
+		Type:       "array",
+		Default:    []interface{}{"tcp://127.0.0.1:7981"},
+		Deprecated: "listen",
+	},
+	{
+		Path:    "logging.level",
+		Type:    "string",
+		Default: "warn",
+	},
+}
+
+func init() {
+	lsx.MustRegisterModule(
+		lsx.ServerModuleType, "lsx-test-defaults",
+		func() lsx.Module { return nil },
+		testModuleConfigKeys...)
+}
+
+var _ = Describe("Module config keys", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal([]byte(`{
+			"logging": {"level": "debug"},
+			"servers": [
+				{"name": "svr00", "type": "LSX-TEST-DEFAULTS", "timeout": "1m"},
+				{"name": "svr01", "type": "lsx-test-defaults",
+				 "listen": ["tcp://:7982"]},
+				{"name": "svr02", "type": "csi"}
+			]
+		}`), &config)).Should(Succeed())
+	})
+	AfterEach(func() {
+		config = nil
+	})
+
+	It("should list the declared keys", func() {
+		var mc *lsx.ModuleConfig
+		for _, c := range lsx.ModuleConfigs() {
+			if c.Name == "lsx-test-defaults" {
+				c := c
+				mc = &c
+			}
+		}
+		Ω(mc).ShouldNot(BeNil())
+		Ω(mc.Type).Should(Equal(lsx.ServerModuleType))
+		Ω(mc.Keys).Should(Equal(testModuleConfigKeys))
+		buf, err := json.Marshal(mc)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(buf)).Should(ContainSubstring(`"type":"server"`))
+	})
+
+	It("should get the defaults in the module's scope", func() {
+		svr := config.Scope(ctx, "servers.svr00")
+		Ω(svr.Get(ctx, "timeout")).Should(Equal("1m"))
+		Ω(svr.Get(ctx, "tls.enabled")).Should(Equal(false))
+		Ω(svr.Get(ctx, "tls")).Should(Equal(
+			map[string]interface{}{"enabled": false}))
+		Ω(svr.Scope(ctx, "tls")).Should(BeNil())
+		Ω(svr.Get(ctx, "addrs")).Should(Equal(
+			[]interface{}{"tcp://127.0.0.1:7981"}))
+		Ω(config.Get(ctx, "servers.svr00.tls.enabled")).Should(Equal(false))
+		Ω(config.Get(ctx, "servers.svr02.tls.enabled")).Should(BeNil())
+		Ω(config.Get(ctx, "tls.enabled")).Should(BeNil())
+	})
+
+	It("should prefer inherited values to the defaults", func() {
+		svr := config.Scope(ctx, "servers.svr00")
+		Ω(svr.Get(ctx, "logging.level")).Should(Equal("debug"))
+		Ω(config.Delete(ctx, "logging")).Should(Succeed())
+		Ω(svr.Get(ctx, "logging.level")).Should(Equal("warn"))
+	})
+
+	It("should get the values of deprecated paths", func() {
+		svr := config.Scope(ctx, "servers.svr01")
+		Ω(svr.Get(ctx, "addrs")).Should(Equal([]interface{}{"tcp://:7982"}))
+		Ω(svr.Get(ctx, "addrs[0]")).Should(Equal("tcp://:7982"))
+		Ω(svr.Get(ctx, "timeout")).Should(Equal("30s"))
+	})
+
+	It("should explain the defaults", func() {
+		e := config.Scope(ctx, "servers.svr00").Explain(ctx, "tls.enabled")
+		Ω(e.Found).Should(BeTrue())
+		Ω(e.Value).Should(Equal(false))
+		step := e.Steps[len(e.Steps)-1]
+		Ω(step.Kind).Should(Equal(lsx.ModuleConfigExplainStep))
+		Ω(step.Module).Should(Equal("server:lsx-test-defaults"))
+		Ω(step.Path).Should(Equal("servers.svr00.tls.enabled"))
+		Ω(e.String()).Should(ContainSubstring(
+			"found in server:lsx-test-defaults"))
+
+		e = config.Explain(ctx, "servers.svr01.addrs")
+		Ω(e.Steps[len(e.Steps)-1].Path).Should(Equal("servers.svr01.listen"))
+	})
+
+	It("should decode the defaults", func() {
+		var svr struct {
+			Timeout string   `json:"timeout"`
+			Addrs   []string `json:"addrs"`
+		}
+		Ω(config.Decode(ctx, "servers.svr01", &svr)).Should(Succeed())
+		Ω(svr.Timeout).Should(Equal("30s"))
+		Ω(svr.Addrs).Should(Equal([]string{"tcp://:7982"}))
+	})
+
+	It("should panic for invalid keys", func() {
+		register := func(key lsx.ModuleConfigKey) func() {
+			return func() {
+				lsx.MustRegisterModule(
+					lsx.ServerModuleType, "lsx-test-invalid",
+					func() lsx.Module { return nil }, key)
+			}
+		}
+		Ω(register(lsx.ModuleConfigKey{Path: "a..b"})).Should(Panic())
+		Ω(register(lsx.ModuleConfigKey{
+			Path: "a", Deprecated: "b[",
+		})).Should(Panic())
+		Ω(register(lsx.ModuleConfigKey{
+			Path: "a", Type: "integer", Default: "1",
+		})).Should(Panic())
+	})
+})
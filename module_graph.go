@@ -0,0 +1,399 @@
+package lsx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ModuleRef refers to a module instance by the instance's type and
+// name, ex. the server named svr00 in the config's "servers" array.
+type ModuleRef struct {
+	// Type is the type of the module.
+	Type ModuleType `json:"type"`
+
+	// Name is the name of the module instance.
+	Name string `json:"name"`
+}
+
+// String returns the reference as type:name.
+func (r ModuleRef) String() string {
+	return r.Type.String() + ":" + r.Name
+}
+
+// key returns the key of the reference in a ModuleGraph. Names are
+// matched case-insensitively, the same way Get matches them.
+func (r ModuleRef) key() ModuleRef {
+	return ModuleRef{r.Type, strings.ToLower(r.Name)}
+}
+
+// Dependent is an optional interface implemented by modules that
+// depend on other module instances in addition to the dependencies
+// implied by the config; please see NewModuleGraph.
+type Dependent interface {
+	// Dependencies returns the module instances on which the module
+	// depends. The context stores the module's scope with ConfigKey.
+	Dependencies(ctx context.Context) []ModuleRef
+}
+
+// ModuleNode is a module instance in a ModuleGraph.
+type ModuleNode struct {
+	// Ref refers to the module instance.
+	Ref ModuleRef `json:"ref"`
+
+	// Module is the name of the registered module that provides the
+	// instance, ex. the value of a server's "type" field. Module is
+	// empty if the instance is defined by the config alone, such as a
+	// service without a "type".
+	Module string `json:"module,omitempty"`
+
+	// Scope is the path of the instance's scope, ex. servers.svr00. The
+	// root scope's path is empty.
+	Scope string `json:"scope,omitempty"`
+
+	// Deps are the module instances on which the instance depends, in
+	// the order in which they were declared.
+	Deps []ModuleRef `json:"deps,omitempty"`
+
+	// mod is the instance, or nil if the instance has no module or the
+	// module is not registered.
+	mod Module
+}
+
+// ModuleGraph is the graph of the module instances defined by a config
+// and of the dependencies between them.
+type ModuleGraph struct {
+	config Config
+	reg    *Registry
+	nodes  map[ModuleRef]*ModuleNode
+	errs   MultiError
+}
+
+// NewModuleGraph returns the graph of the module instances defined by
+// the config:
+//
+//	instances     each element of a top-level array named after a
+//	              module type, ex. servers or services, is an instance
+//	              of the module named by the element's "type"
+//
+//	servers       a server depends on the services that list it in
+//	              their "servers" arrays
+//
+//	operations    a service depends on the modules named by the "type"
+//	              of each of its volume API operations, ex.
+//	              services.svc00.api.volume.attach.type, which are
+//	              volume modules if one is registered with the name and
+//	              client modules otherwise
+//
+//	Dependent     an instance also depends on the instances returned
+//	              by its module's Dependencies function
+//
+// The modules of the instances are constructed from the registry stored
+// in the context with WithRegistry, or from DefaultRegistry, but they
+// are not initialized.
+// A volume or client module that is referred to by a volume API
+// operation or by a Dependencies function but is not an element of
+// the config is a single, shared instance named after the module, with
+// the root scope.
+//
+// Instances whose modules are not registered, and dependencies on
+// instances that do not exist, are reported by Sort.
+func NewModuleGraph(ctx context.Context, config Config) *ModuleGraph {
+	g := &ModuleGraph{
+		config: config,
+		reg:    ContextRegistry(ctx),
+		nodes:  map[ModuleRef]*ModuleNode{},
+	}
+	m, _ := toStringMap(config)
+
+	for mt := InvalidModuleType + 1; mt <= maxModuleType; mt++ {
+		if mt == ConfigModuleType {
+			continue
+		}
+		key := mt.configKey()
+		for _, el := range namedElements(m, key) {
+			typ, _ := el.value["type"].(string)
+			g.addNode(ctx, ModuleRef{mt, el.name}, typ, key+"."+el.name)
+		}
+	}
+
+	for _, svc := range namedElements(m, ServiceModuleType.configKey()) {
+		svcRef := ModuleRef{ServiceModuleType, svc.name}
+		svrs, _ := svc.value["servers"].([]interface{})
+		for _, v := range svrs {
+			name, ok := v.(string)
+			if !ok {
+				continue
+			}
+			svrRef := ModuleRef{ServerModuleType, name}
+			if n, ok := g.nodes[svrRef.key()]; ok {
+				n.addDep(svcRef)
+				continue
+			}
+			g.errs = append(g.errs, fmt.Errorf(
+				"error: missing module: %s refers to %s", svcRef, svrRef))
+		}
+
+		api, _ := svc.value["api"].(map[string]interface{})
+		vol, _ := api["volume"].(map[string]interface{})
+		for _, op := range sortedKeys(vol) {
+			opm, _ := vol[op].(map[string]interface{})
+			typ, ok := opm["type"].(string)
+			if !ok {
+				continue
+			}
+			ref := ModuleRef{ClientModuleType, typ}
+			if _, ok := g.reg.Lookup(VolumeModuleType, typ); ok {
+				ref.Type = VolumeModuleType
+			}
+			g.nodes[svcRef.key()].addDep(ref)
+		}
+	}
+
+	// add the dependencies declared by the modules, which may add
+	// shared instances that declare dependencies of their own
+	done := map[ModuleRef]bool{}
+	for {
+		var pending []*ModuleNode
+		for _, n := range g.Nodes() {
+			if !done[n.Ref.key()] {
+				pending = append(pending, n)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+		for _, n := range pending {
+			done[n.Ref.key()] = true
+			if d, ok := n.mod.(Dependent); ok {
+				for _, ref := range d.Dependencies(g.scopeContext(ctx, n)) {
+					n.addDep(ref)
+				}
+			}
+			for _, ref := range n.Deps {
+				if _, ok := g.nodes[ref.key()]; ok {
+					continue
+				}
+				if ref.Type == VolumeModuleType ||
+					ref.Type == ClientModuleType {
+					g.addNode(ctx, ref, ref.Name, "")
+					continue
+				}
+				g.errs = append(g.errs, fmt.Errorf(
+					"error: missing module: %s depends on %s", n.Ref, ref))
+			}
+		}
+	}
+
+	return g
+}
+
+// addNode adds an instance of the named module to the graph and
+// constructs the module if it is registered.
+func (g *ModuleGraph) addNode(
+	ctx context.Context, ref ModuleRef, modName, scope string) {
+
+	n := &ModuleNode{Ref: ref, Module: modName, Scope: scope}
+	g.nodes[ref.key()] = n
+	if modName == "" {
+		return
+	}
+	if n.mod = g.reg.New(ref.Type, modName); n.mod == nil {
+		g.errs = append(g.errs, fmt.Errorf(
+			"error: missing module: %s: no %s module named %s",
+			ref, ref.Type, modName))
+	}
+}
+
+// addDep adds a dependency to the node unless the node already
+// depends on the same instance.
+func (n *ModuleNode) addDep(ref ModuleRef) {
+	for _, d := range n.Deps {
+		if d.key() == ref.key() {
+			return
+		}
+	}
+	n.Deps = append(n.Deps, ref)
+}
+
+// scopeContext returns a context that stores the node's scope with
+// ConfigKey.
+func (g *ModuleGraph) scopeContext(
+	ctx context.Context, n *ModuleNode) context.Context {
+
+	return context.WithValue(ctx, ConfigKey, g.scope(ctx, n))
+}
+
+// scope returns the node's scope of the config.
+func (g *ModuleGraph) scope(ctx context.Context, n *ModuleNode) Config {
+	if n.Scope == "" {
+		return g.config
+	}
+	return g.config.Scope(ctx, n.Scope)
+}
+
+// Nodes returns the graph's nodes sorted by type and name.
+func (g *ModuleGraph) Nodes() []*ModuleNode {
+	nodes := make([]*ModuleNode, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i].Ref.key(), nodes[j].Ref.key()
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+	return nodes
+}
+
+// Module returns the module of the referenced instance, or nil if the
+// instance does not exist, has no module, or its module is not
+// registered.
+func (g *ModuleGraph) Module(ref ModuleRef) Module {
+	if n, ok := g.nodes[ref.key()]; ok {
+		return n.mod
+	}
+	return nil
+}
+
+// Sort returns the graph's nodes in topological order, so that every
+// node follows the nodes on which it depends. Nodes that do not depend
+// on one another are ordered by type and name.
+//
+// An error is returned if an instance's module is not registered, if an
+// instance depends on an instance that does not exist, or if instances
+// depend on one another in a cycle. The errors are returned as a
+// MultiError.
+func (g *ModuleGraph) Sort() ([]*ModuleNode, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		errs   = append(MultiError{}, g.errs...)
+		state  = map[ModuleRef]int{}
+		sorted []*ModuleNode
+		path   []*ModuleNode
+		visit  func(n *ModuleNode)
+	)
+	visit = func(n *ModuleNode) {
+		switch state[n.Ref.key()] {
+		case visited:
+			return
+		case visiting:
+			cycle := []string{}
+			for i := len(path) - 1; i >= 0; i-- {
+				cycle = append([]string{path[i].Ref.String()}, cycle...)
+				if path[i] == n {
+					break
+				}
+			}
+			cycle = append(cycle, n.Ref.String())
+			errs = append(errs, fmt.Errorf(
+				"error: module dependency cycle: %s",
+				strings.Join(cycle, " -> ")))
+			return
+		}
+		state[n.Ref.key()] = visiting
+		path = append(path, n)
+		for _, ref := range n.Deps {
+			if dep, ok := g.nodes[ref.key()]; ok {
+				visit(dep)
+			}
+		}
+		path = path[:len(path)-1]
+		state[n.Ref.key()] = visited
+		sorted = append(sorted, n)
+	}
+	for _, n := range g.Nodes() {
+		visit(n)
+	}
+	if err := errs.ErrOrNil(); err != nil {
+		return nil, err
+	}
+	return sorted, nil
+}
+
+// NewRuntime returns a runtime for the modules of the graph's instances
+// in topological order; please see Sort. Each module is initialized and
+// started with a context that stores the module's scope with ConfigKey.
+// Instances without a module are skipped.
+func (g *ModuleGraph) NewRuntime(ctx context.Context) (*Runtime, error) {
+	nodes, err := g.Sort()
+	if err != nil {
+		return nil, err
+	}
+	r := &Runtime{}
+	for _, n := range nodes {
+		if n.mod == nil {
+			continue
+		}
+		r.mods = append(r.mods, n.mod)
+		r.scopes = append(r.scopes, g.scope(ctx, n))
+	}
+	return r, nil
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. An edge
+// points from an instance to an instance on which it depends. The
+// instances whose modules are not registered, and the dependencies that
+// do not exist, are drawn with dashed lines.
+func (g *ModuleGraph) WriteDOT(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("digraph modules {\n")
+	missing := map[ModuleRef]ModuleRef{}
+	for _, n := range g.Nodes() {
+		label := n.Ref.String()
+		if n.Module != "" {
+			label += "\n" + n.Module
+		}
+		ew.printf("\t%q [label=%q", n.Ref.String(), label)
+		if n.Module != "" && n.mod == nil {
+			ew.printf(", style=dashed")
+		}
+		ew.printf("];\n")
+		for _, ref := range n.Deps {
+			if _, ok := g.nodes[ref.key()]; !ok {
+				missing[ref.key()] = ref
+			}
+		}
+	}
+	refs := make([]ModuleRef, 0, len(missing))
+	for _, ref := range missing {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].String() < refs[j].String()
+	})
+	for _, ref := range refs {
+		ew.printf("\t%q [style=dashed];\n", ref.String())
+	}
+	for _, n := range g.Nodes() {
+		for _, ref := range n.Deps {
+			if dep, ok := g.nodes[ref.key()]; ok {
+				ref = dep.Ref
+			}
+			ew.printf("\t%q -> %q;\n", n.Ref.String(), ref.String())
+		}
+	}
+	ew.printf("}\n")
+	return ew.err
+}
+
+// errWriter is an io.Writer that remembers the first error that
+// occurs and discards the writes that follow it.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) printf(format string, args ...interface{}) {
+	if w.err == nil {
+		_, w.err = fmt.Fprintf(w.w, format, args...)
+	}
+}
@@ -0,0 +1,187 @@
+package lsx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/akutz/lsx"
+)
+
+// graphEvents records the initialization of graphModule instances.
+var graphEvents = &lifecycleEvents{}
+
+// graphModule is a test module whose instances depend on the servers
+// listed in the "after" array of their scopes.
+type graphModule struct {
+	typ  lsx.ModuleType
+	name string
+}
+
+func (m *graphModule) Name() string { return m.name }
+func (m *graphModule) Type() string { return m.typ.String() }
+
+func (m *graphModule) Init(ctx context.Context) error {
+	scope := ctx.Value(lsx.ConfigKey).(lsx.Config)
+	graphEvents.add(m.typ.String() + ":" + scope.FullPath(ctx, ""))
+	return nil
+}
+
+func (m *graphModule) Dependencies(ctx context.Context) []lsx.ModuleRef {
+	scope := ctx.Value(lsx.ConfigKey).(lsx.Config)
+	var refs []lsx.ModuleRef
+	for _, name := range scope.GetStringSlice(ctx, "after") {
+		refs = append(refs, lsx.ModuleRef{
+			Type: lsx.ServerModuleType,
+			Name: name,
+		})
+	}
+	return refs
+}
+
+func init() {
+	for _, mt := range []lsx.ModuleType{
+		lsx.ServerModuleType,
+		lsx.ServiceModuleType,
+		lsx.VolumeModuleType,
+		lsx.ClientModuleType,
+	} {
+		mt := mt
+		lsx.MustRegisterModule(mt, "lsx-test-graph", func() lsx.Module {
+			return &graphModule{typ: mt, name: "lsx-test-graph"}
+		})
+	}
+	lsx.MustRegisterModule(lsx.ClientModuleType, "lsx-test-graph-client",
+		func() lsx.Module {
+			return &graphModule{
+				typ:  lsx.ClientModuleType,
+				name: "lsx-test-graph-client",
+			}
+		})
+}
+
+var _ = Describe("ModuleGraph", func() {
+
+	var (
+		ctx    context.Context
+		config lsx.Config
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		config = lsx.Config{}
+		Ω(json.Unmarshal([]byte(`{
+			"servers": [
+				{"name": "svr00", "type": "lsx-test-graph"},
+				{"name": "svr01", "type": "lsx-test-graph"}
+			],
+			"services": [
+				{
+					"name": "svc00",
+					"type": "lsx-test-graph",
+					"servers": ["svr00", "svr01"],
+					"api": {
+						"volume": {
+							"attach": {"type": "lsx-test-graph"},
+							"mount": {
+								"type": "lsx-test-graph-client",
+								"host": "tcp://127.0.0.1:7979"
+							}
+						}
+					}
+				}
+			]
+		}`), &config)).Should(Succeed())
+	})
+
+	refs := func(nodes []*lsx.ModuleNode) []string {
+		var s []string
+		for _, n := range nodes {
+			s = append(s, n.Ref.String())
+		}
+		return s
+	}
+
+	It("should derive the dependencies from the config", func() {
+		g := lsx.NewModuleGraph(ctx, config)
+		nodes := g.Nodes()
+		Ω(refs(nodes)).Should(Equal([]string{
+			"client:lsx-test-graph-client",
+			"server:svr00",
+			"server:svr01",
+			"volume:lsx-test-graph",
+			"service:svc00",
+		}))
+		Ω(nodes[1].Module).Should(Equal("lsx-test-graph"))
+		Ω(nodes[1].Scope).Should(Equal("servers.svr00"))
+		Ω(nodes[1].Deps).Should(Equal([]lsx.ModuleRef{
+			{Type: lsx.ServiceModuleType, Name: "svc00"},
+		}))
+		Ω(nodes[4].Deps).Should(Equal([]lsx.ModuleRef{
+			{Type: lsx.VolumeModuleType, Name: "lsx-test-graph"},
+			{Type: lsx.ClientModuleType, Name: "lsx-test-graph-client"},
+		}))
+		Ω(g.Module(nodes[0].Ref)).ShouldNot(BeNil())
+	})
+	It("should sort the nodes topologically", func() {
+		nodes, err := lsx.NewModuleGraph(ctx, config).Sort()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(refs(nodes)).Should(Equal([]string{
+			"client:lsx-test-graph-client",
+			"volume:lsx-test-graph",
+			"service:svc00",
+			"server:svr00",
+			"server:svr01",
+		}))
+	})
+	It("should initialize the modules in order with their scopes", func() {
+		r, err := lsx.NewModuleGraph(ctx, config).NewRuntime(ctx)
+		Ω(err).ShouldNot(HaveOccurred())
+		graphEvents = &lifecycleEvents{}
+		Ω(r.Start(ctx)).Should(Succeed())
+		Ω(graphEvents.list()).Should(Equal([]string{
+			"client:", "volume:", "service:services.svc00",
+			"server:servers.svr00", "server:servers.svr01",
+		}))
+		Ω(r.Stop(ctx)).Should(Succeed())
+	})
+	It("should detect cycles", func() {
+		Ω(config.Set(ctx, "services.svc00.after", []interface{}{"svr01"})).
+			Should(Succeed())
+		_, err := lsx.NewModuleGraph(ctx, config).Sort()
+		Ω(err).Should(MatchError("error: module dependency cycle: " +
+			"service:svc00 -> server:svr01 -> service:svc00"))
+	})
+	It("should report missing modules and instances", func() {
+		Ω(config.Set(ctx, "servers.svr01.type", "csi")).Should(Succeed())
+		Ω(config.Set(ctx, "services.svc00.servers",
+			[]interface{}{"svr00", "svr09"})).Should(Succeed())
+		Ω(config.Set(ctx, "services.svc00.after",
+			[]interface{}{"svr08"})).Should(Succeed())
+		_, err := lsx.NewModuleGraph(ctx, config).Sort()
+		Ω(err).Should(HaveLen(3))
+		Ω(err.(lsx.MultiError)[0]).Should(MatchError(
+			"error: missing module: server:svr01: no server module named csi"))
+		Ω(err.(lsx.MultiError)[1]).Should(MatchError(
+			"error: missing module: service:svc00 refers to server:svr09"))
+		Ω(err.(lsx.MultiError)[2]).Should(MatchError(
+			"error: missing module: service:svc00 depends on server:svr08"))
+	})
+	It("should write the graph as DOT", func() {
+		Ω(config.Set(ctx, "servers.svr01.type", "csi")).Should(Succeed())
+		buf := &bytes.Buffer{}
+		Ω(lsx.NewModuleGraph(ctx, config).WriteDOT(buf)).Should(Succeed())
+		Ω(buf.String()).Should(Equal(`digraph modules {
+	"client:lsx-test-graph-client" [label="client:lsx-test-graph-client\nlsx-test-graph-client"];
+	"server:svr00" [label="server:svr00\nlsx-test-graph"];
+	"server:svr01" [label="server:svr01\ncsi", style=dashed];
+	"volume:lsx-test-graph" [label="volume:lsx-test-graph\nlsx-test-graph"];
+	"service:svc00" [label="service:svc00\nlsx-test-graph"];
+	"server:svr00" -> "service:svc00";
+	"server:svr01" -> "service:svc00";
+	"service:svc00" -> "volume:lsx-test-graph";
+	"service:svc00" -> "client:lsx-test-graph-client";
+}
+`))
+	})
+})
@@ -0,0 +1,353 @@
+package lsx
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Starter is an optional interface implemented by modules that start
+// background work once they are initialized.
+//
+// The context passed to Start carries the runtime's start deadline and
+// is cancelled when Start returns, so background work should not be
+// bound to it. Background work is stopped with Stop; please see Stopper.
+type Starter interface {
+	// Start starts the module's background work.
+	Start(ctx context.Context) error
+}
+
+// Stopper is an optional interface implemented by modules that release
+// resources or stop background work when they are shut down.
+type Stopper interface {
+	// Stop stops the module. The context carries the runtime's stop
+	// deadline.
+	Stop(ctx context.Context) error
+}
+
+// HealthChecker is an optional interface implemented by modules that
+// can report whether they are healthy.
+type HealthChecker interface {
+	// Health returns nil if the module is healthy; otherwise an error
+	// that describes why the module is unhealthy is returned.
+	Health(ctx context.Context) error
+}
+
+// ModuleError is returned when a module fails to complete a step of
+// its lifecycle.
+type ModuleError struct {
+	// Op is the step that failed, ex. init, start, stop, or health.
+	Op string
+
+	// Type is the type of the module.
+	Type string
+
+	// Name is the name of the module.
+	Name string
+
+	// Err is the error returned by the module.
+	Err error
+}
+
+// Error returns the error message.
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("error: %s module failed: %s %s: %v",
+		e.Op, e.Type, e.Name, e.Err)
+}
+
+// Unwrap returns the error returned by the module.
+func (e *ModuleError) Unwrap() error {
+	return e.Err
+}
+
+// Runtime drives modules through their lifecycle:
+//
+//	Init     every module is initialized
+//
+//	Start    modules that implement Starter are started, and servers
+//	         that do not implement Starter are served; please see
+//	         Server
+//
+//	Stop     modules that implement Stopper are stopped, and modules
+//	         that do not implement Stopper but implement io.Closer,
+//	         such as servers, are closed
+//
+// The modules are initialized and started one at a time in the order
+// in which they were added to the runtime, so a module is running
+// before the next module is initialized, and they are stopped in the
+// reverse order. If a module fails to initialize or start, the modules
+// that are already running are stopped and the errors are returned as a
+// MultiError of ModuleError. A module that fails to start is stopped as
+// well, since it may hold resources it acquired when it was initialized.
+//
+// Each step of each module is given at most the step's timeout, if
+// any. A module that does not return from a step by its deadline is
+// abandoned and the step fails with the context's error.
+type Runtime struct {
+	// InitTimeout is how long each module may take to initialize.
+	// Zero means no timeout.
+	InitTimeout time.Duration
+
+	// StartTimeout is how long each module may take to start. Zero
+	// means no timeout.
+	StartTimeout time.Duration
+
+	// StopTimeout is how long each module may take to stop. Zero means
+	// no timeout.
+	StopTimeout time.Duration
+
+	// HealthTimeout is how long each module may take to report its
+	// health. Zero means no timeout.
+	HealthTimeout time.Duration
+
+	mods    []Module
+	scopes  []Config
+	running []*runtimeModule
+	started bool
+	mu      sync.Mutex
+}
+
+// runtimeModule is a module that is running.
+type runtimeModule struct {
+	Module
+
+	// served is closed when the error channel returned by a server's
+	// Serve function is closed. served is nil if the module is not a
+	// server that was served by the runtime.
+	served chan struct{}
+
+	// serveErr is the first error received from the server.
+	serveErr error
+	serveMu  sync.Mutex
+}
+
+// NewRuntime returns a new runtime for the provided modules.
+func NewRuntime(mods ...Module) *Runtime {
+	return &Runtime{mods: mods}
+}
+
+// Modules returns the runtime's modules in the order in which they are
+// started.
+func (r *Runtime) Modules() []Module {
+	return append([]Module{}, r.mods...)
+}
+
+// Start initializes and starts the runtime's modules. An error is
+// returned if the runtime has already been started.
+func (r *Runtime) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return fmt.Errorf("error: runtime already started")
+	}
+	r.started = true
+
+	for i, mod := range r.mods {
+		mctx := ctx
+		if i < len(r.scopes) {
+			mctx = context.WithValue(ctx, ConfigKey, r.scopes[i])
+		}
+		if err := r.startModule(mctx, mod); err != nil {
+			// the modules are stopped even if the start failed because
+			// the context was cancelled
+			errs := MultiError{err}
+			if err, ok := r.stop(detachedContext{ctx}).(MultiError); ok {
+				errs = append(errs, err...)
+			}
+			return errs
+		}
+	}
+	return nil
+}
+
+// startModule initializes and starts a module and adds it to the list
+// of running modules. A module that is initialized is added to the list
+// even if it fails to start, so it is stopped along with the others.
+func (r *Runtime) startModule(ctx context.Context, mod Module) error {
+	if err := callModule(ctx, r.InitTimeout, mod.Init); err != nil {
+		return newModuleError("init", mod, err)
+	}
+	rm, err := r.runModule(ctx, mod)
+	if err != nil {
+		// a server whose Serve function was abandoned may still update
+		// the module it was given, so the module is stopped as a new one
+		rm = &runtimeModule{Module: mod}
+	}
+	r.running = append(r.running, rm)
+	return err
+}
+
+// runModule starts or serves an initialized module.
+func (r *Runtime) runModule(
+	ctx context.Context, mod Module) (*runtimeModule, error) {
+
+	rm := &runtimeModule{Module: mod}
+	switch tmod := mod.(type) {
+	case Starter:
+		if err := callModule(ctx, r.StartTimeout, tmod.Start); err != nil {
+			return nil, newModuleError("start", mod, err)
+		}
+	case Server:
+		// the server's lifetime is not bound to the start deadline
+		serve := func(ctx context.Context) error {
+			errs, err := tmod.Serve(detachedContext{ctx})
+			if err != nil {
+				return err
+			}
+			rm.served = make(chan struct{})
+			go rm.drain(errs)
+			return nil
+		}
+		if err := callModule(ctx, r.StartTimeout, serve); err != nil {
+			return nil, newModuleError("start", mod, err)
+		}
+	}
+	return rm, nil
+}
+
+// drain receives the errors from a server until the server is stopped.
+func (rm *runtimeModule) drain(errs <-chan error) {
+	defer close(rm.served)
+	for err := range errs {
+		rm.serveMu.Lock()
+		if rm.serveErr == nil {
+			rm.serveErr = err
+		}
+		rm.serveMu.Unlock()
+		logf("error: serve failed: %s %s: %v", rm.Type(), rm.Name(), err)
+	}
+}
+
+// Stop stops the running modules in the reverse order in which they
+// were started. Every module is stopped even if another module fails to
+// stop, and the errors are returned as a MultiError of ModuleError.
+func (r *Runtime) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stop(ctx)
+}
+
+func (r *Runtime) stop(ctx context.Context) error {
+	var errs MultiError
+	for i := len(r.running) - 1; i >= 0; i-- {
+		rm := r.running[i]
+		stop := func(ctx context.Context) error {
+			var err error
+			switch tmod := rm.Module.(type) {
+			case Stopper:
+				err = tmod.Stop(ctx)
+			case io.Closer:
+				err = tmod.Close()
+			}
+			if err == nil && rm.served != nil {
+				select {
+				case <-rm.served:
+				case <-ctx.Done():
+					err = ctx.Err()
+				}
+			}
+			return err
+		}
+		if err := callModule(ctx, r.StopTimeout, stop); err != nil {
+			errs = append(errs, newModuleError("stop", rm.Module, err))
+		}
+	}
+	r.running = nil
+	return errs.ErrOrNil()
+}
+
+// Health returns nil if every running module is healthy; otherwise the
+// errors of the unhealthy modules are returned as a MultiError of
+// ModuleError. A server that was served by the runtime and does not
+// implement HealthChecker is unhealthy if it has reported an error or
+// has stopped. An error is also returned if the runtime is not running.
+func (r *Runtime) Health(ctx context.Context) error {
+	r.mu.Lock()
+	running := append([]*runtimeModule{}, r.running...)
+	r.mu.Unlock()
+	if len(running) == 0 && len(r.mods) > 0 {
+		return fmt.Errorf("error: runtime not running")
+	}
+
+	var errs MultiError
+	for _, rm := range running {
+		var err error
+		if hc, ok := rm.Module.(HealthChecker); ok {
+			err = callModule(ctx, r.HealthTimeout, hc.Health)
+		} else if rm.served != nil {
+			err = rm.health()
+		}
+		if err != nil {
+			errs = append(errs, newModuleError("health", rm.Module, err))
+		}
+	}
+	return errs.ErrOrNil()
+}
+
+// health returns the first error received from a server, or an error
+// if the server has stopped.
+func (rm *runtimeModule) health() error {
+	rm.serveMu.Lock()
+	defer rm.serveMu.Unlock()
+	if rm.serveErr != nil {
+		return rm.serveErr
+	}
+	select {
+	case <-rm.served:
+		return fmt.Errorf("error: server stopped")
+	default:
+	}
+	return nil
+}
+
+// Run starts the runtime's modules, blocks until the provided context is
+// cancelled, and then stops the modules. The modules are stopped with a
+// context that is not cancelled along with the provided context, but
+// that is still subject to StopTimeout.
+func (r *Runtime) Run(ctx context.Context) error {
+	if err := r.Start(ctx); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return r.Stop(detachedContext{ctx})
+}
+
+// detachedContext is a context that has the values of its parent but
+// that is never cancelled and has no deadline.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// callModule invokes f with a context that has the provided timeout, if
+// any, and returns the context's error if f does not return before the
+// context is done.
+func callModule(
+	ctx context.Context, timeout time.Duration,
+	f func(ctx context.Context) error) error {
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- f(ctx)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newModuleError(op string, mod Module, err error) error {
+	return &ModuleError{Op: op, Type: mod.Type(), Name: mod.Name(), Err: err}
+}
@@ -0,0 +1,260 @@
+package lsx_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/akutz/lsx"
+)
+
+// lifecycleEvents records the lifecycle steps of test modules.
+type lifecycleEvents struct {
+	sync.Mutex
+	events []string
+}
+
+func (e *lifecycleEvents) add(event string) {
+	e.Lock()
+	defer e.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *lifecycleEvents) list() []string {
+	e.Lock()
+	defer e.Unlock()
+	return append([]string{}, e.events...)
+}
+
+// lifecycleModule is a test module that implements Starter, Stopper,
+// and HealthChecker.
+type lifecycleModule struct {
+	name     string
+	events   *lifecycleEvents
+	initErr  error
+	startErr error
+	stopErr  error
+	health   error
+	block    bool
+}
+
+func (m *lifecycleModule) Name() string { return m.name }
+func (m *lifecycleModule) Type() string { return "volume" }
+
+func (m *lifecycleModule) Init(ctx context.Context) error {
+	m.events.add("init " + m.name)
+	return m.initErr
+}
+
+func (m *lifecycleModule) Start(ctx context.Context) error {
+	m.events.add("start " + m.name)
+	return m.startErr
+}
+
+func (m *lifecycleModule) Stop(ctx context.Context) error {
+	m.events.add("stop " + m.name)
+	if m.block {
+		<-ctx.Done()
+	}
+	return m.stopErr
+}
+
+func (m *lifecycleModule) Health(ctx context.Context) error {
+	return m.health
+}
+
+// initOnlyModule is a test module that only implements Module.
+type initOnlyModule struct {
+	name   string
+	events *lifecycleEvents
+}
+
+func (m *initOnlyModule) Name() string { return m.name }
+func (m *initOnlyModule) Type() string { return "client" }
+
+func (m *initOnlyModule) Init(ctx context.Context) error {
+	m.events.add("init " + m.name)
+	return nil
+}
+
+// resourceModule is a test module that acquires a resource when it is
+// initialized and releases it when it is closed.
+type resourceModule struct {
+	open     bool
+	startErr error
+}
+
+func (m *resourceModule) Name() string { return "resource" }
+func (m *resourceModule) Type() string { return "client" }
+
+func (m *resourceModule) Init(ctx context.Context) error {
+	m.open = true
+	return nil
+}
+
+func (m *resourceModule) Start(ctx context.Context) error {
+	return m.startErr
+}
+
+func (m *resourceModule) Close() error {
+	m.open = false
+	return nil
+}
+
+// lifecycleServer is a test server that does not implement Starter or
+// Stopper.
+type lifecycleServer struct {
+	events *lifecycleEvents
+	errs   chan error
+}
+
+var _ lsx.Server = &lifecycleServer{}
+
+func (s *lifecycleServer) Name() string { return "csi" }
+func (s *lifecycleServer) Type() string { return "server" }
+
+func (s *lifecycleServer) Init(ctx context.Context) error {
+	s.events.add("init csi")
+	return nil
+}
+
+func (s *lifecycleServer) Serve(ctx context.Context) (<-chan error, error) {
+	s.events.add("serve csi")
+	s.errs = make(chan error, 1)
+	return s.errs, nil
+}
+
+func (s *lifecycleServer) Close() error {
+	s.events.add("close csi")
+	close(s.errs)
+	return nil
+}
+
+var _ = Describe("Runtime", func() {
+
+	var (
+		ctx    context.Context
+		events *lifecycleEvents
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		events = &lifecycleEvents{}
+	})
+
+	newModule := func(name string) *lifecycleModule {
+		return &lifecycleModule{name: name, events: events}
+	}
+
+	It("should start in order and stop in reverse order", func() {
+		r := lsx.NewRuntime(
+			newModule("a"), &initOnlyModule{"b", events}, newModule("c"))
+		Ω(r.Start(ctx)).Should(Succeed())
+		Ω(r.Health(ctx)).Should(Succeed())
+		Ω(r.Stop(ctx)).Should(Succeed())
+		Ω(events.list()).Should(Equal([]string{
+			"init a", "start a", "init b", "init c", "start c",
+			"stop c", "stop a",
+		}))
+	})
+	It("should not start twice", func() {
+		r := lsx.NewRuntime(newModule("a"))
+		Ω(r.Start(ctx)).Should(Succeed())
+		Ω(r.Start(ctx)).Should(MatchError("error: runtime already started"))
+	})
+	It("should stop the running modules when a module fails", func() {
+		c := newModule("c")
+		c.startErr = errors.New("boom")
+		r := lsx.NewRuntime(newModule("a"), newModule("b"), c, newModule("d"))
+		err := r.Start(ctx)
+		Ω(err).Should(MatchError(
+			"error: start module failed: volume c: boom"))
+		Ω(events.list()).Should(Equal([]string{
+			"init a", "start a", "init b", "start b", "init c", "start c",
+			"stop c", "stop b", "stop a",
+		}))
+		var merr *lsx.ModuleError
+		Ω(errors.As(err.(lsx.MultiError)[0], &merr)).Should(BeTrue())
+		Ω(merr.Op).Should(Equal("start"))
+		Ω(merr.Name).Should(Equal("c"))
+	})
+	It("should release the resources of a module that fails to start", func() {
+		m := &resourceModule{startErr: errors.New("boom")}
+		err := lsx.NewRuntime(newModule("a"), m).Start(ctx)
+		Ω(err).Should(MatchError(
+			"error: start module failed: client resource: boom"))
+		Ω(m.open).Should(BeFalse())
+		Ω(events.list()).Should(Equal([]string{
+			"init a", "start a", "stop a",
+		}))
+	})
+	It("should aggregate the errors of a failed start", func() {
+		a, b := newModule("a"), newModule("b")
+		a.stopErr = errors.New("stuck")
+		b.initErr = errors.New("bad config")
+		err := lsx.NewRuntime(a, b).Start(ctx)
+		Ω(err).Should(HaveLen(2))
+		Ω(err.(lsx.MultiError)[0]).Should(MatchError(
+			"error: init module failed: volume b: bad config"))
+		Ω(err.(lsx.MultiError)[1]).Should(MatchError(
+			"error: stop module failed: volume a: stuck"))
+	})
+	It("should stop every module even if one fails", func() {
+		a, b := newModule("a"), newModule("b")
+		b.stopErr = errors.New("stuck")
+		r := lsx.NewRuntime(a, b)
+		Ω(r.Start(ctx)).Should(Succeed())
+		Ω(r.Stop(ctx)).Should(MatchError(
+			"error: stop module failed: volume b: stuck"))
+		Ω(events.list()).Should(ContainElement("stop a"))
+	})
+	It("should abandon a module that misses its deadline", func() {
+		a, b := newModule("a"), newModule("b")
+		b.block = true
+		r := lsx.NewRuntime(a, b)
+		r.StopTimeout = 50 * time.Millisecond
+		Ω(r.Start(ctx)).Should(Succeed())
+		err := r.Stop(ctx)
+		Ω(errors.Is(err.(lsx.MultiError)[0], context.DeadlineExceeded)).Should(
+			BeTrue())
+		Ω(events.list()).Should(ContainElement("stop a"))
+	})
+	It("should report unhealthy modules", func() {
+		a, b := newModule("a"), newModule("b")
+		b.health = errors.New("degraded")
+		r := lsx.NewRuntime(a, b)
+		Ω(r.Health(ctx)).Should(MatchError("error: runtime not running"))
+		Ω(r.Start(ctx)).Should(Succeed())
+		Ω(r.Health(ctx)).Should(MatchError(
+			"error: health module failed: volume b: degraded"))
+	})
+	It("should serve and close servers", func() {
+		srv := &lifecycleServer{events: events}
+		r := lsx.NewRuntime(newModule("a"), srv)
+		Ω(r.Start(ctx)).Should(Succeed())
+		Ω(r.Health(ctx)).Should(Succeed())
+		srv.errs <- errors.New("listener failed")
+		Eventually(func() error {
+			return r.Health(ctx)
+		}).Should(MatchError(
+			"error: health module failed: server csi: listener failed"))
+		Ω(r.Stop(ctx)).Should(Succeed())
+		Ω(events.list()).Should(Equal([]string{
+			"init a", "start a", "init csi", "serve csi",
+			"close csi", "stop a",
+		}))
+	})
+	It("should stop the modules when the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		r := lsx.NewRuntime(newModule("a"))
+		done := make(chan error, 1)
+		go func() {
+			done <- r.Run(ctx)
+		}()
+		Eventually(events.list).Should(ContainElement("start a"))
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		Ω(events.list()).Should(Equal([]string{"init a", "start a", "stop a"}))
+	})
+})
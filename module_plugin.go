@@ -0,0 +1,240 @@
+package lsx
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"strings"
+	"sync"
+)
+
+// pluginLoadMu serializes the opening of plug-ins by all loaders.
+var pluginLoadMu sync.Mutex
+
+// Modules returns the modules registered with DefaultRegistry; please
+// see Registry.List.
+func Modules() []ModuleInfo {
+	return DefaultRegistry.List()
+}
+
+// PluginLoader loads Go plug-ins that register modules.
+//
+// A plug-in registers its modules with RegisterModule from one of its
+// init functions, which are invoked when the plug-in is opened. The
+// modules registered while a plug-in is opened are registered with the
+// loader's registry and are attributed to the plug-in; please see
+// Registry.List.
+//
+// A plug-in should use RegisterModule rather than MustRegisterModule so
+// that a module that conflicts with a registered module is reported as
+// an error by the loader instead of a panic; please see
+// Registry.Override for choosing which of the modules wins.
+//
+// Loading is idempotent: a plug-in that was already loaded by the
+// loader is not opened again, but the names it is expected to register
+// are still verified. Since Go does not run the init functions of a
+// plug-in that is already open, a plug-in whose modules failed to
+// register fails again with the same error.
+type PluginLoader struct {
+	// Open opens the plug-in at the provided path. If Open is nil then
+	// the plug-in is opened with plugin.Open.
+	Open func(path string) error
+
+	// Registry is the registry with which the plug-ins' modules are
+	// registered. If Registry is nil then DefaultRegistry is used.
+	Registry *Registry
+
+	mu     sync.Mutex
+	loaded map[string]*loadedPlugin
+}
+
+// loadedPlugin is a plug-in that was opened by a loader.
+type loadedPlugin struct {
+	*pluginRegistrations
+
+	// err is the error of the registrations that failed, if any.
+	err error
+}
+
+// defaultPluginLoader is the loader used by LoadPlugins.
+var defaultPluginLoader = &PluginLoader{}
+
+// LoadPlugins loads the plug-ins listed in the config's "modules" array
+// with the default plug-in loader; please see PluginLoader.Load.
+func LoadPlugins(ctx context.Context, config Config) error {
+	return defaultPluginLoader.Load(ctx, config)
+}
+
+// Load loads the plug-ins listed in the config's "modules" array, ex.
+//
+//	"modules": [
+//	    {
+//	        "path": "/tmp/lsx/lib/mods/mock-server.so",
+//	        "names": ["csi", "libstorage"]
+//	    }
+//	],
+//	"moduleOverrides": {
+//	    "libstorage": "/tmp/lsx/lib/mods/mock-server.so"
+//	}
+//
+// in the order they are listed. Every plug-in is loaded even if another
+// plug-in fails to load, and the errors are returned as a MultiError.
+//
+// The "moduleOverrides" object selects, by module name, the plug-in
+// path or package import path whose module wins when more than one
+// registers the same module; please see Registry.Override. The
+// overrides are set with the loader's registry before the plug-ins are
+// loaded, and plug-in paths, which end with .so, are resolved the same
+// way as the paths of the plug-ins.
+func (l *PluginLoader) Load(ctx context.Context, config Config) error {
+	var errs MultiError
+
+	overrides, _ := toStringMap(config.Get(ctx, "moduleOverrides"))
+	for _, name := range sortedKeys(overrides) {
+		source, ok := overrides[name].(string)
+		if !ok {
+			errs = append(errs, fmt.Errorf(
+				"error: invalid module override: %s: expected string", name))
+			continue
+		}
+		if strings.HasSuffix(source, ".so") {
+			if abs, err := filepath.Abs(source); err == nil {
+				source = abs
+			}
+		}
+		l.registry().Override(name, source)
+	}
+
+	els, _ := config.Get(ctx, "modules").([]interface{})
+	for i := range els {
+		scope := config.Scope(ctx, fmt.Sprintf("modules[%d]", i))
+		if scope == nil {
+			errs = append(errs, fmt.Errorf(
+				"error: invalid module: modules[%d]: expected object", i))
+			continue
+		}
+		path := scope.GetStr(ctx, "path")
+		if path == "" {
+			errs = append(errs, fmt.Errorf(
+				"error: invalid module: modules[%d]: missing path", i))
+			continue
+		}
+		names := scope.GetStringSlice(ctx, "names")
+		if _, err := l.LoadPlugin(path, names...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.ErrOrNil()
+}
+
+// LoadPlugin loads the plug-in at the provided path and returns the
+// modules it registered. An error is returned if the plug-in cannot be
+// opened, or if it did not register a module with each of the provided
+// names, including a module that was discarded because an override made
+// another plug-in's or package's module win.
+func (l *PluginLoader) LoadPlugin(
+	path string, names ...string) ([]ModuleInfo, error) {
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("error: load module failed: %s: %v", path, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	loaded, ok := l.loaded[abs]
+	if !ok {
+		if loaded, err = l.open(abs); err != nil {
+			return nil, err
+		}
+		if l.loaded == nil {
+			l.loaded = map[string]*loadedPlugin{}
+		}
+		l.loaded[abs] = loaded
+	}
+	if loaded.err != nil {
+		return nil, loaded.err
+	}
+	infos := loaded.infos
+
+	var (
+		errs       MultiError
+		registered []string
+	)
+	for _, info := range infos {
+		registered = append(registered,
+			fmt.Sprintf("%s:%s", info.Type, info.Name))
+	}
+	for _, name := range names {
+		found := false
+		for _, info := range infos {
+			if strings.EqualFold(info.Name, name) {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		if winner, ok := loaded.overridden[strings.ToLower(name)]; ok {
+			errs = append(errs, fmt.Errorf(
+				"error: load module failed: %s: module overridden: %s; "+
+					"registered by %s", abs, name, winner))
+		} else {
+			errs = append(errs, fmt.Errorf(
+				"error: load module failed: %s: module not registered: %s; "+
+					"registered: [%s]",
+				abs, name, strings.Join(registered, ", ")))
+		}
+	}
+	if err := errs.ErrOrNil(); err != nil {
+		return nil, err
+	}
+	return append([]ModuleInfo{}, infos...), nil
+}
+
+// registry returns the loader's registry.
+func (l *PluginLoader) registry() *Registry {
+	if l.Registry != nil {
+		return l.Registry
+	}
+	return DefaultRegistry
+}
+
+// open opens the plug-in and returns the registrations it made. An
+// error is returned only if the plug-in could not be opened.
+func (l *PluginLoader) open(path string) (*loadedPlugin, error) {
+	// plug-ins are opened one at a time so that the modules registered
+	// while a plug-in is opened are attributed to it
+	pluginLoadMu.Lock()
+	defer pluginLoadMu.Unlock()
+
+	open := l.Open
+	if open == nil {
+		open = func(path string) error {
+			_, err := plugin.Open(path)
+			return err
+		}
+	}
+	var loaded *pluginRegistrations
+	reg := l.registry()
+	reg.beginPlugin(path)
+	pluginRegistry.Store(reg)
+	err := func() error {
+		defer func() {
+			pluginRegistry.Store((*Registry)(nil))
+			loaded = reg.endPlugin()
+		}()
+		return open(path)
+	}()
+	if err != nil {
+		return nil, fmt.Errorf("error: load module failed: %s: %v", path, err)
+	}
+	var errs MultiError
+	for _, err := range loaded.errs {
+		errs = append(errs, fmt.Errorf("error: load module failed: %s: %s",
+			path, strings.TrimPrefix(err.Error(), "error: ")))
+	}
+	return &loadedPlugin{pluginRegistrations: loaded, err: errs.ErrOrNil()}, nil
+}
@@ -0,0 +1,160 @@
+package lsx_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+
+	"github.com/akutz/lsx"
+)
+
+var _ = Describe("PluginLoader", func() {
+
+	var (
+		ctx    context.Context
+		opened []string
+		reg    *lsx.Registry
+		loader *lsx.PluginLoader
+	)
+
+	// plugins are the modules registered by the fake plug-ins, keyed by
+	// the plug-ins' base names
+	plugins := map[string][]string{
+		"lsx-test-server.so": {"lsx-test-plugin-csi", "lsx-test-plugin-nfs"},
+		"lsx-test-empty.so":  nil,
+		"lsx-test-dup-a.so":  {"lsx-test-plugin-dup"},
+		"lsx-test-dup-b.so":  {"lsx-test-plugin-dup"},
+		"lsx-test-dup-c.so":  {"lsx-test-plugin-dup"},
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		opened = nil
+		reg = &lsx.Registry{}
+		loader = &lsx.PluginLoader{
+			Registry: reg,
+			Open: func(path string) error {
+				opened = append(opened, path)
+				names, ok := plugins[filepath.Base(path)]
+				if !ok {
+					return errors.New("no such plug-in")
+				}
+				for _, name := range names {
+					lsx.RegisterModule(lsx.ServerModuleType, name,
+						func() lsx.Module { return nil })
+				}
+				return nil
+			},
+		}
+	})
+
+	It("should attribute the registered modules to the plug-in", func() {
+		infos, err := loader.LoadPlugin(
+			"/lsx/lsx-test-server.so", "lsx-test-plugin-csi")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(infos).Should(Equal([]lsx.ModuleInfo{
+			{
+				Type:    lsx.ServerModuleType,
+				Name:    "lsx-test-plugin-csi",
+				Package: "github.com/akutz/lsx_test",
+				Plugin:  "/lsx/lsx-test-server.so",
+			},
+			{
+				Type:    lsx.ServerModuleType,
+				Name:    "lsx-test-plugin-nfs",
+				Package: "github.com/akutz/lsx_test",
+				Plugin:  "/lsx/lsx-test-server.so",
+			},
+		}))
+		Ω(reg.List()).Should(Equal(infos))
+		Ω(lsx.Modules()).ShouldNot(ContainElement(infos[0]))
+		_, err = loader.LoadPlugin(
+			"/lsx/lsx-test-server.so", "LSX-TEST-PLUGIN-NFS")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+	It("should not open a plug-in twice", func() {
+		_, err := loader.LoadPlugin("/lsx/lsx-test-server.so")
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = loader.LoadPlugin(
+			"/lsx/../lsx/lsx-test-server.so", "lsx-test-plugin-nfs")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(opened).Should(Equal([]string{"/lsx/lsx-test-server.so"}))
+	})
+	It("should verify the registered names", func() {
+		_, err := loader.LoadPlugin("/lsx/lsx-test-empty.so", "vfs")
+		Ω(err).Should(MatchError(
+			"error: load module failed: /lsx/lsx-test-empty.so: " +
+				"module not registered: vfs; registered: []"))
+		_, err = loader.LoadPlugin(
+			"/lsx/lsx-test-server.so", "lsx-test-plugin-csi", "csi")
+		Ω(err).Should(MatchError(
+			"error: load module failed: /lsx/lsx-test-server.so: " +
+				"module not registered: csi; registered: " +
+				"[server:lsx-test-plugin-csi, server:lsx-test-plugin-nfs]"))
+	})
+	It("should load the plug-ins listed in the config", func() {
+		config := lsx.Config{
+			"modules": []interface{}{
+				map[string]interface{}{
+					"path":  "/lsx/lsx-test-server.so",
+					"names": []interface{}{"lsx-test-plugin-nfs"},
+				},
+				map[string]interface{}{"path": "/lsx/lsx-test-missing.so"},
+				map[string]interface{}{"names": []interface{}{"vfs"}},
+			},
+		}
+		err := loader.Load(ctx, config)
+		Ω(err).Should(HaveLen(2))
+		Ω(err.(lsx.MultiError)[0]).Should(MatchError(
+			"error: load module failed: /lsx/lsx-test-missing.so: " +
+				"no such plug-in"))
+		Ω(err.(lsx.MultiError)[1]).Should(MatchError(
+			"error: invalid module: modules[2]: missing path"))
+		Ω(opened).Should(Equal([]string{
+			"/lsx/lsx-test-server.so", "/lsx/lsx-test-missing.so",
+		}))
+	})
+	It("should reject duplicate modules", func() {
+		_, err := loader.LoadPlugin("/lsx/lsx-test-dup-a.so")
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = loader.LoadPlugin("/lsx/lsx-test-dup-b.so")
+		Ω(err).Should(MatchError(
+			"error: load module failed: /lsx/lsx-test-dup-b.so: " +
+				"duplicate module: server lsx-test-plugin-dup: " +
+				"registered by /lsx/lsx-test-dup-a.so"))
+		_, err2 := loader.LoadPlugin("/lsx/lsx-test-dup-b.so")
+		Ω(err2).Should(Equal(err))
+		Ω(opened).Should(Equal([]string{
+			"/lsx/lsx-test-dup-a.so", "/lsx/lsx-test-dup-b.so",
+		}))
+	})
+	It("should let the override win", func() {
+		config := lsx.Config{
+			"modules": []interface{}{
+				map[string]interface{}{"path": "/lsx/lsx-test-dup-a.so"},
+				map[string]interface{}{"path": "/lsx/lsx-test-dup-b.so"},
+				map[string]interface{}{
+					"path":  "/lsx/lsx-test-dup-c.so",
+					"names": []interface{}{"lsx-test-plugin-dup"},
+				},
+			},
+			"moduleOverrides": map[string]interface{}{
+				"lsx-test-plugin-dup": "/lsx/lsx-test-dup-b.so",
+			},
+		}
+		err := loader.Load(ctx, config)
+		Ω(err).Should(HaveLen(1))
+		Ω(err.(lsx.MultiError)[0]).Should(MatchError(
+			"error: load module failed: /lsx/lsx-test-dup-c.so: " +
+				"module overridden: lsx-test-plugin-dup; " +
+				"registered by /lsx/lsx-test-dup-b.so"))
+		infos, err := loader.LoadPlugin("/lsx/lsx-test-dup-c.so")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(infos).Should(BeEmpty())
+		info, ok := reg.Lookup(
+			lsx.ServerModuleType, "lsx-test-plugin-dup")
+		Ω(ok).Should(BeTrue())
+		Ω(info.Plugin).Should(Equal("/lsx/lsx-test-dup-b.so"))
+		Ω(info.Package).Should(Equal("github.com/akutz/lsx_test"))
+	})
+})
@@ -10,7 +10,7 @@ import (
 
 const (
 	// maxModuleType is the maximum module type constant.
-	maxModuleType = lsx.VolumeModuleType
+	maxModuleType = lsx.ServiceModuleType
 )
 
 func TestModule(t *testing.T) {
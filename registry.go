@@ -0,0 +1,509 @@
+package lsx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ModuleInfo describes a registered module.
+type ModuleInfo struct {
+	// Type is the type of the module.
+	Type ModuleType `json:"type"`
+
+	// Name is the name of the module.
+	Name string `json:"name"`
+
+	// Package is the import path of the package that registered the
+	// module.
+	Package string `json:"package,omitempty"`
+
+	// Plugin is the path of the plug-in that registered the module, or
+	// empty if the module was not registered by a plug-in.
+	Plugin string `json:"plugin,omitempty"`
+}
+
+// Registry is a set of registered modules and servers. The zero value
+// is an empty registry ready to use, and a registry is safe for
+// concurrent use.
+//
+// A module's type and name may be registered only once, unless an
+// override selects which of the registrations wins; please see
+// Override. Names are compared case-insensitively, the same way the
+// "type" of a module's scope is matched by configs.
+//
+// The package-level functions RegisterModule, MustRegisterModule,
+// NewModule, Modules, ModuleConfigs, RegisterServer, and Servers use
+// DefaultRegistry, except that RegisterModule and MustRegisterModule
+// use the registry of the PluginLoader that is loading a plug-in.
+// Configs, module graphs, and NewConfigProviders use the registry
+// stored in the context with WithRegistry, and DefaultRegistry
+// otherwise.
+type Registry struct {
+	rwl sync.RWMutex
+
+	// mods are the registered modules, keyed by the modules' types and
+	// names.
+	mods map[ModuleType]map[string]*registryEntry
+
+	// configs are the compiled config keys of the registered modules,
+	// keyed by the modules' types and lower-case names.
+	configs map[ModuleType]map[string]*moduleConfig
+
+	// servers are the registered server constructors, keyed by the
+	// servers' names.
+	servers map[string]serverCtor
+
+	// overrides are the sources of the registrations that win, keyed by
+	// the modules' lower-case names.
+	overrides map[string]string
+
+	// loading records the registrations made while a plug-in is loaded.
+	loading *pluginRegistrations
+}
+
+// registryEntry is a registered module.
+type registryEntry struct {
+	ctor   func() Module
+	pkg    string
+	plugin string
+}
+
+// source returns the plug-in that registered the module, or the
+// package if the module was not registered by a plug-in.
+func (e *registryEntry) source() string {
+	if e.plugin != "" {
+		return e.plugin
+	}
+	return e.pkg
+}
+
+// from returns a flag indicating whether the module was registered by
+// the source, a plug-in path or a package import path.
+func (e *registryEntry) from(source string) bool {
+	return source != "" && (source == e.plugin || source == e.pkg)
+}
+
+// pluginRegistrations are the registrations made while a plug-in is
+// loaded.
+type pluginRegistrations struct {
+	path string
+
+	// infos are the modules the plug-in registered.
+	infos []ModuleInfo
+
+	// overridden are the sources of the modules that won over the
+	// modules the plug-in registered, keyed by the modules' lower-case
+	// names.
+	overridden map[string]string
+
+	// errs are the errors of the registrations that failed.
+	errs MultiError
+}
+
+// DefaultRegistry is the registry used by the package-level functions.
+var DefaultRegistry = &Registry{}
+
+// pluginRegistry is the registry of the plug-in that is being loaded,
+// or nil if no plug-in is being loaded. The value is a *Registry.
+var pluginRegistry atomic.Value
+
+// registrationRegistry returns the registry with which RegisterModule
+// and MustRegisterModule register modules.
+func registrationRegistry() *Registry {
+	if r, _ := pluginRegistry.Load().(*Registry); r != nil {
+		return r
+	}
+	return DefaultRegistry
+}
+
+// WithRegistry returns a context that causes configs and module graphs
+// to use the provided registry instead of DefaultRegistry.
+func WithRegistry(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, RegistryKey, r)
+}
+
+// ContextRegistry returns the registry stored in the context with
+// RegistryKey or DefaultRegistry if there is no such registry.
+func ContextRegistry(ctx context.Context) *Registry {
+	if ctx != nil {
+		if r, ok := ctx.Value(RegistryKey).(*Registry); ok && r != nil {
+			return r
+		}
+	}
+	return DefaultRegistry
+}
+
+// Register registers a new module.
+//
+// An error is returned if a module with the same type and name is
+// already registered, unless an override selects one of the two
+// registrations; please see Override. The module is attributed to the
+// package that invokes Register, RegisterModule, or their Must
+// variants, and to the plug-in that is being loaded, if any; please see
+// PluginLoader.
+//
+// The module may declare the config keys it reads. The default values
+// of the keys are the lowest layer of the lookups of paths inside the
+// module's scope, such as servers.svr01 for a server module named csi
+// when servers.svr01 has "type": "csi", and a value at a key's
+// deprecated path is used in place of the key's default value. The
+// declared keys are listed by Configs. The keys are consulted by the
+// configs whose contexts store the registry; please see WithRegistry.
+//
+// An error is also returned if a key's path or deprecated path is
+// invalid or if a key's default value is not of the key's type.
+func (r *Registry) Register(
+	modType ModuleType, modName string, modCtor func() Module,
+	keys ...ModuleConfigKey) error {
+
+	e := &registryEntry{ctor: modCtor, pkg: callerPackage()}
+
+	r.rwl.Lock()
+	defer r.rwl.Unlock()
+	if r.loading != nil {
+		e.plugin = r.loading.path
+	}
+	winner, err := r.register(modType, modName, e, keys)
+	if l := r.loading; l != nil {
+		switch {
+		case err != nil:
+			l.errs = append(l.errs, err)
+		case winner != nil:
+			if l.overridden == nil {
+				l.overridden = map[string]string{}
+			}
+			l.overridden[strings.ToLower(modName)] = winner.source()
+		default:
+			l.infos = append(l.infos, e.info(modType, modName))
+		}
+	}
+	return err
+}
+
+// MustRegister is like Register but panics if the module cannot be
+// registered.
+func (r *Registry) MustRegister(
+	modType ModuleType, modName string, modCtor func() Module,
+	keys ...ModuleConfigKey) {
+
+	if err := r.Register(modType, modName, modCtor, keys...); err != nil {
+		panic(err)
+	}
+}
+
+// register registers the entry unless it conflicts with a registered
+// module. If an override makes the registered module win then the
+// entry is discarded and the registered module is returned. The
+// registry's lock must be held.
+func (r *Registry) register(
+	modType ModuleType, modName string, e *registryEntry,
+	keys []ModuleConfigKey) (*registryEntry, error) {
+
+	oldName, old, ok := r.lookupFold(modType, modName)
+	if ok {
+		winner, ok := r.overrides[strings.ToLower(modName)]
+		switch {
+		case ok && e.from(winner):
+			// the new registration wins
+		case ok && old.from(winner):
+			return old, nil
+		default:
+			return nil, fmt.Errorf(
+				"error: duplicate module: %s %s: registered by %s",
+				modType, oldName, old.source())
+		}
+	}
+
+	var mc *moduleConfig
+	if len(keys) > 0 {
+		var err error
+		if mc, err = newModuleConfig(modType, modName, keys); err != nil {
+			return nil, err
+		}
+	}
+	if ok {
+		delete(r.mods[modType], oldName)
+	}
+
+	if r.mods == nil {
+		r.mods = map[ModuleType]map[string]*registryEntry{}
+		r.configs = map[ModuleType]map[string]*moduleConfig{}
+	}
+	byName, ok := r.mods[modType]
+	if !ok {
+		byName = map[string]*registryEntry{}
+		r.mods[modType] = byName
+	}
+	byName[modName] = e
+
+	configs, ok := r.configs[modType]
+	if !ok {
+		configs = map[string]*moduleConfig{}
+		r.configs[modType] = configs
+	}
+	if mc != nil {
+		configs[strings.ToLower(modName)] = mc
+	} else {
+		delete(configs, strings.ToLower(modName))
+	}
+	return nil, nil
+}
+
+// lookupFold returns the registered module whose name matches the
+// provided name case-insensitively, along with the module's name. The
+// registry's lock must be held.
+func (r *Registry) lookupFold(
+	modType ModuleType, modName string) (string, *registryEntry, bool) {
+
+	byName := r.mods[modType]
+	if e, ok := byName[modName]; ok {
+		return modName, e, true
+	}
+	for name, e := range byName {
+		if strings.EqualFold(name, modName) {
+			return name, e, true
+		}
+	}
+	return "", nil, false
+}
+
+// Override selects the registration that wins when modules of the same
+// type and name are registered by different sources. The module named
+// modName that is registered by source, a plug-in path or a package
+// import path, replaces a module with the same type and name that is
+// already registered, and a module with the same type and name that is
+// registered by another source afterwards is discarded without an
+// error. A discarded module is not attributed to the plug-in that
+// registered it; please see PluginLoader.LoadPlugin. An empty source
+// removes the override.
+//
+// An override does not affect the modules already registered, so it
+// should be set before the competing modules are registered, ex. before
+// loading plug-ins.
+func (r *Registry) Override(modName, source string) {
+	r.rwl.Lock()
+	defer r.rwl.Unlock()
+	if source == "" {
+		delete(r.overrides, strings.ToLower(modName))
+		return
+	}
+	if r.overrides == nil {
+		r.overrides = map[string]string{}
+	}
+	r.overrides[strings.ToLower(modName)] = source
+}
+
+// Unregister removes a registered module and its config keys. The
+// returned flag indicates whether the module was registered.
+func (r *Registry) Unregister(modType ModuleType, modName string) bool {
+	r.rwl.Lock()
+	defer r.rwl.Unlock()
+	name, _, ok := r.lookupFold(modType, modName)
+	if !ok {
+		return false
+	}
+	delete(r.mods[modType], name)
+	delete(r.configs[modType], strings.ToLower(modName))
+	return true
+}
+
+// New returns a new instance of a registered module, or nil if no
+// module is registered with the provided type and name.
+//
+// The module's constructor is invoked without holding the registry's
+// lock, so a constructor may use the registry.
+func (r *Registry) New(modType ModuleType, modName string) Module {
+	r.rwl.RLock()
+	_, e, ok := r.lookupFold(modType, modName)
+	r.rwl.RUnlock()
+	if !ok {
+		return nil
+	}
+	return e.ctor()
+}
+
+// Lookup returns the description of a registered module. The returned
+// flag is false if no module is registered with the provided type and
+// name.
+func (r *Registry) Lookup(
+	modType ModuleType, modName string) (ModuleInfo, bool) {
+
+	r.rwl.RLock()
+	defer r.rwl.RUnlock()
+	name, e, ok := r.lookupFold(modType, modName)
+	if !ok {
+		return ModuleInfo{}, false
+	}
+	return e.info(modType, name), true
+}
+
+// List returns the registered modules sorted by type and name.
+func (r *Registry) List() []ModuleInfo {
+	r.rwl.RLock()
+	defer r.rwl.RUnlock()
+	var infos []ModuleInfo
+	for modType, byName := range r.mods {
+		for modName, e := range byName {
+			infos = append(infos, e.info(modType, modName))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Type != infos[j].Type {
+			return infos[i].Type < infos[j].Type
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Configs returns the config keys declared by the registered modules,
+// sorted by the modules' types and names. Modules that do not declare
+// any config keys are omitted.
+func (r *Registry) Configs() []ModuleConfig {
+	r.rwl.RLock()
+	defer r.rwl.RUnlock()
+	var configs []ModuleConfig
+	for _, byName := range r.configs {
+		for _, mc := range byName {
+			configs = append(configs, mc.ModuleConfig)
+		}
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		if configs[i].Type != configs[j].Type {
+			return configs[i].Type < configs[j].Type
+		}
+		return configs[i].Name < configs[j].Name
+	})
+	return configs
+}
+
+// config returns the compiled config keys of the module with the
+// provided type and case-insensitive name, or nil if the module does
+// not declare any config keys.
+func (r *Registry) config(modType ModuleType, modName string) *moduleConfig {
+	r.rwl.RLock()
+	defer r.rwl.RUnlock()
+	return r.configs[modType][strings.ToLower(modName)]
+}
+
+// hasConfigs returns a flag indicating whether any module of the
+// provided type declares config keys.
+func (r *Registry) hasConfigs(modType ModuleType) bool {
+	r.rwl.RLock()
+	defer r.rwl.RUnlock()
+	return len(r.configs[modType]) > 0
+}
+
+// RegisterServer registers the name of a new server type and the
+// function used to create a new server object.
+func (r *Registry) RegisterServer(name string, ctor serverCtor) {
+	r.rwl.Lock()
+	defer r.rwl.Unlock()
+	if r.servers == nil {
+		r.servers = map[string]serverCtor{}
+	}
+	r.servers[name] = ctor
+}
+
+// Servers returns a channel on which constructed server objects for all
+// registered servers are returned. The channel is closed once every
+// server has been returned.
+func (r *Registry) Servers() <-chan Server {
+	r.rwl.RLock()
+	ctors := make([]serverCtor, 0, len(r.servers))
+	for _, ctor := range r.servers {
+		ctors = append(ctors, ctor)
+	}
+	r.rwl.RUnlock()
+	c := make(chan Server)
+	go func() {
+		defer close(c)
+		for _, ctor := range ctors {
+			c <- ctor()
+		}
+	}()
+	return c
+}
+
+// beginPlugin attributes the modules registered from now on to the
+// plug-in at the provided path.
+func (r *Registry) beginPlugin(path string) {
+	r.rwl.Lock()
+	defer r.rwl.Unlock()
+	r.loading = &pluginRegistrations{path: path}
+}
+
+// endPlugin stops attributing registrations to the plug-in and returns
+// the registrations it made, with the modules it registered sorted by
+// type and name.
+func (r *Registry) endPlugin() *pluginRegistrations {
+	r.rwl.Lock()
+	defer r.rwl.Unlock()
+	loading := r.loading
+	r.loading = nil
+	sort.Slice(loading.infos, func(i, j int) bool {
+		a, b := loading.infos[i], loading.infos[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+	return loading
+}
+
+// info returns the description of the registered module.
+func (e *registryEntry) info(modType ModuleType, modName string) ModuleInfo {
+	return ModuleInfo{
+		Type:    modType,
+		Name:    modName,
+		Package: e.pkg,
+		Plugin:  e.plugin,
+	}
+}
+
+// registryPkg is the import path of this package.
+var registryPkg = reflect.TypeOf(Registry{}).PkgPath()
+
+// registerFuncs are the functions of this package through which modules
+// are registered.
+var registerFuncs = map[string]bool{
+	"(*Registry).Register":     true,
+	"(*Registry).MustRegister": true,
+	"RegisterModule":           true,
+	"MustRegisterModule":       true,
+}
+
+// callerPackage returns the import path of the package that invoked
+// one of the functions that register modules.
+func callerPackage() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		f, more := frames.Next()
+		pkg := funcPackage(f.Function)
+		if pkg != registryPkg ||
+			!registerFuncs[strings.TrimPrefix(f.Function, pkg+".")] {
+			return pkg
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// funcPackage returns the import path of the package of the function
+// with the provided fully-qualified name, ex. github.com/akutz/lsx for
+// github.com/akutz/lsx.RegisterModule.
+func funcPackage(name string) string {
+	i := strings.LastIndex(name, "/") + 1
+	if j := strings.Index(name[i:], "."); j >= 0 {
+		return name[:i+j]
+	}
+	return name
+}
@@ -0,0 +1,242 @@
+package lsx_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/akutz/lsx"
+)
+
+// registryModule is a test module constructed by a Registry.
+type registryModule struct {
+	name string
+}
+
+func (m *registryModule) Name() string                   { return m.name }
+func (m *registryModule) Type() string                   { return "volume" }
+func (m *registryModule) Init(ctx context.Context) error { return nil }
+
+var _ = Describe("Registry", func() {
+
+	var r *lsx.Registry
+
+	BeforeEach(func() {
+		r = &lsx.Registry{}
+	})
+
+	ctor := func(name string) func() lsx.Module {
+		return func() lsx.Module { return &registryModule{name} }
+	}
+
+	It("should register and construct modules", func() {
+		r.Register(lsx.VolumeModuleType, "vfs", ctor("vfs"))
+		Ω(r.New(lsx.VolumeModuleType, "vfs")).Should(
+			Equal(&registryModule{"vfs"}))
+		Ω(r.New(lsx.VolumeModuleType, "ebs")).Should(BeNil())
+		Ω(r.New(lsx.ClientModuleType, "vfs")).Should(BeNil())
+		info, ok := r.Lookup(lsx.VolumeModuleType, "vfs")
+		Ω(ok).Should(BeTrue())
+		Ω(info).Should(Equal(lsx.ModuleInfo{
+			Type:    lsx.VolumeModuleType,
+			Name:    "vfs",
+			Package: "github.com/akutz/lsx_test",
+		}))
+	})
+	It("should be isolated from other registries", func() {
+		r.Register(lsx.VolumeModuleType, "lsx-test-registry", ctor("a"))
+		Ω(lsx.NewModule(lsx.VolumeModuleType, "lsx-test-registry")).Should(
+			BeNil())
+		Ω((&lsx.Registry{}).List()).Should(BeEmpty())
+	})
+	It("should list the modules", func() {
+		r.Register(lsx.VolumeModuleType, "vfs", ctor("vfs"))
+		r.Register(lsx.ClientModuleType, "vfs", ctor("vfs"))
+		r.Register(lsx.VolumeModuleType, "ebs", ctor("ebs"),
+			lsx.ModuleConfigKey{Path: "region", Default: "us-east-1"})
+		var refs []string
+		for _, info := range r.List() {
+			refs = append(refs, info.Type.String()+":"+info.Name)
+		}
+		Ω(refs).Should(Equal([]string{"client:vfs", "volume:ebs", "volume:vfs"}))
+		Ω(r.Configs()).Should(HaveLen(1))
+	})
+	It("should reject duplicate modules", func() {
+		Ω(r.Register(lsx.VolumeModuleType, "vfs", ctor("a"))).Should(Succeed())
+		Ω(r.Register(lsx.VolumeModuleType, "vfs", ctor("b"))).Should(MatchError(
+			"error: duplicate module: volume vfs: " +
+				"registered by github.com/akutz/lsx_test"))
+		Ω(func() {
+			r.MustRegister(lsx.VolumeModuleType, "vfs", ctor("b"))
+		}).Should(Panic())
+		Ω(r.New(lsx.VolumeModuleType, "vfs")).Should(
+			Equal(&registryModule{"a"}))
+		Ω(r.Register(lsx.ClientModuleType, "vfs", ctor("c"))).Should(Succeed())
+	})
+	It("should reject duplicate modules case-insensitively", func() {
+		Ω(r.Register(lsx.VolumeModuleType, "vfs", ctor("a"),
+			lsx.ModuleConfigKey{Path: "root", Default: "/var/lib/vfs"},
+		)).Should(Succeed())
+		Ω(r.Register(lsx.VolumeModuleType, "VFS", ctor("b"))).Should(
+			MatchError("error: duplicate module: volume vfs: " +
+				"registered by github.com/akutz/lsx_test"))
+		Ω(r.Configs()).Should(HaveLen(1))
+
+		r.Override("VFS", "github.com/akutz/lsx_test")
+		Ω(r.Register(lsx.VolumeModuleType, "VFS", ctor("b"))).Should(Succeed())
+		var names []string
+		for _, info := range r.List() {
+			names = append(names, info.Name)
+		}
+		Ω(names).Should(Equal([]string{"VFS"}))
+		Ω(r.Configs()).Should(BeEmpty())
+	})
+	It("should look up modules case-insensitively", func() {
+		Ω(r.Register(lsx.VolumeModuleType, "VFS", ctor("a"))).Should(Succeed())
+		Ω(r.New(lsx.VolumeModuleType, "vfs")).Should(
+			Equal(&registryModule{"a"}))
+		info, ok := r.Lookup(lsx.VolumeModuleType, "Vfs")
+		Ω(ok).Should(BeTrue())
+		Ω(info.Name).Should(Equal("VFS"))
+		config := lsx.Config{
+			"volumes": []interface{}{
+				map[string]interface{}{"name": "vol00", "type": "vfs"},
+			},
+		}
+		Ω(lsx.NewModuleGraph(lsx.WithRegistry(context.Background(), r), config).Module(
+			lsx.ModuleRef{Type: lsx.VolumeModuleType, Name: "vol00"},
+		)).Should(Equal(&registryModule{"a"}))
+		Ω(r.Unregister(lsx.VolumeModuleType, "vfs")).Should(BeTrue())
+		Ω(r.New(lsx.VolumeModuleType, "VFS")).Should(BeNil())
+		Ω(r.List()).Should(BeEmpty())
+	})
+	It("should reject invalid config keys", func() {
+		Ω(r.Register(lsx.VolumeModuleType, "vfs", ctor("vfs"),
+			lsx.ModuleConfigKey{Path: "a", Type: "integer", Default: "1"},
+		)).Should(MatchError("error: invalid module config key: " +
+			"volume vfs: path=a: expected integer default, actual string"))
+		Ω(r.List()).Should(BeEmpty())
+	})
+	It("should replace modules registered by the override", func() {
+		r.Override("vfs", "github.com/akutz/lsx_test")
+		Ω(r.Register(lsx.VolumeModuleType, "vfs", ctor("a"))).Should(Succeed())
+		Ω(r.Register(lsx.VolumeModuleType, "vfs", ctor("b"))).Should(Succeed())
+		Ω(r.New(lsx.VolumeModuleType, "vfs")).Should(
+			Equal(&registryModule{"b"}))
+		r.Override("vfs", "")
+		Ω(r.Register(lsx.VolumeModuleType, "vfs", ctor("c"))).Should(
+			HaveOccurred())
+	})
+	It("should unregister modules", func() {
+		r.Register(lsx.VolumeModuleType, "ebs", ctor("ebs"),
+			lsx.ModuleConfigKey{Path: "region", Default: "us-east-1"})
+		Ω(r.Unregister(lsx.VolumeModuleType, "ebs")).Should(BeTrue())
+		Ω(r.Unregister(lsx.VolumeModuleType, "ebs")).Should(BeFalse())
+		Ω(r.New(lsx.VolumeModuleType, "ebs")).Should(BeNil())
+		_, ok := r.Lookup(lsx.VolumeModuleType, "ebs")
+		Ω(ok).Should(BeFalse())
+		Ω(r.List()).Should(BeEmpty())
+		Ω(r.Configs()).Should(BeEmpty())
+	})
+	It("should construct modules that use the registry", func() {
+		r.Register(lsx.VolumeModuleType, "inner", ctor("inner"))
+		r.Register(lsx.VolumeModuleType, "outer", func() lsx.Module {
+			r.Register(lsx.ClientModuleType, "outer", ctor("outer"))
+			return r.New(lsx.VolumeModuleType, "inner")
+		})
+		Ω(r.New(lsx.VolumeModuleType, "outer")).Should(
+			Equal(&registryModule{"inner"}))
+	})
+	It("should be used by configs and graphs in its context", func() {
+		r.MustRegister(lsx.VolumeModuleType, "lsx-test-registry", ctor("vfs"),
+			lsx.ModuleConfigKey{Path: "root", Default: "/var/lib/vfs"})
+		config := lsx.Config{
+			"volumes": []interface{}{
+				map[string]interface{}{
+					"name": "vol00",
+					"type": "lsx-test-registry",
+				},
+			},
+		}
+		ctx := context.Background()
+		Ω(config.Get(ctx, "volumes.vol00.root")).Should(BeNil())
+		Ω(lsx.NewModuleGraph(ctx, config).Module(lsx.ModuleRef{
+			Type: lsx.VolumeModuleType, Name: "vol00",
+		})).Should(BeNil())
+
+		ctx = lsx.WithRegistry(ctx, r)
+		Ω(config.Get(ctx, "volumes.vol00.root")).Should(Equal("/var/lib/vfs"))
+		Ω(lsx.NewModuleGraph(ctx, config).Module(lsx.ModuleRef{
+			Type: lsx.VolumeModuleType, Name: "vol00",
+		})).Should(Equal(&registryModule{"vfs"}))
+	})
+	It("should return the registered servers", func() {
+		r.RegisterServer("csi", func() lsx.Server {
+			return &lifecycleServer{}
+		})
+		var servers []lsx.Server
+		for s := range r.Servers() {
+			servers = append(servers, s)
+		}
+		Ω(servers).Should(HaveLen(1))
+	})
+	It("should register and construct modules concurrently", func() {
+		const n = 32
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			name := fmt.Sprintf("vfs%02d", i)
+			wg.Add(4)
+			go func() {
+				defer wg.Done()
+				r.MustRegister(lsx.VolumeModuleType, name, ctor(name),
+					lsx.ModuleConfigKey{Path: "root", Default: "/" + name})
+			}()
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				if m := r.New(lsx.VolumeModuleType, name); m != nil {
+					Ω(m.Name()).Should(Equal(name))
+				}
+				r.Lookup(lsx.VolumeModuleType, name)
+			}()
+			go func() {
+				defer wg.Done()
+				r.List()
+				r.Configs()
+			}()
+			go func() {
+				defer wg.Done()
+				r.RegisterServer(name, func() lsx.Server {
+					return &lifecycleServer{}
+				})
+				for range r.Servers() {
+				}
+			}()
+		}
+		wg.Wait()
+		Ω(r.List()).Should(HaveLen(n))
+		Ω(r.Configs()).Should(HaveLen(n))
+	})
+	It("should guard the default registry", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			name := fmt.Sprintf("lsx-test-registry%02d", i)
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				lsx.MustRegisterModule(lsx.VolumeModuleType, name, ctor(name))
+			}()
+			go func() {
+				defer wg.Done()
+				lsx.NewModule(lsx.VolumeModuleType, name)
+				lsx.Modules()
+			}()
+		}
+		wg.Wait()
+		for i := 0; i < 16; i++ {
+			name := fmt.Sprintf("lsx-test-registry%02d", i)
+			Ω(lsx.DefaultRegistry.Unregister(
+				lsx.VolumeModuleType, name)).Should(BeTrue())
+		}
+	})
+})
@@ -3,7 +3,6 @@ package lsx
 import (
 	"context"
 	"io"
-	"sync"
 )
 
 // Server is the interface for a server.
@@ -28,29 +27,15 @@ type Server interface {
 
 type serverCtor func() Server
 
-var (
-	serverCtors    = map[string]serverCtor{}
-	serverCtorsRWL = sync.RWMutex{}
-)
-
 // RegisterServer registers the name of a new server type
-// and the function used to create a new server object.
+// and the function used to create a new server object with
+// DefaultRegistry.
 func RegisterServer(name string, ctor serverCtor) {
-	serverCtorsRWL.Lock()
-	defer serverCtorsRWL.Unlock()
-	serverCtors[name] = ctor
+	DefaultRegistry.RegisterServer(name, ctor)
 }
 
 // Servers returns a channel on which constructed server objects
-// for all registered servers are returned.
+// for all servers registered with DefaultRegistry are returned.
 func Servers() <-chan Server {
-	serverCtorsRWL.RLock()
-	defer serverCtorsRWL.RUnlock()
-	c := make(chan Server)
-	go func() {
-		for _, ctor := range serverCtors {
-			c <- ctor()
-		}
-	}()
-	return c
+	return DefaultRegistry.Servers()
 }